@@ -1,26 +1,41 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	_ "github.com/innoglobe/xmgo/docs"
 	"github.com/innoglobe/xmgo/internal/app"
+	"github.com/innoglobe/xmgo/internal/audit"
+	"github.com/innoglobe/xmgo/internal/auth"
 	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/health"
+	"github.com/innoglobe/xmgo/internal/infrastructure/consumer"
 	postgresrepository "github.com/innoglobe/xmgo/internal/infrastructure/db/postgres"
+	"github.com/innoglobe/xmgo/internal/infrastructure/db/querylog"
 	"github.com/innoglobe/xmgo/internal/infrastructure/server"
 	"github.com/innoglobe/xmgo/internal/infrastructure/server/handler"
+	"github.com/innoglobe/xmgo/internal/metrics"
+	"github.com/innoglobe/xmgo/internal/middleware"
 	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/innoglobe/xmgo/internal/tracing"
 	"github.com/innoglobe/xmgo/internal/usecase"
 	"github.com/innoglobe/xmgo/pkg/logger"
 	"github.com/innoglobe/xmgo/pkg/migrations"
 	"github.com/swaggo/files"
 	"github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"log"
+	"net/http"
+	"os"
+	"slices"
+	"time"
 )
 
+const tracingShutdownTimeout = 5 * time.Second
+
 // @title XMGO API
 // @version 1.0
 // @description This is a sample server for XMGO.
@@ -39,44 +54,141 @@ import (
 // @securityDefinitions.apikey Bearer
 // @in header
 // @name Authorization
+
+// @securityDefinitions.apikey ApiKey
+// @in header
+// @name X-API-Key
 func main() {
 	// Config file
 	configFile := flag.String("config", "/config/config.yaml", "Path to config file")
 	flag.Parse()
 	cfg, err := config.LoadConfig(*configFile)
 	if err != nil {
-		log.Fatal(err)
+		logger.NewLogger().Error("Failed to load config", "file", *configFile, "error", err)
+		os.Exit(1)
 	}
 
-	// Initialize kafka producer
-	kafkaProducer := eventservice.NewKafkaProducer(cfg.Kafka.Brokers, cfg.Kafka.Topic)
-
 	// Initialize logger
-	log := logger.NewLogger()
+	log, err := logger.New(logger.Options{Level: cfg.Log.Level, Format: cfg.Log.Format})
+	if err != nil {
+		logger.NewLogger().Error("Failed to initialize logger", "error", err)
+		os.Exit(1)
+	}
+
+	// The live settings are applied on config changes by the subscribers below
+	configWatcher := config.NewWatcher(*configFile, cfg, log)
+	configWatcher.Subscribe(func(old, cfg *config.Config) {
+		if old.Log.Level == cfg.Log.Level {
+			return
+		}
+		level := cfg.Log.Level
+		if level == "" {
+			level = "info"
+		}
+		if err := log.SetLevel(level); err != nil {
+			log.Error("Failed to change the log level", "error", err)
+		}
+	})
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Error("Failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize metrics
+	var appMetrics *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		appMetrics = metrics.New()
+	}
+
+	// Initialize event producer
+	eventProducer, err := eventservice.NewProducer(cfg, log)
+	if err != nil {
+		log.Error("Failed to initialize event producer", "error", err)
+		os.Exit(1)
+	}
+	configWatcher.Subscribe(func(old, cfg *config.Config) {
+		if old.Kafka.Topic != cfg.Kafka.Topic {
+			eventservice.SetKafkaTopic(eventProducer, cfg.Kafka.Topic)
+		}
+	})
 
 	// Initialize db conn
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		cfg.Database.User, cfg.Database.Pass, cfg.Database.Host, cfg.Database.Port, cfg.Database.Name)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	dsn := cfg.Database.DSN()
+	queryLog := querylog.New(cfg.Database, log)
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: queryLog})
 	if err != nil {
-		log.Error(fmt.Sprint(err.Error()))
+		log.Error("Failed to connect to the database", "error", err)
+		os.Exit(1)
+	}
+	if err := db.Use(tracing.NewGormPlugin()); err != nil {
+		log.Error("Failed to initialize database tracing", "error", err)
+		os.Exit(1)
+	}
+	if appMetrics != nil {
+		if err := instrument(appMetrics, db, cfg.Database.Name, eventProducer); err != nil {
+			log.Error("Failed to initialize metrics", "error", err)
+			os.Exit(1)
+		}
 	}
 
 	// Run database migrations
+	migrationsPath := cfg.Database.MigrationsPath
+	if migrationsPath == "" {
+		migrationsPath = config.DefaultMigrationsPath
+	}
 	log.Info("Starting migrations...")
-	if err := migrations.Migrate(dsn, "./migrations"); err != nil {
-		log.Error(fmt.Sprintf("Failed to run migrations: %v", err))
-	} else {
-		log.Info("Migrations applied successfully.")
+	if err := migrations.Migrate(dsn, migrationsPath); err != nil {
+		log.Error("Failed to run migrations", "error", err)
+		os.Exit(1)
+	}
+	log.Info("Migrations applied successfully.")
+
+	// Dependency checks of the health probes
+	healthChecker, err := newHealthChecker(cfg, db, migrationsPath)
+	if err != nil {
+		log.Error("Failed to initialize health checks", "error", err)
+		os.Exit(1)
 	}
 
 	// Initialize repository and usecase
-	companyRepo := postgresrepository.NewPostgresRepository(db)
-	companyUsecase := usecase.NewCompanyUsecase(companyRepo, kafkaProducer)
+	companyRepo := tracing.InstrumentCompanyRepository(postgresrepository.NewPostgresRepository(db))
+	companyGrantRepo := postgresrepository.NewCompanyGrantRepository(db)
+	companyUsecase := usecase.NewCompanyUsecase(companyRepo, companyGrantRepo, eventProducer, cfg.Events)
+	if appMetrics != nil {
+		companyUsecase = appMetrics.InstrumentCompanyUsecase(companyUsecase)
+	}
+	companyUsecase = tracing.InstrumentCompanyUsecase(companyUsecase)
+	apiKeyRepo := postgresrepository.NewAPIKeyRepository(db)
+	apiKeyUsecase := usecase.NewAPIKeyUsecase(apiKeyRepo, log)
+	snapshotUsecase := usecase.NewSnapshotUsecase(companyRepo, eventProducer)
 
 	// Initialize handlers
 	companyHandler := handler.NewCompanyHandler(companyUsecase)
-	authHandler := handler.NewAuthHandler(cfg.JWT.Secret)
+	auditor := audit.NewLogAuditor(log)
+	loginThrottler := auth.NewLoginThrottler(cfg.Login, auditor)
+	configWatcher.Subscribe(func(old, cfg *config.Config) {
+		if old.Login != cfg.Login {
+			loginThrottler.Configure(cfg.Login)
+		}
+	})
+	authHandler := handler.NewAuthHandler(cfg.JWT, loginThrottler)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyUsecase)
+	eventHandler := handler.NewEventHandler(snapshotUsecase, usecase.RepublishCheckpointDir)
+	healthHandler := handler.NewHealthHandler(healthChecker)
+
+	// Client certificates and API keys are tried before JWTs so machine clients never need to sign in
+	var authenticators []middleware.Authenticator
+	if cfg.Server.SSL.Enabled && cfg.Server.SSL.ClientAuth.Enabled {
+		authenticators = append(authenticators, middleware.NewCertAuthenticator(cfg.Server.SSL.ClientAuth.Identities))
+	}
+	authenticators = append(authenticators,
+		middleware.NewAPIKeyAuthenticator(apiKeyUsecase),
+		middleware.NewJWTAuthenticator(cfg.JWT.Secret),
+	)
+	authMiddleware := middleware.AuthMiddleware(authenticators...)
 
 	// Switch gin to release mode if needed
 	if cfg.Production {
@@ -84,18 +196,35 @@ func main() {
 	}
 
 	// Initialize router with handler
-	r := server.NewRouter(companyHandler, authHandler)
-	router := r.RegisterRoutes(cfg.JWT.Secret)
-
-	// Configure CORS
-	//router.Use(cors.New(cors.Config{
-	//	AllowOrigins:     []string{"*"},
-	//	AllowMethods:     []string{"POST", "PATCH", "DELETE"},
-	//	AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-	//	ExposeHeaders:    []string{"Content-Length"},
-	//	AllowCredentials: true,
-	//	MaxAge:           12 * time.Hour,
-	//}))
+	r := server.NewRouter(companyHandler, authHandler, apiKeyHandler, eventHandler, healthHandler)
+	middlewares := []gin.HandlerFunc{otelgin.Middleware(tracing.ServiceName(cfg.Tracing))}
+	if appMetrics != nil {
+		middlewares = append(middlewares, appMetrics.GinMiddleware())
+	}
+	middlewares = append(middlewares, middleware.RequestLogger(log))
+	if cfg.AccessLog.Enabled {
+		accessLog, err := middleware.AccessLog(cfg.AccessLog)
+		if err != nil {
+			log.Error("Failed to initialize access log", "error", err)
+			os.Exit(1)
+		}
+		middlewares = append(middlewares, accessLog)
+	}
+	cors := middleware.NewCORS(cfg.Server.CORS)
+	configWatcher.Subscribe(func(old, cfg *config.Config) {
+		cors.Configure(cfg.Server.CORS)
+	})
+	middlewares = append(middlewares, cors.Handler())
+	features := middleware.NewFeatures(cfg.Features)
+	configWatcher.Subscribe(func(old, cfg *config.Config) {
+		features.Configure(cfg.Features)
+	})
+	router := r.RegisterRoutes(authMiddleware, middlewares...)
+	// Only the configured proxies may set the client IP through X-Forwarded-For
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Error("Invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
 
 	// Add security headers
 	router.Use(func(c *gin.Context) {
@@ -105,17 +234,109 @@ func main() {
 		c.Next()
 	})
 
-	// Swagger
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// Swagger, behind the swagger feature flag
+	router.GET("/swagger/*any", features.Require("swagger"), ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	// The health checker refreshes its results in the background and reports
+	// not ready first thing on shutdown, the republish jobs are stopped before
+	// the event producer closes
+	workers := []app.Worker{healthChecker, configWatcher, eventHandler}
+
+	// Metrics, on their own port when one is configured, which may be the admin
+	// one. On the API port they are for admins only.
+	adminPublic := map[string]gin.HandlerFunc{}
+	if appMetrics != nil {
+		path := cfg.Metrics.Path
+		if path == "" {
+			path = metrics.DefaultPath
+		}
+		switch {
+		case cfg.Metrics.Port == 0:
+			router.GET(path, authMiddleware, middleware.RequireAdmin(), gin.WrapH(appMetrics.Handler()))
+		case cfg.Admin.Enabled && cfg.Metrics.Port == cfg.Admin.Port:
+			adminPublic[path] = gin.WrapH(appMetrics.Handler())
+		default:
+			mux := http.NewServeMux()
+			mux.Handle(path, appMetrics.Handler())
+			workers = append(workers, server.NewHTTPWorker(fmt.Sprintf("%s:%d", cfg.Metrics.Host, cfg.Metrics.Port), mux))
+		}
+	}
+
+	// Admin server with pprof, runtime stats, the log level and the effective config
+	if cfg.Admin.Enabled {
+		adminHandler := handler.NewAdminHandler(configWatcher.Current, log, router.Routes, queryLog)
+		adminRouter := server.NewAdminRouter(adminHandler, cfg.Admin.Username, cfg.Admin.Password, adminPublic)
+		workers = append(workers, server.NewHTTPWorker(fmt.Sprintf("%s:%d", cfg.Admin.Host, cfg.Admin.Port), adminRouter))
+	}
+
+	// Consume the company commands of partner systems
+	if cfg.Kafka.Commands.Enabled {
+		commandConsumer, err := consumer.NewCommandConsumer(cfg.Kafka, companyUsecase, log)
+		if err != nil {
+			log.Error("Failed to initialize command consumer", "error", err)
+			os.Exit(1)
+		}
+		workers = append(workers, commandConsumer)
+	}
 
 	// Initialize the application
-	application, err := app.NewApp(cfg, companyUsecase, log, router, kafkaProducer)
+	application, err := app.NewApp(cfg, companyUsecase, log, router, eventProducer, workers...)
 	if err != nil {
-		log.Error(fmt.Sprintf("Failed to initialize app: %v", err))
+		log.Error("Failed to initialize app", "error", err)
+		os.Exit(1)
 	}
+	configWatcher.Subscribe(application.Reconfigure)
 
 	// Run the application
 	if err := application.Run(); err != nil {
-		log.Error(fmt.Sprintf("Application failed: %v", err))
+		log.Error("Application failed", "error", err)
+	}
+
+	// Flush the spans still buffered
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error("Failed to flush traces", "error", err)
+	}
+}
+
+// instrument feeds the metrics with the database queries and pool, and the
+// Kafka producer statistics
+func instrument(m *metrics.Metrics, db *gorm.DB, dbName string, producer eventservice.Producer) error {
+	if err := db.Use(m.GormPlugin()); err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := m.RegisterDBStats(sqlDB, dbName); err != nil {
+		return err
+	}
+	return m.RegisterProducer(producer)
+}
+
+// newHealthChecker registers the checks of the database, its migrations and,
+// when the service talks to Kafka, the brokers
+func newHealthChecker(cfg *config.Config, db *gorm.DB, migrationsPath string) (*health.Checker, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	latest, err := migrations.Latest(migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	checker := health.NewChecker(cfg.Health)
+	checker.Register("database", health.DBCheck(sqlDB))
+	checker.Register("migrations", health.MigrationCheck(sqlDB, latest))
+	if slices.Contains(eventservice.Drivers(cfg.Events), "kafka") || cfg.Kafka.Commands.Enabled {
+		dialer, err := eventservice.NewKafkaDialer(cfg.Kafka)
+		if err != nil {
+			return nil, err
+		}
+		checker.Register("kafka", health.KafkaCheck(dialer, cfg.Kafka.Brokers))
 	}
+	return checker, nil
 }
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/entity"
+	postgresrepository "github.com/innoglobe/xmgo/internal/infrastructure/db/postgres"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/innoglobe/xmgo/pkg/checkpoint"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const usage = `Usage: xmgo <command> [flags]
+
+Commands:
+  events replay-dlq   Replay the events spooled to the dead-letter spool
+  events republish    Publish a snapshot event for every company
+  events docs         Generate the AsyncAPI document and JSON Schemas of the events
+
+Run "xmgo <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] + " " + os.Args[2] {
+	case "events replay-dlq":
+		err = replayDeadLetters(ctx, os.Args[3:])
+	case "events republish":
+		err = republish(ctx, os.Args[3:])
+	case "events docs":
+		err = generateEventDocs(os.Args[3:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func replayDeadLetters(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("events replay-dlq", flag.ExitOnError)
+	configFile := fs.String("config", "/config/config.yaml", "Path to config file")
+	dir := fs.String("dir", "", "Dead-letter spool directory (defaults to kafka.dead_letter_dir)")
+	dryRun := fs.Bool("dry-run", false, "Only count the spooled events")
+	_ = fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = eventservice.DeadLetterDir(cfg.Kafka)
+	}
+	spool := eventservice.NewDeadLetterSpool(*dir)
+
+	if *dryRun {
+		n, err := spool.Count()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d events in %s\n", n, *dir)
+		return nil
+	}
+
+	// The spooled messages carry their topic
+	writer, err := eventservice.NewKafkaWriter(cfg.Kafka, "")
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	n, err := spool.Replay(ctx, writer)
+	fmt.Printf("Replayed %d events from %s\n", n, *dir)
+	return err
+}
+
+func republish(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("events republish", flag.ExitOnError)
+	configFile := fs.String("config", "/config/config.yaml", "Path to config file")
+	tenant := fs.String("tenant", auth.DefaultTenant, "Tenant whose companies are republished")
+	companyType := fs.String("type", "", "Only republish companies of this type")
+	registered := fs.String("registered", "", "Only republish registered (true) or unregistered (false) companies")
+	updatedSince := fs.String("updated-since", "", "Only republish companies updated since this RFC 3339 time")
+	afterID := fs.String("after-id", "", "Start after the company with this ID instead of the checkpoint")
+	rate := fs.Int("rate", usecase.DefaultRepublishRate, "Maximum events per second, 0 is unlimited")
+	checkpointFile := fs.String("checkpoint", "", "Checkpoint file (defaults to ./var/checkpoints/republish-<tenant>, followed by a hash of the filters if any)")
+	reset := fs.Bool("reset", false, "Ignore the checkpoint and start from the first company")
+	dryRun := fs.Bool("dry-run", false, "Only count the companies that would be republished")
+	_ = fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	opts := usecase.RepublishOptions{RatePerSecond: *rate, DryRun: *dryRun}
+	if *companyType != "" {
+		opts.Filter.Type = entity.CompanyType(*companyType)
+		if err := opts.Filter.Type.IsValid(); err != nil {
+			return err
+		}
+	}
+	if *registered != "" {
+		b, err := strconv.ParseBool(*registered)
+		if err != nil {
+			return fmt.Errorf("invalid -registered: %w", err)
+		}
+		opts.Filter.Registered = &b
+	}
+	if *updatedSince != "" {
+		if opts.Filter.UpdatedSince, err = time.Parse(time.RFC3339, *updatedSince); err != nil {
+			return fmt.Errorf("invalid -updated-since: %w", err)
+		}
+	}
+	if *afterID != "" {
+		if opts.Filter.AfterID, err = uuid.Parse(*afterID); err != nil {
+			return fmt.Errorf("invalid -after-id: %w", err)
+		}
+	}
+
+	if *checkpointFile == "" {
+		// Each filter set resumes from its own checkpoint
+		*checkpointFile = usecase.RepublishCheckpointPath(usecase.RepublishCheckpointDir, *tenant, opts.Filter)
+	}
+	cp := checkpoint.NewFile(*checkpointFile)
+	if *reset {
+		if err := cp.Clear(); err != nil {
+			return err
+		}
+	}
+	opts.Checkpoint = cp
+	opts.Progress = func(res usecase.RepublishResult) {
+		fmt.Printf("%d companies, %d published, last id %s\n", res.Matched, res.Published, res.LastID)
+	}
+
+	db, err := gorm.Open(postgres.Open(cfg.Database.DSN()), &gorm.Config{})
+	if err != nil {
+		return err
+	}
+	var producer eventservice.Producer = &eventservice.NoOpProducer{}
+	if !*dryRun {
+		log, err := logger.New(logger.Options{Level: cfg.Log.Level, Format: cfg.Log.Format, Output: os.Stderr})
+		if err != nil {
+			return err
+		}
+		if producer, err = eventservice.NewProducer(cfg, log); err != nil {
+			return err
+		}
+	}
+	defer producer.Close()
+
+	// The repository is scoped to the tenant of the caller
+	ctx = auth.NewContext(ctx, &auth.Identity{
+		Subject:  "xmgo-cli",
+		Roles:    []string{auth.RoleAdmin},
+		TenantID: *tenant,
+	})
+	snapshots := usecase.NewSnapshotUsecase(postgresrepository.NewPostgresRepository(db), producer)
+	res, err := snapshots.Republish(ctx, opts)
+	if err != nil {
+		if !*dryRun {
+			fmt.Printf("Stopped after %d companies, run again to resume from the checkpoint\n", res.Published)
+		}
+		return err
+	}
+
+	if *dryRun {
+		fmt.Printf("%d companies would be republished\n", res.Matched)
+		return nil
+	}
+	fmt.Printf("Republished %d companies\n", res.Published)
+	// Done, the next run starts over
+	return cp.Clear()
+}
+
+func generateEventDocs(args []string) error {
+	fs := flag.NewFlagSet("events docs", flag.ExitOnError)
+	out := fs.String("out", "docs/events", "Output directory")
+	_ = fs.Parse(args)
+
+	doc, err := eventservice.AsyncAPIDocument(eventservice.DefaultTopic)
+	if err != nil {
+		return err
+	}
+
+	// Published schemas are never removed, consumers may still read events of
+	// older versions
+	written, err := eventservice.WriteEventSchemas(filepath.Join(*out, "schemas"))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(*out, "asyncapi.json"), doc, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote asyncapi.json and %d new or changed schemas to %s\n", len(written), *out)
+	for _, name := range written {
+		fmt.Println("  " + name)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// Package events holds the AsyncAPI document and the JSON Schemas of the
+// published events. They are generated from the event structs, regenerate
+// them with: make event-docs
+package events
+
+import "embed"
+
+// FS holds asyncapi.json and schemas/*.json
+//
+//go:embed asyncapi.json schemas
+var FS embed.FS
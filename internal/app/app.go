@@ -2,24 +2,37 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	eventservice "github.com/innoglobe/xmgo/internal/service"
 	"github.com/innoglobe/xmgo/internal/usecase"
-	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/innoglobe/xmgo/internal/config"
 	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/innoglobe/xmgo/pkg/tlsreload"
 )
 
+const defaultTLSReloadInterval = 10 * time.Second
+
 type App interface {
 	Run() error
+	// Reconfigure applies the live settings the app owns, the certificate
+	// files. It is a config.Subscriber.
+	Reconfigure(old, cfg *config.Config)
+}
+
+// Worker is a background process, such as a Kafka consumer, running for as
+// long as the app does. Run returns once ctx is cancelled.
+type Worker interface {
+	Run(ctx context.Context) error
 }
 
 type app struct {
@@ -28,56 +41,137 @@ type app struct {
 	Config         *config.Config
 	CompanyUseCase usecase.CompanyUsecaseInterface
 	Logger         logger.LoggerInterface
-	KafkaProducer  *eventservice.KafkaProducer
+	EventProducer  eventservice.Producer
+	TLSReloader    *tlsreload.Reloader
+	Workers        []Worker
 }
 
-func NewApp(cfg *config.Config, companyUsecase usecase.CompanyUsecaseInterface, log logger.LoggerInterface, router *gin.Engine, kafkaProducer *eventservice.KafkaProducer) (App, error) {
-	return &app{
+func NewApp(cfg *config.Config, companyUsecase usecase.CompanyUsecaseInterface, log logger.LoggerInterface, router *gin.Engine, eventProducer eventservice.Producer, workers ...Worker) (App, error) {
+	a := &app{
 		//Router:         router,
 		Server:         &http.Server{Addr: fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port), Handler: router},
 		CompanyUseCase: companyUsecase,
 		Config:         cfg,
 		Logger:         log,
-		KafkaProducer:  kafkaProducer,
-	}, nil
+		EventProducer:  eventProducer,
+		Workers:        workers,
+	}
+
+	if ssl := cfg.Server.SSL; ssl.Enabled {
+		var caFile string
+		clientAuth := tls.NoClientCert
+		if ssl.ClientAuth.Enabled {
+			caFile = ssl.ClientAuth.CAFile
+			clientAuth = tls.VerifyClientCertIfGiven
+			if ssl.ClientAuth.Required {
+				clientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+
+		reloader, err := tlsreload.New(ssl.CertFile, ssl.KeyFile, caFile, log)
+		if err != nil {
+			return nil, err
+		}
+		a.TLSReloader = reloader
+		a.Server.TLSConfig = reloader.TLSConfig(clientAuth)
+	}
+
+	return a, nil
+}
+
+func (a *app) Reconfigure(old, cfg *config.Config) {
+	prev, ssl := old.Server.SSL, cfg.Server.SSL
+	if a.TLSReloader == nil || (prev.CertFile == ssl.CertFile && prev.KeyFile == ssl.KeyFile && prev.ClientAuth.CAFile == ssl.ClientAuth.CAFile) {
+		return
+	}
+	var caFile string
+	if prev.ClientAuth.Enabled {
+		caFile = ssl.ClientAuth.CAFile
+	}
+	if err := a.TLSReloader.SetFiles(ssl.CertFile, ssl.KeyFile, caFile); err != nil {
+		a.Logger.Error("Failed to switch the TLS certificate files, keeping the previous ones", "error", err)
+		return
+	}
+	a.Logger.Info("TLS certificate files switched", "cert_file", ssl.CertFile)
 }
 
 func (a *app) Run() error {
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	// Pick up renewed certificates without a restart
+	if a.TLSReloader != nil {
+		interval := time.Duration(a.Config.Server.SSL.ReloadInterval) * time.Second
+		if interval <= 0 {
+			interval = defaultTLSReloadInterval
+		}
+		go a.TLSReloader.Watch(runCtx, interval)
+	}
+
 	// Start server in a goroutine
 	go func() {
 		var err error
-		if a.Config.Server.SSL.Enabled {
-			err = a.Server.ListenAndServeTLS(a.Config.Server.SSL.CertFile, a.Config.Server.SSL.KeyFile)
+		if a.Server.TLSConfig != nil {
+			// Certificates are served by the TLS config
+			err = a.Server.ListenAndServeTLS("", "")
 		} else {
 			err = a.Server.ListenAndServe()
 		}
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			a.Logger.Error(fmt.Sprintf("Couldn't start server: %v", err))
+			a.Logger.Error("Couldn't start server", "addr", a.Server.Addr, "error", err)
 		}
 	}()
 
+	// Start the background workers, a failing worker stops the app
+	workersCtx, stopWorkers := context.WithCancel(runCtx)
+	defer stopWorkers()
+	failed := make(chan error, len(a.Workers))
+	var workers sync.WaitGroup
+	for _, w := range a.Workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			if err := w.Run(workersCtx); err != nil {
+				failed <- err
+			}
+		}()
+	}
+
 	// Wait for shutdown signal
 	q := make(chan os.Signal, 1)
 	signal.Notify(q, syscall.SIGINT, syscall.SIGTERM)
-	<-q
-	a.Logger.Info("Shutdown signal received, shutting down server...")
+	var runErr error
+	select {
+	case <-q:
+		a.Logger.Info("Shutdown signal received, shutting down server...")
+	case runErr = <-failed:
+		a.Logger.Error("Worker failed, shutting down server", "error", runErr)
+	}
 
-	// Close the Kafka producer
-	if err := a.KafkaProducer.Close(); err != nil {
-		log.Fatalf("Failed to close Kafka producer: %v", err)
-	} else {
-		a.Logger.Info("Kafka producer closed")
+	// Stop the workers first so nothing new comes in while the rest shuts down
+	stopWorkers()
+	workers.Wait()
+	if len(a.Workers) > 0 {
+		a.Logger.Info("Workers stopped")
 	}
 
 	// Graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.Config.Server.Timeout)*time.Second)
 	defer cancel()
 	if err := a.Server.Shutdown(ctx); err != nil {
-		a.Logger.Error(fmt.Sprintf("Server forced to shutdown: %v", err))
+		a.Logger.Error("Server forced to shutdown", "error", err)
 	} else {
 		a.Logger.Info("Server gracefully shutdown")
 	}
 
+	// Close the event producer once nothing publishes anymore
+	if err := a.EventProducer.Close(); err != nil {
+		a.Logger.Error("Failed to close event producer", "error", err)
+		runErr = errors.Join(runErr, err)
+	} else {
+		a.Logger.Info("Event producer closed")
+	}
+
 	a.Logger.Info("Server exiting")
-	return nil
+	return runErr
 }
@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/innoglobe/xmgo/pkg/logger"
+)
+
+// Audit actions
+const (
+	ActionSignInFailed = "auth.signin_failed"
+	ActionLocked       = "auth.locked"
+	ActionUnlocked     = "auth.unlocked"
+)
+
+// Event is a single entry of the audit trail
+type Event struct {
+	Time    time.Time         `json:"time"`
+	Action  string            `json:"action"`
+	Actor   string            `json:"actor,omitempty"`
+	Target  string            `json:"target,omitempty"`
+	IP      string            `json:"ip,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Auditor records security relevant events
+type Auditor interface {
+	Record(ctx context.Context, event Event)
+}
+
+type logAuditor struct {
+	log logger.LoggerInterface
+}
+
+// NewLogAuditor returns an Auditor logging every event with its fields, through
+// the request's logger when ctx carries one
+func NewLogAuditor(log logger.LoggerInterface) Auditor {
+	return &logAuditor{log: log}
+}
+
+func (a *logAuditor) Record(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	args := []any{"audit", true, "action", event.Action, "time", event.Time}
+	if event.Actor != "" {
+		args = append(args, "actor", event.Actor)
+	}
+	if event.Target != "" {
+		args = append(args, "target", event.Target)
+	}
+	if event.IP != "" {
+		args = append(args, "ip", event.IP)
+	}
+	if len(event.Details) > 0 {
+		args = append(args, "details", event.Details)
+	}
+	logger.FromContext(ctx, a.log).Info("Audit event", args...)
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// Authentication methods
+const (
+	MethodJWT    = "jwt"
+	MethodAPIKey = "api_key"
+	MethodMTLS   = "mtls"
+	// MethodCommand is used for commands consumed from Kafka
+	MethodCommand = "command"
+)
+
+// Roles
+const (
+	RoleAdmin = "admin"
+)
+
+// Scopes that can be granted to API keys
+const (
+	ScopeCompaniesRead  = "companies:read"
+	ScopeCompaniesWrite = "companies:write"
+	ScopeAdmin          = "admin"
+)
+
+// DefaultTenant is used for callers whose credentials don't name a tenant
+const DefaultTenant = "default"
+
+// KnownScopes lists every scope an API key may carry
+var KnownScopes = []string{ScopeCompaniesRead, ScopeCompaniesWrite, ScopeAdmin}
+
+// Identity represents the authenticated caller of a request
+type Identity struct {
+	Subject string
+	Method  string
+	Roles   []string
+	Groups  []string
+	// TenantID is the business unit the caller belongs to
+	TenantID string
+	// Scopes restricts what the caller may do. A nil slice means unrestricted,
+	// which is the case for interactive users signed in with a JWT.
+	Scopes []string
+}
+
+// HasRole reports whether the identity carries the given role
+func (i *Identity) HasRole(role string) bool {
+	return slices.Contains(i.Roles, role)
+}
+
+// HasScope reports whether the identity is allowed to act within the given scope
+func (i *Identity) HasScope(scope string) bool {
+	if i.Scopes == nil {
+		return true
+	}
+	return slices.Contains(i.Scopes, scope) || slices.Contains(i.Scopes, ScopeAdmin)
+}
+
+// IsAdmin reports whether the identity has administrative rights
+func (i *Identity) IsAdmin() bool {
+	return i.HasRole(RoleAdmin) || slices.Contains(i.Scopes, ScopeAdmin)
+}
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx carrying the identity
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx, if any
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok && id != nil
+}
+
+// TenantFromContext returns the tenant of the caller stored in ctx, falling
+// back to the default tenant
+func TenantFromContext(ctx context.Context) string {
+	if id, ok := FromContext(ctx); ok && id.TenantID != "" {
+		return id.TenantID
+	}
+	return DefaultTenant
+}
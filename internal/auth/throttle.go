@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/audit"
+	"github.com/innoglobe/xmgo/internal/config"
+)
+
+// Defaults used when a LoginConf value is left empty
+const (
+	defaultFreeAttempts     = 3
+	defaultBackoffBase      = time.Second
+	defaultBackoffMax       = time.Minute
+	defaultLockoutThreshold = 10
+	defaultLockoutDuration  = 15 * time.Minute
+	defaultFailureWindow    = 15 * time.Minute
+)
+
+// ThrottleStatus tells whether a sign-in attempt may proceed
+type ThrottleStatus struct {
+	// RetryAfter is how long the caller has to wait. Zero means go ahead.
+	RetryAfter time.Duration
+	// Locked is set when the wait is caused by a lockout rather than a backoff
+	Locked bool
+}
+
+type attempts struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	lockedUntil  time.Time
+}
+
+// LoginThrottler counts failed sign-ins per username and per ip, applies an
+// exponential backoff after a few failures and locks the key out for a while
+// once the lockout threshold is reached
+type LoginThrottler struct {
+	// The thresholds are guarded by mu, see Configure
+	freeAttempts     int
+	backoffBase      time.Duration
+	backoffMax       time.Duration
+	lockoutThreshold int
+	lockoutDuration  time.Duration
+	failureWindow    time.Duration
+
+	auditor audit.Auditor
+	now     func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*attempts
+	lastSweep time.Time
+}
+
+func NewLoginThrottler(cfg config.LoginConf, auditor audit.Auditor) *LoginThrottler {
+	t := &LoginThrottler{
+		auditor: auditor,
+		now:     time.Now,
+		entries: make(map[string]*attempts),
+	}
+	t.Configure(cfg)
+	return t
+}
+
+// Configure changes the thresholds at runtime. The failures already counted
+// are kept and judged by the new thresholds.
+func (t *LoginThrottler) Configure(cfg config.LoginConf) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.freeAttempts = intOr(cfg.FreeAttempts, defaultFreeAttempts)
+	t.backoffBase = secondsOr(cfg.BackoffBase, defaultBackoffBase)
+	t.backoffMax = secondsOr(cfg.BackoffMax, defaultBackoffMax)
+	t.lockoutThreshold = intOr(cfg.LockoutThreshold, defaultLockoutThreshold)
+	t.lockoutDuration = secondsOr(cfg.LockoutDuration, defaultLockoutDuration)
+	t.failureWindow = secondsOr(cfg.FailureWindow, defaultFailureWindow)
+}
+
+// Check reports whether a sign-in for username from ip may be attempted now
+func (t *LoginThrottler) Check(ctx context.Context, username, ip string) ThrottleStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var status ThrottleStatus
+	for _, key := range throttleKeys(username, ip) {
+		e := t.entry(ctx, key, now, false)
+		if e == nil {
+			continue
+		}
+		if now.Before(e.lockedUntil) {
+			status.Locked = true
+			status.RetryAfter = max(status.RetryAfter, e.lockedUntil.Sub(now))
+		} else if now.Before(e.blockedUntil) {
+			status.RetryAfter = max(status.RetryAfter, e.blockedUntil.Sub(now))
+		}
+	}
+	return status
+}
+
+// Failure records a failed sign-in and returns the resulting throttle status
+func (t *LoginThrottler) Failure(ctx context.Context, username, ip string) ThrottleStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.sweep(ctx, now)
+
+	var status ThrottleStatus
+	for _, key := range throttleKeys(username, ip) {
+		e := t.entry(ctx, key, now, true)
+		e.failures++
+		e.lastFailure = now
+
+		if e.failures >= t.lockoutThreshold {
+			e.lockedUntil = now.Add(t.lockoutDuration)
+			status.Locked = true
+			status.RetryAfter = max(status.RetryAfter, t.lockoutDuration)
+			t.auditor.Record(ctx, audit.Event{
+				Time:   now,
+				Action: audit.ActionLocked,
+				Target: key,
+				IP:     ip,
+				Details: map[string]string{
+					"failures": strconv.Itoa(e.failures),
+					"until":    e.lockedUntil.UTC().Format(time.RFC3339),
+				},
+			})
+		} else if e.failures > t.freeAttempts {
+			delay := t.backoff(e.failures - t.freeAttempts)
+			e.blockedUntil = now.Add(delay)
+			status.RetryAfter = max(status.RetryAfter, delay)
+		}
+	}
+
+	t.auditor.Record(ctx, audit.Event{
+		Time:   now,
+		Action: audit.ActionSignInFailed,
+		Target: "user:" + normalizeUsername(username),
+		IP:     ip,
+	})
+	return status
+}
+
+// Success clears the failure counter of the username after a successful sign-in.
+// The ip counter is kept so one valid account can't be used to reset guessing
+// against others from the same address.
+func (t *LoginThrottler) Success(_ context.Context, username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, "user:"+normalizeUsername(username))
+}
+
+// Unlock lifts a lockout on a username ahead of time. It reports whether the
+// username was locked, the failures of a username that isn't are kept. The ip
+// counters are kept too, so an address that was guessing stays locked while
+// the user signs in from any other.
+func (t *LoginThrottler) Unlock(ctx context.Context, username, actor string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	key := "user:" + normalizeUsername(username)
+	e, ok := t.entries[key]
+	if !ok || !now.Before(e.lockedUntil) {
+		return false
+	}
+	delete(t.entries, key)
+	t.auditor.Record(ctx, audit.Event{
+		Time:    now,
+		Action:  audit.ActionUnlocked,
+		Actor:   actor,
+		Target:  key,
+		Details: map[string]string{"reason": "manual"},
+	})
+	return true
+}
+
+// entry returns the counters for key, resetting them once the failure window
+// or the lockout has passed. Must be called with t.mu held.
+func (t *LoginThrottler) entry(ctx context.Context, key string, now time.Time, create bool) *attempts {
+	e, ok := t.entries[key]
+	if ok && !e.lockedUntil.IsZero() && !now.Before(e.lockedUntil) {
+		t.auditor.Record(ctx, audit.Event{
+			Time:    now,
+			Action:  audit.ActionUnlocked,
+			Target:  key,
+			Details: map[string]string{"reason": "expired"},
+		})
+		delete(t.entries, key)
+		ok = false
+	} else if ok && e.lockedUntil.IsZero() && now.Sub(e.lastFailure) > t.failureWindow {
+		delete(t.entries, key)
+		ok = false
+	}
+
+	if !ok {
+		if !create {
+			return nil
+		}
+		e = &attempts{}
+		t.entries[key] = e
+	}
+	return e
+}
+
+// sweep drops stale counters at most once per failure window so the map
+// doesn't grow with every ip that ever failed. Must be called with t.mu held.
+func (t *LoginThrottler) sweep(ctx context.Context, now time.Time) {
+	if now.Sub(t.lastSweep) < t.failureWindow {
+		return
+	}
+	t.lastSweep = now
+	for key := range t.entries {
+		// entry resets whatever has expired
+		t.entry(ctx, key, now, false)
+	}
+}
+
+func (t *LoginThrottler) backoff(n int) time.Duration {
+	delay := t.backoffBase
+	for i := 1; i < n && delay < t.backoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, t.backoffMax)
+}
+
+func throttleKeys(username, ip string) []string {
+	return []string{"user:" + normalizeUsername(username), "ip:" + ip}
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func intOr(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+func secondsOr(v int, def time.Duration) time.Duration {
+	if v > 0 {
+		return time.Duration(v) * time.Second
+	}
+	return def
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/audit"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingAuditor struct {
+	events []audit.Event
+}
+
+func (a *recordingAuditor) Record(_ context.Context, event audit.Event) {
+	a.events = append(a.events, event)
+}
+
+func (a *recordingAuditor) actions() []string {
+	out := make([]string, len(a.events))
+	for i, e := range a.events {
+		out[i] = e.Action
+	}
+	return out
+}
+
+func newTestThrottler() (*LoginThrottler, *recordingAuditor, *time.Time) {
+	auditor := &recordingAuditor{}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t := NewLoginThrottler(config.LoginConf{
+		FreeAttempts:     2,
+		BackoffBase:      1,
+		BackoffMax:       2,
+		LockoutThreshold: 6,
+		LockoutDuration:  60,
+		FailureWindow:    300,
+	}, auditor)
+	t.now = func() time.Time { return now }
+	return t, auditor, &now
+}
+
+func TestLoginThrottler_Backoff(t *testing.T) {
+	throttler, _, now := newTestThrottler()
+	ctx := context.Background()
+
+	assert.Zero(t, throttler.Failure(ctx, "demo", "10.0.0.1").RetryAfter)
+	assert.Zero(t, throttler.Failure(ctx, "demo", "10.0.0.1").RetryAfter)
+	assert.Equal(t, time.Second, throttler.Failure(ctx, "demo", "10.0.0.1").RetryAfter)
+	assert.Equal(t, time.Second, throttler.Check(ctx, "demo", "10.0.0.2").RetryAfter, "username counter applies from any ip")
+
+	*now = now.Add(time.Second)
+	assert.Equal(t, 2*time.Second, throttler.Failure(ctx, "demo", "10.0.0.1").RetryAfter)
+	*now = now.Add(2 * time.Second)
+	assert.Equal(t, 2*time.Second, throttler.Failure(ctx, "demo", "10.0.0.1").RetryAfter, "backoff is capped")
+}
+
+func TestLoginThrottler_LockoutAndExpiry(t *testing.T) {
+	throttler, auditor, now := newTestThrottler()
+	ctx := context.Background()
+
+	var status ThrottleStatus
+	for i := 0; i < 6; i++ {
+		status = throttler.Failure(ctx, "demo", "10.0.0.1")
+	}
+	assert.True(t, status.Locked)
+	assert.Equal(t, time.Minute, status.RetryAfter)
+
+	*now = now.Add(30 * time.Second)
+	status = throttler.Check(ctx, "demo", "10.0.0.9")
+	assert.True(t, status.Locked)
+	assert.Equal(t, 30*time.Second, status.RetryAfter)
+
+	*now = now.Add(31 * time.Second)
+	assert.Zero(t, throttler.Check(ctx, "demo", "10.0.0.1").RetryAfter)
+	assert.Contains(t, auditor.actions(), audit.ActionLocked)
+	assert.Equal(t, audit.ActionUnlocked, auditor.actions()[len(auditor.events)-1])
+}
+
+func TestLoginThrottler_SuccessAndManualUnlock(t *testing.T) {
+	throttler, auditor, _ := newTestThrottler()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		throttler.Failure(ctx, "demo", "10.0.0.1")
+	}
+	throttler.Success(ctx, "Demo")
+	assert.Zero(t, throttler.Check(ctx, "demo", "10.0.0.2").RetryAfter)
+	assert.NotZero(t, throttler.Check(ctx, "other", "10.0.0.1").RetryAfter, "ip counter survives a successful sign-in")
+
+	assert.False(t, throttler.Unlock(ctx, "nobody", "admin"))
+	for i := 0; i < 6; i++ {
+		throttler.Failure(ctx, "alice", "10.0.0.3")
+	}
+	assert.True(t, throttler.Unlock(ctx, "alice", "admin"))
+	assert.Equal(t, audit.ActionUnlocked, auditor.events[len(auditor.events)-1].Action)
+	assert.Equal(t, "admin", auditor.events[len(auditor.events)-1].Actor)
+	assert.Zero(t, throttler.Check(ctx, "alice", "10.0.0.4").RetryAfter)
+	assert.True(t, throttler.Check(ctx, "alice", "10.0.0.3").Locked, "the ip stays locked")
+}
+
+func TestLoginThrottler_UnlockKeepsFailuresOfUnlockedUser(t *testing.T) {
+	throttler, auditor, _ := newTestThrottler()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		throttler.Failure(ctx, "bob", "10.0.0.1")
+	}
+	events := len(auditor.events)
+	assert.False(t, throttler.Unlock(ctx, "bob", "admin"))
+	assert.Len(t, auditor.events, events, "nothing was unlocked")
+	assert.Equal(t, time.Second, throttler.Check(ctx, "bob", "10.0.0.2").RetryAfter, "the backoff still applies")
+}
@@ -1,15 +1,99 @@
 package config
 
 import (
-	"github.com/spf13/viper"
+	"fmt"
 )
 
 type Config struct {
 	Production bool
-	Server     ServerConf
-	Database   DBConf
-	JWT        JWTConf
-	Kafka      KafkaConfig
+	// Features are the feature flags, read through Watcher.Current so changes
+	// apply without a restart
+	Features  map[string]bool
+	Log       LogConf
+	AccessLog AccessLogConf `mapstructure:"access_log"`
+	Metrics   MetricsConf
+	Tracing   TracingConf
+	Health    HealthConf
+	Admin     AdminConf
+	Server    ServerConf
+	Database  DBConf
+	JWT       JWTConf
+	Login     LoginConf
+	Kafka     KafkaConfig
+	Events    EventsConf
+}
+
+// LogConf configures the application logger
+type LogConf struct {
+	// Level is "debug", "info", "warn" or "error"
+	Level string
+	// Format is "text" or "json"
+	Format string
+}
+
+// AccessLogConf configures the HTTP access log
+type AccessLogConf struct {
+	Enabled bool
+	// Format is "json", "common" or "combined"
+	Format string
+	// Output is "stdout", "stderr" or a file path
+	Output string
+	// SampleRate is the share of requests logged, from 0 to 1. Nil, left
+	// unset, logs every request. Failed and slow requests are always logged.
+	SampleRate *float64 `mapstructure:"sample_rate"`
+	// SlowThresholdMs flags the requests taking longer than this
+	SlowThresholdMs int      `mapstructure:"slow_threshold_ms"`
+	ExcludePaths    []string `mapstructure:"exclude_paths"`
+	// LogHeaders and LogBody add the request headers and JSON body to json records
+	LogHeaders bool `mapstructure:"log_headers"`
+	LogBody    bool `mapstructure:"log_body"`
+	// RedactFields are the body fields masked on top of password
+	RedactFields []string `mapstructure:"redact_fields"`
+}
+
+// MetricsConf configures the Prometheus metrics endpoint
+type MetricsConf struct {
+	Enabled bool
+	Path    string
+	// Port serves the metrics on their own listener, 0 serves them on the API
+	// port behind the admin authentication
+	Port int
+	Host string
+}
+
+// TracingConf configures OpenTelemetry tracing
+type TracingConf struct {
+	// Exporter is "otlp", "stdout" or "none"
+	Exporter string
+	// Endpoint is the host:port of the OTLP/HTTP collector
+	Endpoint string
+	Insecure bool
+	Headers  map[string]string `redact:"true"`
+	// SampleRatio is the share of new traces recorded, from 0 to 1. Requests
+	// carrying a traceparent follow the sampling decision of the caller.
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+	ServiceName string  `mapstructure:"service_name"`
+}
+
+// HealthConf configures the dependency checks of /healthz and /readyz
+type HealthConf struct {
+	// CacheTTLMs is how long check results are reused before the checks run again
+	CacheTTLMs     int `mapstructure:"cache_ttl_ms"`
+	CheckTimeoutMs int `mapstructure:"check_timeout_ms"`
+	// ShutdownDelay is how long, in seconds, the app reports not ready before
+	// the server stops
+	ShutdownDelay int `mapstructure:"shutdown_delay"`
+}
+
+// AdminConf configures the admin server, serving pprof, runtime stats, the
+// log level and the effective config on its own port
+type AdminConf struct {
+	Enabled bool
+	Host    string
+	Port    int
+	// Username and Password protect the admin server with basic auth
+	Username string
+	Password string `redact:"true"`
 }
 
 type ServerConf struct {
@@ -17,42 +101,229 @@ type ServerConf struct {
 	Port    int
 	Host    string
 	SSL     SSLConf
+	CORS    CORSConf
+	// TrustedProxies are the addresses or CIDRs of the proxies whose
+	// X-Forwarded-For header is believed. Empty trusts none, the client IP is
+	// then always the address of the connection.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// CORSConf lists the origins browsers may call the API from
+type CORSConf struct {
+	// AllowedOrigins are origins such as https://app.example.com, or * for
+	// any. Empty disables CORS.
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
 }
 
 type SSLConf struct {
 	Enabled  bool
-	CertFile string
-	KeyFile  string
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ReloadInterval is how often, in seconds, the certificate files are checked for changes
+	ReloadInterval int            `mapstructure:"reload_interval"`
+	ClientAuth     ClientAuthConf `mapstructure:"client_auth"`
+}
+
+// ClientAuthConf configures mutual TLS
+type ClientAuthConf struct {
+	Enabled bool
+	// Required rejects connections without a valid client certificate. Otherwise a
+	// certificate is only verified when one is presented, so bearer tokens keep working.
+	Required bool
+	CAFile   string `mapstructure:"ca_file"`
+	// Identities maps client certificates to caller identities, first match wins
+	Identities []CertIdentityConf
+}
+
+// CertIdentityConf maps a client certificate, matched by subject common name or
+// by a DNS, URI or email SAN, to an identity
+type CertIdentityConf struct {
+	CommonName string `mapstructure:"common_name"`
+	DNSName    string `mapstructure:"dns_name"`
+	URI        string
+	Email      string
+
+	// Subject defaults to the certificate's common name
+	Subject  string
+	Roles    []string
+	Groups   []string
+	TenantID string `mapstructure:"tenant_id"`
+	// Scopes restricts the identity, leave empty for unrestricted access
+	Scopes []string
 }
 
 type DBConf struct {
 	Port int
 	Host string
 	User string
-	Pass string
+	Pass string `redact:"true"`
 	Name string
+	// MigrationsPath is the directory of the migrations applied at startup
+	MigrationsPath string `mapstructure:"migrations_path"`
+	// SlowQueryMs is the duration above which statements are logged as slow
+	SlowQueryMs int `mapstructure:"slow_query_ms"`
+	// QueryStatsSize bounds the number of statements statistics are kept for
+	QueryStatsSize int `mapstructure:"query_stats_size"`
+}
+
+// DefaultMigrationsPath is used when database.migrations_path is empty
+const DefaultMigrationsPath = "./migrations"
+
+// DSN is the postgres connection string of the database
+func (c DBConf) DSN() string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", c.User, c.Pass, c.Host, c.Port, c.Name)
 }
 
 type JWTConf struct {
-	Secret string
+	Secret string `redact:"true"`
+	// AdminUsers are the usernames granted the admin role when they sign in
+	AdminUsers []string `mapstructure:"admin_users"`
+}
+
+// LoginConf holds the brute-force protection thresholds for /auth/signin.
+// Durations are in seconds.
+type LoginConf struct {
+	// FreeAttempts is the number of failures tolerated before backoff starts
+	FreeAttempts int `mapstructure:"free_attempts"`
+	// BackoffBase is the first backoff delay, doubled on every further failure
+	BackoffBase int `mapstructure:"backoff_base"`
+	BackoffMax  int `mapstructure:"backoff_max"`
+	// LockoutThreshold is the number of failures that locks the username or ip
+	LockoutThreshold int `mapstructure:"lockout_threshold"`
+	LockoutDuration  int `mapstructure:"lockout_duration"`
+	// FailureWindow resets the counters after this long without a failure
+	FailureWindow int `mapstructure:"failure_window"`
+}
+
+// EventsConf describes the events this service publishes and where they go
+type EventsConf struct {
+	// Driver names the backend events are published to: kafka, file, stdout,
+	// http, channel or noop. Several comma separated names fan out to all of them.
+	Driver string
+	File   FileSinkConf
+	HTTP   HTTPSinkConf
+	// ChannelBuffer is the buffer of every subscriber of the in-process channel broker
+	ChannelBuffer int `mapstructure:"channel_buffer"`
+
+	// Source is the CloudEvents source attribute of every event
+	Source string
+	// SchemaBaseURL is where the JSON Schemas referenced by dataschema are published
+	SchemaBaseURL string `mapstructure:"schema_base_url"`
+	// SyncDelivery makes company changes wait until their event is delivered
+	SyncDelivery bool `mapstructure:"sync_delivery"`
+	// UpdatePayload is "full" to publish the before and after states of an
+	// updated company, or "changes" for only the changed fields
+	UpdatePayload string `mapstructure:"update_payload"`
+	// Format is how the kafka backend serializes event data: "json" or "avro".
+	// Avro schemas are registered with SchemaRegistry.
+	Format         string
+	SchemaRegistry SchemaRegistryConf `mapstructure:"schema_registry"`
+}
+
+// SchemaRegistryConf points to a Confluent compatible schema registry
+type SchemaRegistryConf struct {
+	URL       string
+	Username  string
+	Password  string `redact:"true"`
+	TimeoutMs int    `mapstructure:"timeout_ms"`
+}
+
+// FileSinkConf configures the NDJSON file backend
+type FileSinkConf struct {
+	Path string
+	// MaxSizeMB rotates the file once it grows past this size
+	MaxSizeMB int `mapstructure:"max_size_mb"`
+	// MaxBackups is the number of rotated files kept next to the active one
+	MaxBackups int `mapstructure:"max_backups"`
+}
+
+// HTTPSinkConf configures the HTTP POST backend
+type HTTPSinkConf struct {
+	URL       string
+	TimeoutMs int               `mapstructure:"timeout_ms"`
+	Headers   map[string]string `redact:"true"`
+	QueueSize int               `mapstructure:"queue_size"`
 }
 
 type KafkaConfig struct {
 	Brokers []string
 	Topic   string
+
+	// QueueSize bounds the number of events waiting to be written
+	QueueSize int `mapstructure:"queue_size"`
+	// Workers is the number of goroutines writing to Kafka
+	Workers int
+	// BatchSize is the maximum number of events written in one request
+	BatchSize int `mapstructure:"batch_size"`
+	// QueueFullPolicy is either "block", waiting up to EnqueueTimeoutMs for room, or "drop"
+	QueueFullPolicy  string `mapstructure:"queue_full_policy"`
+	EnqueueTimeoutMs int    `mapstructure:"enqueue_timeout_ms"`
+	// MaxRetries is the number of retries after a failed write, with exponential backoff and jitter
+	MaxRetries        int `mapstructure:"max_retries"`
+	RetryBackoffMs    int `mapstructure:"retry_backoff_ms"`
+	RetryBackoffMaxMs int `mapstructure:"retry_backoff_max_ms"`
+	// DeadLetterDir is where events that failed all retries are spooled
+	DeadLetterDir string `mapstructure:"dead_letter_dir"`
+	// SequenceKeys bounds the number of companies whose event sequence is
+	// remembered, the sequence of the least recently active one restarts at 1
+	SequenceKeys int `mapstructure:"sequence_keys"`
+
+	// ClientID identifies the service to the brokers
+	ClientID string `mapstructure:"client_id"`
+	// RequiredAcks is "all", "one" or "none"
+	RequiredAcks string `mapstructure:"required_acks"`
+	// Compression is "none", "gzip", "snappy", "lz4" or "zstd"
+	Compression string
+	// LingerMs is how long a batch may wait to fill up before it is sent
+	LingerMs       int `mapstructure:"linger_ms"`
+	DialTimeoutMs  int `mapstructure:"dial_timeout_ms"`
+	WriteTimeoutMs int `mapstructure:"write_timeout_ms"`
+	TLS            KafkaTLSConf
+	SASL           KafkaSASLConf
+
+	// Commands configures the consumer of inbound company commands
+	Commands CommandsConf
 }
 
-func LoadConfig(configFile string) (*Config, error) {
-	viper.SetConfigFile(configFile)
+// CommandsConf configures the consumer applying company commands published by
+// partner systems. Commands run as Identity, within its tenant.
+type CommandsConf struct {
+	Enabled bool
+	Topic   string
+	GroupID string `mapstructure:"group_id"`
+	// DeadLetterTopic receives the commands that failed, with the error in a
+	// header. It is required, a failed command is never committed otherwise.
+	DeadLetterTopic string `mapstructure:"dead_letter_topic"`
+	// ReplyTopic receives the result of every command, keyed by its correlation ID
+	ReplyTopic string `mapstructure:"reply_topic"`
+	// MaxRetries is the number of retries of a command failing with a transient error
+	MaxRetries     int `mapstructure:"max_retries"`
+	RetryBackoffMs int `mapstructure:"retry_backoff_ms"`
+	Identity       CommandIdentityConf
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, err
-	}
+// CommandIdentityConf is the identity inbound commands run as
+type CommandIdentityConf struct {
+	Subject  string
+	Roles    []string
+	Groups   []string
+	TenantID string `mapstructure:"tenant_id"`
+}
 
-	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
-		return nil, err
-	}
+type KafkaTLSConf struct {
+	Enabled bool
+	// CAFile verifies the brokers, the system roots are used when empty
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile and KeyFile authenticate the client, leave empty without mutual TLS
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
 
-	return &config, nil
+type KafkaSASLConf struct {
+	// Mechanism is "plain", "scram-sha-256" or "scram-sha-512", empty disables SASL
+	Mechanism string
+	Username  string
+	Password  string `redact:"true"`
 }
@@ -0,0 +1,144 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const baseConfig = `
+production: false
+server:
+  port: 8080
+database:
+  host: 127.0.0.1
+  port: 5432
+  user: xmgo
+  pass: xmgopass
+  name: xmgo_db
+jwt:
+  secret: secret-key
+tracing:
+  headers: {}
+kafka:
+  brokers: [localhost:9092]
+`
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfig_ProfileEnvAndSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.yaml", baseConfig)
+	writeFile(t, dir, "config.prod.yaml", "production: true\njwt:\n  secret: \"\"\ndatabase:\n  host: db\n")
+	secret := writeFile(t, dir, "jwt_secret", "0123456789abcdef0123456789abcdef\n")
+
+	t.Setenv(config.ProfileEnv, "prod")
+	t.Setenv("XMGO_JWT_SECRET_FILE", secret)
+	t.Setenv("XMGO_DATABASE_PASS", "correct-horse-battery")
+	t.Setenv("XMGO_ACCESS_LOG_SAMPLE_RATE", "0.5")
+	t.Setenv("XMGO_KAFKA_BROKERS", "kafka-1:9092,kafka-2:9092")
+	t.Setenv("XMGO_TRACING_HEADERS", "api-key=abc, tenant=t1")
+
+	cfg, err := config.LoadConfig(file)
+	require.NoError(t, err)
+	assert.True(t, cfg.Production)
+	assert.Equal(t, "db", cfg.Database.Host)
+	assert.Equal(t, "xmgo", cfg.Database.User)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", cfg.JWT.Secret)
+	assert.Equal(t, "correct-horse-battery", cfg.Database.Pass)
+	require.NotNil(t, cfg.AccessLog.SampleRate)
+	assert.Equal(t, 0.5, *cfg.AccessLog.SampleRate)
+	assert.Equal(t, []string{"kafka-1:9092", "kafka-2:9092"}, cfg.Kafka.Brokers)
+	assert.Equal(t, map[string]string{"api-key": "abc", "tenant": "t1"}, cfg.Tracing.Headers)
+}
+
+func TestLoadConfig_UnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.yaml", baseConfig+"databse:\n  host: x\nlog:\n  levle: debug\n")
+
+	_, err := config.LoadConfig(file)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "databse.host")
+	assert.Contains(t, err.Error(), "log.levle")
+}
+
+func TestLoadConfig_MissingSecretFile(t *testing.T) {
+	file := writeFile(t, t.TempDir(), "config.yaml", baseConfig)
+	t.Setenv("XMGO_DATABASE_PASS_FILE", "/nonexistent/db_pass")
+
+	_, err := config.LoadConfig(file)
+	assert.ErrorContains(t, err, "database.pass_file")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := func() config.Config {
+		return config.Config{
+			Server:   config.ServerConf{Port: 8080},
+			Database: config.DBConf{Host: "db", Port: 5432, User: "xmgo", Name: "xmgo_db", Pass: "xmgopass"},
+			JWT:      config.JWTConf{Secret: "secret-key"},
+		}
+	}
+
+	cfg := valid()
+	assert.NoError(t, cfg.Validate())
+
+	cfg = valid()
+	cfg.Server.Port = 70000
+	cfg.Database.Host = ""
+	cfg.Admin = config.AdminConf{Enabled: true, Port: 9090, Username: "admin"}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.port must be between 1 and 65535, got 70000")
+	assert.Contains(t, err.Error(), "database.host is required")
+	assert.Contains(t, err.Error(), "admin.password is required")
+
+	// The metrics can't share the API listener without authentication
+	cfg = valid()
+	cfg.Metrics = config.MetricsConf{Enabled: true, Port: 8080}
+	assert.ErrorContains(t, cfg.Validate(), "metrics.port can't be server.port")
+	cfg.Metrics.Port = 0
+	assert.NoError(t, cfg.Validate())
+
+	cfg = valid()
+	cfg.Events.UpdatePayload = "diff"
+	assert.ErrorContains(t, cfg.Validate(), `events.update_payload must be full or changes, got "diff"`)
+	cfg.Events.UpdatePayload = "changes"
+	assert.NoError(t, cfg.Validate())
+
+	// The sample rate is used as is, never coerced into range
+	cfg = valid()
+	rate := 1.5
+	cfg.AccessLog = config.AccessLogConf{Enabled: true, SampleRate: &rate}
+	assert.ErrorContains(t, cfg.Validate(), "access_log.sample_rate must be between 0 and 1, got 1.5")
+	rate = -0.1
+	assert.ErrorContains(t, cfg.Validate(), "access_log.sample_rate must be between 0 and 1, got -0.1")
+	rate = 0
+	assert.NoError(t, cfg.Validate())
+	cfg.AccessLog.SampleRate = nil
+	assert.NoError(t, cfg.Validate())
+
+	// Development defaults are rejected in production
+	cfg = valid()
+	cfg.Production = true
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "jwt.secret is a well-known default")
+	assert.Contains(t, err.Error(), "database.pass is a well-known default")
+
+	cfg.JWT.Secret = "too-short-for-hs256"
+	cfg.Database.Pass = "s3cr3t-db-password"
+	assert.ErrorContains(t, cfg.Validate(), "jwt.secret must be at least 32 characters")
+
+	cfg.JWT.Secret = "a-random-secret-of-32-characters"
+	assert.NoError(t, cfg.Validate())
+	cfg.JWT.AdminUsers = []string{"demo"}
+	assert.ErrorContains(t, cfg.Validate(), "jwt.admin_users can't grant admin to the demo user")
+}
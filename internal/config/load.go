@@ -0,0 +1,197 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix prefixes the environment variables overriding the config file,
+// XMGO_DATABASE_PASS overrides database.pass
+const EnvPrefix = "XMGO"
+
+// ProfileEnv names the profile layered over the base config file
+const ProfileEnv = EnvPrefix + "_PROFILE"
+
+// fileSuffix marks the keys naming a file holding the value of a secret,
+// database.pass_file or XMGO_DATABASE_PASS_FILE
+const fileSuffix = "_file"
+
+// LoadConfig reads configFile, then the file of the profile named by
+// XMGO_PROFILE next to it, config.prod.yaml for the prod profile. Any key can
+// be overridden by an XMGO_ environment variable, and secrets can be read from
+// the file named by their _file key. Unknown keys and invalid values are
+// rejected.
+func LoadConfig(configFile string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigFile(configFile)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	if profile := os.Getenv(ProfileEnv); profile != "" {
+		v.SetConfigFile(ProfileFile(configFile, profile))
+		if err := v.MergeInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to load the %s profile: %w", profile, err)
+		}
+	}
+
+	keys := configKeys(reflect.TypeOf(Config{}), "")
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	for _, k := range keys {
+		if k.list {
+			continue
+		}
+		if err := v.BindEnv(k.name); err != nil {
+			return nil, err
+		}
+		if k.secret {
+			if err := v.BindEnv(k.name + fileSuffix); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := checkUnknownKeys(v, keys); err != nil {
+		return nil, err
+	}
+	if err := readSecretFiles(v, keys); err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := v.Unmarshal(&config, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		stringToMapHook,
+	))); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", configFile, err)
+	}
+	return &config, nil
+}
+
+// ProfileFile returns the file of profile next to configFile
+func ProfileFile(configFile, profile string) string {
+	ext := filepath.Ext(configFile)
+	return strings.TrimSuffix(configFile, ext) + "." + profile + ext
+}
+
+// configKey is a key of the config file
+type configKey struct {
+	name string
+	// secret keys, tagged redact:"true", can be read from a file
+	secret bool
+	// open keys, maps and lists of structs, hold keys of their own
+	open bool
+	// lists of structs can't be set from the environment
+	list bool
+}
+
+// configKeys lists the keys of the fields of t, named like the config file
+func configKeys(t reflect.Type, prefix string) []configKey {
+	var keys []configKey
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Tag.Get("mapstructure")
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		name = prefix + name
+
+		switch {
+		case f.Type.Kind() == reflect.Struct:
+			keys = append(keys, configKeys(f.Type, name+".")...)
+		case f.Type.Kind() == reflect.Map:
+			keys = append(keys, configKey{name: name, open: true})
+		case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct:
+			keys = append(keys, configKey{name: name, open: true, list: true})
+		default:
+			keys = append(keys, configKey{name: name, secret: f.Tag.Get("redact") == "true" && f.Type.Kind() == reflect.String})
+		}
+	}
+	return keys
+}
+
+// checkUnknownKeys rejects the keys matching no field, mostly typos that
+// would otherwise silently leave the default in place
+func checkUnknownKeys(v *viper.Viper, keys []configKey) error {
+	known := make(map[string]bool, len(keys))
+	var open []string
+	for _, k := range keys {
+		known[k.name] = true
+		if k.secret {
+			known[k.name+fileSuffix] = true
+		}
+		if k.open {
+			open = append(open, k.name+".")
+		}
+	}
+
+	var unknown []string
+	for _, key := range v.AllKeys() {
+		if known[key] || slices.ContainsFunc(open, func(prefix string) bool { return strings.HasPrefix(key, prefix) }) {
+			continue
+		}
+		unknown = append(unknown, key)
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		return fmt.Errorf("unknown config keys: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// readSecretFiles replaces the secrets whose _file key is set with the
+// content of that file, so they can come from Docker or Kubernetes secrets
+func readSecretFiles(v *viper.Viper, keys []configKey) error {
+	var errs []error
+	for _, k := range keys {
+		if !k.secret {
+			continue
+		}
+		path := v.GetString(k.name + fileSuffix)
+		if path == "" {
+			continue
+		}
+		secret, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read %s%s: %w", k.name, fileSuffix, err))
+			continue
+		}
+		v.Set(k.name, strings.TrimRight(string(secret), "\r\n"))
+	}
+	return errors.Join(errs...)
+}
+
+// stringToMapHook decodes maps set from the environment, written as
+// key=value pairs separated by commas
+func stringToMapHook(from, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || to.Kind() != reflect.Map {
+		return data, nil
+	}
+	out := map[string]string{}
+	for _, pair := range strings.Split(data.(string), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid map entry %q, expected key=value", pair)
+		}
+		out[strings.TrimSpace(k)] = strings.TrimSpace(val)
+	}
+	return out, nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// RedactedValue replaces the value of the fields tagged redact:"true"
+const RedactedValue = "[REDACTED]"
+
+// Redacted returns cfg as a map keyed like the config file, with the secrets,
+// the fields tagged redact:"true", masked. Empty secrets are left empty so a
+// missing one stays visible.
+func Redacted(cfg *Config) map[string]any {
+	return redactStruct(reflect.ValueOf(cfg).Elem())
+}
+
+func redactStruct(v reflect.Value) map[string]any {
+	out := make(map[string]any, v.NumField())
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Tag.Get("mapstructure")
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		fv := v.Field(i)
+		if f.Tag.Get("redact") == "true" && !fv.IsZero() {
+			out[name] = RedactedValue
+			continue
+		}
+		out[name] = redactValue(fv)
+	}
+	return out
+}
+
+func redactValue(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Struct:
+		return redactStruct(v)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return v.Interface()
+		}
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = redactStruct(v.Index(i))
+		}
+		return items
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// MinProductionSecretLength is the minimum length of jwt.secret in production
+	MinProductionSecretLength = 32
+	// MinProductionPasswordLength is the minimum length of the passwords in production
+	MinProductionPasswordLength = 12
+)
+
+// weakSecrets are defaults and placeholders that must never reach production
+var weakSecrets = []string{"secret", "secret-key", "password", "changeme", "change-me", "admin", "xmgopass"}
+
+// Validate reports every missing required value, out of range port and, in
+// production, weak secret at once
+func (c *Config) Validate() error {
+	var errs []error
+	required := func(key, value string) {
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", key))
+		}
+	}
+	port := func(key string, port int, zeroAllowed bool) {
+		if (port == 0 && zeroAllowed) || (port > 0 && port <= 65535) {
+			return
+		}
+		errs = append(errs, fmt.Errorf("%s must be between 1 and 65535, got %d", key, port))
+	}
+	strong := func(key, secret string, minLength int) {
+		switch {
+		case secret == "":
+			errs = append(errs, fmt.Errorf("%s is required in production", key))
+		case slices.Contains(weakSecrets, strings.ToLower(secret)):
+			errs = append(errs, fmt.Errorf("%s is a well-known default, set a random one in production", key))
+		case len(secret) < minLength:
+			errs = append(errs, fmt.Errorf("%s must be at least %d characters in production", key, minLength))
+		}
+	}
+
+	port("server.port", c.Server.Port, false)
+	if c.Server.SSL.Enabled {
+		required("server.ssl.cert_file", c.Server.SSL.CertFile)
+		required("server.ssl.key_file", c.Server.SSL.KeyFile)
+		if c.Server.SSL.ClientAuth.Enabled {
+			required("server.ssl.client_auth.ca_file", c.Server.SSL.ClientAuth.CAFile)
+		}
+	}
+
+	required("database.host", c.Database.Host)
+	required("database.user", c.Database.User)
+	required("database.name", c.Database.Name)
+	port("database.port", c.Database.Port, false)
+
+	if !c.Production {
+		required("jwt.secret", c.JWT.Secret)
+	}
+
+	if !slices.Contains([]string{"", "full", "changes"}, c.Events.UpdatePayload) {
+		errs = append(errs, fmt.Errorf("events.update_payload must be full or changes, got %q", c.Events.UpdatePayload))
+	}
+	if rate := c.AccessLog.SampleRate; c.AccessLog.Enabled && rate != nil && (*rate < 0 || *rate > 1) {
+		errs = append(errs, fmt.Errorf("access_log.sample_rate must be between 0 and 1, got %v", *rate))
+	}
+	if c.Metrics.Enabled {
+		port("metrics.port", c.Metrics.Port, true)
+		// the metrics would be public next to the API
+		if c.Metrics.Port == c.Server.Port {
+			errs = append(errs, errors.New("metrics.port can't be server.port, set 0 to serve the metrics on the API port to admins"))
+		}
+	}
+	if c.Admin.Enabled {
+		port("admin.port", c.Admin.Port, false)
+		required("admin.username", c.Admin.Username)
+		if !c.Production {
+			required("admin.password", c.Admin.Password)
+		}
+	}
+	if c.Kafka.SASL.Mechanism != "" {
+		required("kafka.sasl.username", c.Kafka.SASL.Username)
+		if !c.Production {
+			required("kafka.sasl.password", c.Kafka.SASL.Password)
+		}
+	}
+
+	if c.Production {
+		strong("jwt.secret", c.JWT.Secret, MinProductionSecretLength)
+		strong("database.pass", c.Database.Pass, MinProductionPasswordLength)
+		if c.Admin.Enabled {
+			strong("admin.password", c.Admin.Password, MinProductionPasswordLength)
+		}
+		if c.Kafka.SASL.Mechanism != "" {
+			strong("kafka.sasl.password", c.Kafka.SASL.Password, MinProductionPasswordLength)
+		}
+		// anyone can sign in as demo/demo
+		if slices.Contains(c.JWT.AdminUsers, "demo") {
+			errs = append(errs, errors.New("jwt.admin_users can't grant admin to the demo user in production"))
+		}
+	}
+	return errors.Join(errs...)
+}
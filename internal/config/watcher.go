@@ -0,0 +1,182 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/spf13/viper"
+)
+
+// LiveKeys are the settings applied without a restart, a trailing dot covers
+// every key of a section. Changes to other keys are logged as needing a restart.
+var LiveKeys = []string{
+	"log.level",
+	"login.",
+	"server.cors.allowed_origins",
+	"features",
+	"kafka.topic",
+	"server.ssl.cert_file",
+	"server.ssl.key_file",
+	"server.ssl.client_auth.ca_file",
+}
+
+// Subscriber is called with the previous and the new config after every
+// reload that changed something
+type Subscriber func(old, cfg *Config)
+
+// Watcher reloads the config when its files change and hands the new config
+// to the subscribers. A config that fails to load or validate is logged and
+// the current one kept.
+type Watcher struct {
+	configFile string
+	log        logger.LoggerInterface
+
+	// reloading serializes reloads, so the subscribers see the changes one
+	// at a time and in order
+	reloading   sync.Mutex
+	mu          sync.RWMutex
+	current     *Config
+	subscribers []Subscriber
+}
+
+// NewWatcher watches configFile, and the file of the profile in use, starting
+// from cfg, the config loaded from them at startup
+func NewWatcher(configFile string, cfg *Config, log logger.LoggerInterface) *Watcher {
+	return &Watcher{configFile: configFile, current: cfg, log: log}
+}
+
+// Current returns the latest valid config
+func (w *Watcher) Current() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// Subscribe registers fn to be called after every reload. Subscribers check
+// the keys they own and apply the new values.
+func (w *Watcher) Subscribe(fn Subscriber) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Run watches the files until ctx is done. viper's watchers can't be stopped,
+// changes seen after ctx is done are ignored.
+func (w *Watcher) Run(ctx context.Context) error {
+	files := []string{w.configFile}
+	if profile := os.Getenv(ProfileEnv); profile != "" {
+		files = append(files, ProfileFile(w.configFile, profile))
+	}
+	for _, file := range files {
+		v := viper.New()
+		v.SetConfigFile(file)
+		v.OnConfigChange(func(fsnotify.Event) {
+			if ctx.Err() == nil {
+				w.Reload()
+			}
+		})
+		v.WatchConfig()
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// Reload loads the config files again, and notifies the subscribers when
+// anything changed. Concurrent reloads, e.g. of the base and the profile
+// file, run one after the other.
+func (w *Watcher) Reload() {
+	w.reloading.Lock()
+	defer w.reloading.Unlock()
+
+	cfg, err := LoadConfig(w.configFile)
+	if err != nil {
+		w.log.Error("Failed to reload the config, keeping the current one", "file", w.configFile, "error", err)
+		return
+	}
+
+	w.mu.Lock()
+	old := w.current
+	changed := ChangedKeys(old, cfg)
+	if len(changed) == 0 {
+		w.mu.Unlock()
+		return
+	}
+	w.current = cfg
+	subscribers := slices.Clone(w.subscribers)
+	w.mu.Unlock()
+
+	var live, restart []string
+	for _, key := range changed {
+		if IsLiveKey(key) {
+			live = append(live, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+	if len(live) > 0 {
+		w.log.Info("Config reloaded", "keys", live)
+	}
+	if len(restart) > 0 {
+		w.log.Warn("Config changes need a restart to apply", "keys", restart)
+	}
+	for _, fn := range subscribers {
+		fn(old, cfg)
+	}
+}
+
+// IsLiveKey tells whether a change to key applies without a restart
+func IsLiveKey(key string) bool {
+	return slices.ContainsFunc(LiveKeys, func(live string) bool {
+		if strings.HasSuffix(live, ".") {
+			return strings.HasPrefix(key, live)
+		}
+		return key == live
+	})
+}
+
+// ChangedKeys lists the keys whose value differs between two configs, maps
+// and lists are compared as a whole
+func ChangedKeys(old, cfg *Config) []string {
+	before, after := map[string]any{}, map[string]any{}
+	flatten(reflect.ValueOf(old).Elem(), "", before)
+	flatten(reflect.ValueOf(cfg).Elem(), "", after)
+
+	var changed []string
+	for key, value := range after {
+		if !reflect.DeepEqual(before[key], value) {
+			changed = append(changed, key)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+func flatten(v reflect.Value, prefix string, out map[string]any) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Tag.Get("mapstructure")
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if f.Type.Kind() == reflect.Struct {
+			flatten(v.Field(i), prefix+name+".", out)
+			continue
+		}
+		out[prefix+name] = v.Field(i).Interface()
+	}
+}
+
+// FeatureEnabled tells whether the feature flag name is on
+func (c *Config) FeatureEnabled(name string) bool {
+	return c.Features[strings.ToLower(name)]
+}
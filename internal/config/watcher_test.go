@@ -0,0 +1,121 @@
+package config_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher_Reload(t *testing.T) {
+	file := writeFile(t, t.TempDir(), "config.yaml", baseConfig+"log:\n  level: info\n")
+	cfg, err := config.LoadConfig(file)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	log, err := logger.New(logger.Options{Format: logger.FormatJSON, Output: &buf})
+	require.NoError(t, err)
+	w := config.NewWatcher(file, cfg, log)
+
+	var calls int
+	var levels []string
+	w.Subscribe(func(old, cfg *config.Config) {
+		calls++
+		levels = append(levels, old.Log.Level, cfg.Log.Level)
+	})
+
+	// Nothing changed
+	w.Reload()
+	assert.Zero(t, calls)
+
+	require.NoError(t, os.WriteFile(file, []byte(strings.Replace(baseConfig, "port: 8080", "port: 8081", 1)+"log:\n  level: debug\n"), 0o600))
+	w.Reload()
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []string{"info", "debug"}, levels)
+	assert.Equal(t, "debug", w.Current().Log.Level)
+	assert.Contains(t, buf.String(), `"msg":"Config reloaded","keys":["log.level"]`)
+	assert.Contains(t, buf.String(), `"msg":"Config changes need a restart to apply","keys":["server.port"]`)
+
+	// An invalid config is not applied
+	buf.Reset()
+	require.NoError(t, os.WriteFile(file, []byte(baseConfig+"log:\n  levle: warn\n"), 0o600))
+	w.Reload()
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "debug", w.Current().Log.Level)
+	assert.Contains(t, buf.String(), "Failed to reload the config")
+}
+
+func TestWatcher_RunWatchesTheFile(t *testing.T) {
+	file := writeFile(t, t.TempDir(), "config.yaml", baseConfig+"features:\n  new_search: false\n")
+	cfg, err := config.LoadConfig(file)
+	require.NoError(t, err)
+	assert.False(t, cfg.FeatureEnabled("new_search"))
+
+	w := config.NewWatcher(file, cfg, logger.Discard())
+	var enabled atomic.Bool
+	w.Subscribe(func(_, cfg *config.Config) { enabled.Store(cfg.FeatureEnabled("New_Search")) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = w.Run(ctx) }()
+
+	// Give the watcher time to start before changing the file
+	require.Eventually(t, func() bool {
+		_ = os.WriteFile(file, []byte(baseConfig+"features:\n  new_search: true\n"), 0o600)
+		return enabled.Load()
+	}, 5*time.Second, 100*time.Millisecond)
+	assert.True(t, w.Current().FeatureEnabled("new_search"))
+}
+
+func TestWatcher_ConcurrentReloads(t *testing.T) {
+	file := writeFile(t, t.TempDir(), "config.yaml", baseConfig+"log:\n  level: info\n")
+	cfg, err := config.LoadConfig(file)
+	require.NoError(t, err)
+	w := config.NewWatcher(file, cfg, logger.Discard())
+
+	// Subscribers are never called concurrently, and each one sees the
+	// config the previous one was handed as the old one
+	var running atomic.Int32
+	var mu sync.Mutex
+	last := cfg
+	w.Subscribe(func(old, cfg *config.Config) {
+		assert.Equal(t, int32(1), running.Add(1))
+		defer running.Add(-1)
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Same(t, last, old)
+		last = cfg
+	})
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			level := []string{"debug", "warn"}[i%2]
+			_ = os.WriteFile(file, []byte(baseConfig+"log:\n  level: "+level+"\n"), 0o600)
+			w.Reload()
+		}()
+	}
+	wg.Wait()
+	assert.Same(t, last, w.Current())
+}
+
+func TestIsLiveKey(t *testing.T) {
+	assert.True(t, config.IsLiveKey("log.level"))
+	assert.True(t, config.IsLiveKey("login.backoff_max"))
+	assert.True(t, config.IsLiveKey("kafka.topic"))
+	assert.True(t, config.IsLiveKey("features"))
+	assert.False(t, config.IsLiveKey("log.format"))
+	assert.False(t, config.IsLiveKey("kafka.brokers"))
+}
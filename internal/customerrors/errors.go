@@ -93,3 +93,51 @@ func (e InvalidIDError) Error() string {
 func (e InvalidIDError) StatusCode() int {
 	return http.StatusBadRequest
 }
+
+type InvalidInputError struct {
+	Msg string
+}
+
+func (e InvalidInputError) Error() string {
+	return e.Msg
+}
+
+func (e InvalidInputError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+type UnauthorizedError struct {
+	Msg string
+}
+
+func (e UnauthorizedError) Error() string {
+	return e.Msg
+}
+
+func (e UnauthorizedError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+type ForbiddenError struct {
+	Msg string
+}
+
+func (e ForbiddenError) Error() string {
+	return e.Msg
+}
+
+func (e ForbiddenError) StatusCode() int {
+	return http.StatusForbidden
+}
+
+type EventDeliveryError struct {
+	Msg string
+}
+
+func (e EventDeliveryError) Error() string {
+	return fmt.Sprintf("change was saved but its event could not be delivered: %s", e.Msg)
+}
+
+func (e EventDeliveryError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
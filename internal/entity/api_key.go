@@ -0,0 +1,40 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey represents a credential used by machine-to-machine clients.
+// Only the SHA-256 hash of the key is stored, the prefix stays visible so
+// keys can be told apart in listings.
+type APIKey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	Name       string     `gorm:"type:varchar(100);not null" binding:"required" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"`
+	Hash       string     `gorm:"type:char(64);not null" json:"-"`
+	Scopes     []string   `gorm:"column:scopes;type:jsonb;serializer:json;not null" binding:"required" json:"scopes"`
+	AllowedIPs []string   `gorm:"column:allowed_ips;type:jsonb;serializer:json" json:"allowed_ips,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy  string     `gorm:"type:varchar(255)" json:"created_by"`
+	TenantID   string     `gorm:"type:varchar(64);not null" json:"tenant_id"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName overrides the table name used by gorm
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// IsExpired reports whether the key is past its expiry at the given time
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// IsRevoked reports whether the key has been revoked
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
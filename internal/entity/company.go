@@ -26,6 +26,8 @@ type Company struct {
 	AmountOfEmployees int         `gorm:"type:int" binding:"required" json:"amount_of_employees"`
 	Registered        bool        `gorm:"type:boolean" binding:"required" json:"registered"`
 	Type              CompanyType `gorm:"type:varchar(50);not null" binding:"required" json:"type"`
+	Owner             string      `gorm:"type:varchar(255);not null;default:''" json:"owner"`
+	TenantID          string      `gorm:"type:varchar(64);not null" json:"-"`
 	CreatedAt         time.Time   `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt         time.Time   `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -0,0 +1,61 @@
+package entity
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PrincipalType tells whether a grant is given to a single user or a group
+type PrincipalType string
+
+// Principal types
+const (
+	PrincipalUser  PrincipalType = "user"
+	PrincipalGroup PrincipalType = "group"
+)
+
+// Permission represents the access level of a grant. Write implies read.
+type Permission string
+
+// Permissions
+const (
+	PermissionRead  Permission = "read"
+	PermissionWrite Permission = "write"
+)
+
+// CompanyGrant gives a user or a group access to a single company
+type CompanyGrant struct {
+	ID            uuid.UUID     `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CompanyID     uuid.UUID     `gorm:"type:uuid;not null" json:"company_id"`
+	PrincipalType PrincipalType `gorm:"type:varchar(10);not null" binding:"required" json:"principal_type"`
+	Principal     string        `gorm:"type:varchar(255);not null" binding:"required" json:"principal"`
+	Permission    Permission    `gorm:"type:varchar(10);not null" binding:"required" json:"permission"`
+	GrantedBy     string        `gorm:"type:varchar(255)" json:"granted_by"`
+	TenantID      string        `gorm:"type:varchar(64);not null" json:"-"`
+	CreatedAt     time.Time     `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// IsValid validates the principal type
+func (pt PrincipalType) IsValid() error {
+	switch pt {
+	case PrincipalUser, PrincipalGroup:
+		return nil
+	}
+	return fmt.Errorf("invalid principal type: %s", pt)
+}
+
+// IsValid validates the permission
+func (p Permission) IsValid() error {
+	switch p {
+	case PermissionRead, PermissionWrite:
+		return nil
+	}
+	return fmt.Errorf("invalid permission: %s", p)
+}
+
+// Allows reports whether holding p is enough for the wanted permission
+func (p Permission) Allows(wanted Permission) bool {
+	return p == wanted || p == PermissionWrite
+}
@@ -0,0 +1,57 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/innoglobe/xmgo/pkg/migrations"
+	"github.com/segmentio/kafka-go"
+)
+
+// DBCheck pings the database
+func DBCheck(db *sql.DB) CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		return "", db.PingContext(ctx)
+	}
+}
+
+// MigrationCheck verifies the database is migrated to the latest version and
+// the last migration didn't fail halfway
+func MigrationCheck(db *sql.DB, latest uint) CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		version, dirty, err := migrations.Version(ctx, db)
+		if err != nil {
+			return "", err
+		}
+		detail := fmt.Sprintf("version %d", version)
+		if dirty {
+			return detail, fmt.Errorf("migration %d is dirty", version)
+		}
+		if version != latest {
+			return detail, fmt.Errorf("database is at version %d, expected %d", version, latest)
+		}
+		return detail, nil
+	}
+}
+
+// KafkaCheck connects to the brokers, it succeeds as soon as one is reachable
+func KafkaCheck(dialer *kafka.Dialer, brokers []string) CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		if len(brokers) == 0 {
+			return "", errors.New("no brokers configured")
+		}
+		var errs []error
+		for _, broker := range brokers {
+			conn, err := dialer.DialContext(ctx, "tcp", broker)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			_ = conn.Close()
+			return broker, nil
+		}
+		return "", errors.Join(errs...)
+	}
+}
@@ -0,0 +1,208 @@
+// Package health tracks the state of the dependencies of the service for the
+// liveness and readiness probes
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/config"
+)
+
+// Check statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Report statuses
+const (
+	StatusAlive        = "alive"
+	StatusReady        = "ready"
+	StatusNotReady     = "not_ready"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Defaults used when a HealthConf value is left empty
+const (
+	defaultCacheTTL     = 5 * time.Second
+	defaultCheckTimeout = 2 * time.Second
+)
+
+// CheckFunc checks a dependency. The detail, such as a version, is reported
+// along with the result.
+type CheckFunc func(ctx context.Context) (detail string, err error)
+
+// CheckResult is the outcome of the latest run of a check
+type CheckResult struct {
+	Status    string    `json:"status"`
+	LatencyMs float64   `json:"latency_ms"`
+	Detail    string    `json:"detail,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the body of the health endpoints
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Checker runs the registered checks and caches their results, so frequent
+// probes never hammer the dependencies. It is an app.Worker refreshing the
+// results in the background and reporting not ready once the app stops.
+type Checker struct {
+	ttl           time.Duration
+	timeout       time.Duration
+	shutdownDelay time.Duration
+
+	checks       map[string]CheckFunc
+	shuttingDown atomic.Bool
+
+	// refreshing is held while the checks run, mu only while the cache is
+	// read or replaced, so reading it never waits for the checks
+	refreshing sync.Mutex
+	mu         sync.RWMutex
+	cache      map[string]CheckResult
+	checkedAt  time.Time
+}
+
+func NewChecker(cfg config.HealthConf) *Checker {
+	return &Checker{
+		ttl:           millisOr(cfg.CacheTTLMs, defaultCacheTTL),
+		timeout:       millisOr(cfg.CheckTimeoutMs, defaultCheckTimeout),
+		shutdownDelay: time.Duration(cfg.ShutdownDelay) * time.Second,
+		checks:        make(map[string]CheckFunc),
+	}
+}
+
+// Register adds a check, it must be called before the checker is used
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.checks[name] = check
+}
+
+// Liveness reports the process as alive along with the latest dependency
+// results, if any. It never runs the checks: a slow or failing dependency
+// doesn't make the process worth restarting.
+func (c *Checker) Liveness() Report {
+	checks, _ := c.cached()
+	if checks == nil {
+		checks = map[string]CheckResult{}
+	}
+	return Report{Status: StatusAlive, Checks: checks}
+}
+
+// Readiness reports whether all dependencies are up and the app isn't
+// shutting down
+func (c *Checker) Readiness(ctx context.Context) (Report, bool) {
+	report := Report{Status: StatusReady, Checks: c.results(ctx)}
+	for _, res := range report.Checks {
+		if res.Status != StatusUp {
+			report.Status = StatusNotReady
+		}
+	}
+	if c.shuttingDown.Load() {
+		report.Status = StatusShuttingDown
+	}
+	return report, report.Status == StatusReady
+}
+
+// SetShuttingDown makes the app report not ready from now on
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Run refreshes the results every cache TTL until ctx is done. It then reports
+// shutting down and waits for the shutdown delay, giving load balancers the
+// time to stop routing requests before the server stops.
+func (c *Checker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.results(ctx)
+		case <-ctx.Done():
+			c.SetShuttingDown()
+			time.Sleep(c.shutdownDelay)
+			return nil
+		}
+	}
+}
+
+// results returns the cached results, running the checks again once they are
+// older than the TTL. Concurrent callers wait for the same run.
+func (c *Checker) results(ctx context.Context) map[string]CheckResult {
+	if cache, checkedAt := c.cached(); cache != nil && time.Since(checkedAt) < c.ttl {
+		return cache
+	}
+	c.refreshing.Lock()
+	defer c.refreshing.Unlock()
+	// The checks may have run while waiting
+	if cache, checkedAt := c.cached(); cache != nil && time.Since(checkedAt) < c.ttl {
+		return cache
+	}
+
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, c.checks[name])
+		}()
+	}
+	wg.Wait()
+
+	cache := make(map[string]CheckResult, len(names))
+	for i, name := range names {
+		cache[name] = results[i]
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache, c.checkedAt = cache, time.Now()
+	return cache
+}
+
+// cached returns the latest results and when they were taken. The map is
+// replaced, never changed, so it can be read without the lock.
+func (c *Checker) cached() (map[string]CheckResult, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cache, c.checkedAt
+}
+
+func (c *Checker) run(ctx context.Context, check CheckFunc) CheckResult {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	detail, err := check(ctx)
+	res := CheckResult{
+		Status:    StatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Detail:    detail,
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func millisOr(v int, def time.Duration) time.Duration {
+	if v <= 0 {
+		return def
+	}
+	return time.Duration(v) * time.Millisecond
+}
@@ -0,0 +1,125 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker_ReadinessAndCache(t *testing.T) {
+	checker := health.NewChecker(config.HealthConf{CacheTTLMs: 60000})
+	var calls atomic.Int32
+	var failing atomic.Bool
+	checker.Register("database", func(context.Context) (string, error) {
+		calls.Add(1)
+		if failing.Load() {
+			return "", errors.New("connection refused")
+		}
+		return "", nil
+	})
+	checker.Register("migrations", func(context.Context) (string, error) {
+		return "version 4", nil
+	})
+
+	report, ready := checker.Readiness(context.Background())
+	assert.True(t, ready)
+	assert.Equal(t, health.StatusReady, report.Status)
+	assert.Equal(t, health.StatusUp, report.Checks["database"].Status)
+	assert.Equal(t, "version 4", report.Checks["migrations"].Detail)
+
+	// Within the TTL the cached results are served
+	failing.Store(true)
+	_, ready = checker.Readiness(context.Background())
+	assert.True(t, ready)
+	checker.Liveness()
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestChecker_FailingDependency(t *testing.T) {
+	checker := health.NewChecker(config.HealthConf{})
+	checker.Register("kafka", func(context.Context) (string, error) {
+		return "", errors.New("no brokers reachable")
+	})
+
+	report, ready := checker.Readiness(context.Background())
+	assert.False(t, ready)
+	assert.Equal(t, health.StatusNotReady, report.Status)
+	assert.Equal(t, health.StatusDown, report.Checks["kafka"].Status)
+	assert.Equal(t, "no brokers reachable", report.Checks["kafka"].Error)
+
+	// A failing dependency doesn't make the process unhealthy
+	assert.Equal(t, health.StatusAlive, checker.Liveness().Status)
+}
+
+func TestChecker_CheckTimeout(t *testing.T) {
+	checker := health.NewChecker(config.HealthConf{CheckTimeoutMs: 10})
+	checker.Register("database", func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	report, ready := checker.Readiness(context.Background())
+	assert.False(t, ready)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["database"].Error)
+}
+
+func TestChecker_NotReadyOnShutdown(t *testing.T) {
+	checker := health.NewChecker(config.HealthConf{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- checker.Run(ctx) }()
+
+	_, ready := checker.Readiness(context.Background())
+	assert.True(t, ready)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return")
+	}
+	report, ready := checker.Readiness(context.Background())
+	assert.False(t, ready)
+	assert.Equal(t, health.StatusShuttingDown, report.Status)
+}
+
+func TestChecker_LivenessNeverRunsChecks(t *testing.T) {
+	checker := health.NewChecker(config.HealthConf{CacheTTLMs: 1, CheckTimeoutMs: 5000})
+	var calls atomic.Int32
+	release := make(chan struct{})
+	checker.Register("database", func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "", nil
+	})
+
+	// Nothing checked yet
+	report := checker.Liveness()
+	assert.Equal(t, health.StatusAlive, report.Status)
+	assert.Empty(t, report.Checks)
+	assert.Zero(t, calls.Load())
+
+	// A hanging check doesn't hold up the liveness probe
+	done := make(chan struct{})
+	go func() {
+		checker.Readiness(context.Background())
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	assert.Empty(t, checker.Liveness().Checks)
+	close(release)
+	<-done
+
+	// The latest results are reported as they are, even past the TTL
+	time.Sleep(5 * time.Millisecond)
+	report = checker.Liveness()
+	assert.Equal(t, health.StatusUp, report.Checks["database"].Status)
+	assert.Equal(t, int32(1), calls.Load())
+}
@@ -0,0 +1,51 @@
+package consumer
+
+import (
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/entity"
+)
+
+// Command types
+const (
+	CommandCreate = "company.create"
+	CommandUpdate = "company.update"
+	CommandDelete = "company.delete"
+)
+
+// Headers of the command, reply and dead-letter messages
+const (
+	HeaderCorrelationID   = "correlation-id"
+	HeaderError           = "error"
+	HeaderErrorCode       = "error-code"
+	HeaderSourceTopic     = "source-topic"
+	HeaderSourcePartition = "source-partition"
+	HeaderSourceOffset    = "source-offset"
+)
+
+// Command is a message asking for a company change. The correlation ID may
+// also be given in the correlation-id header, which takes precedence.
+type Command struct {
+	Type          string          `json:"type"`
+	CorrelationID string          `json:"correlation_id"`
+	ID            uuid.UUID       `json:"id"`
+	Company       *entity.Company `json:"company"`
+}
+
+// Reply statuses
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Reply is published to the reply topic once a command is handled. Code
+// follows the HTTP status the same change gets through the REST API. Warning
+// reports a command applied whose event couldn't be delivered.
+type Reply struct {
+	CorrelationID string          `json:"correlation_id"`
+	Command       string          `json:"command"`
+	Status        string          `json:"status"`
+	Code          int             `json:"code"`
+	Error         string          `json:"error,omitempty"`
+	Warning       string          `json:"warning,omitempty"`
+	Company       *entity.Company `json:"company,omitempty"`
+}
@@ -0,0 +1,339 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/entity"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/innoglobe/xmgo/pkg/httperr"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/innoglobe/xmgo/pkg/requestid"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/innoglobe/xmgo/internal/infrastructure/consumer"
+
+const (
+	defaultCommandSubject = "svc:commands"
+	defaultMaxRetries     = 3
+	defaultRetryBackoff   = 500 * time.Millisecond
+)
+
+// MessageReader reads messages of a consumer group, it is satisfied by *kafka.Reader
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// CommandConsumer applies the company commands of a topic through the company
+// usecase. Offsets are committed once a command succeeded, or once it is
+// safely on the dead-letter topic, so no command is ever lost.
+type CommandConsumer struct {
+	reader          MessageReader
+	writer          eventservice.MessageWriter
+	companies       usecase.CompanyUsecaseInterface
+	identity        *auth.Identity
+	deadLetterTopic string
+	replyTopic      string
+	maxRetries      int
+	retryBackoff    time.Duration
+	log             logger.LoggerInterface
+}
+
+func NewCommandConsumer(cfg config.KafkaConfig, companies usecase.CompanyUsecaseInterface, log logger.LoggerInterface) (*CommandConsumer, error) {
+	commands := cfg.Commands
+	// Without a dead-letter topic failed commands would be committed and lost
+	if commands.Topic == "" || commands.GroupID == "" || commands.DeadLetterTopic == "" {
+		return nil, errors.New("kafka.commands.topic, kafka.commands.group_id and kafka.commands.dead_letter_topic are required")
+	}
+	dialer, err := eventservice.NewKafkaDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// Replies and dead letters carry their topic
+	writer, err := eventservice.NewKafkaWriter(cfg, "")
+	if err != nil {
+		return nil, err
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cfg.Brokers,
+		GroupID:     commands.GroupID,
+		Topic:       commands.Topic,
+		Dialer:      dialer,
+		StartOffset: kafka.FirstOffset,
+	})
+	return newCommandConsumer(reader, writer, commands, companies, log), nil
+}
+
+func newCommandConsumer(reader MessageReader, writer eventservice.MessageWriter, cfg config.CommandsConf, companies usecase.CompanyUsecaseInterface, log logger.LoggerInterface) *CommandConsumer {
+	subject := cfg.Identity.Subject
+	if subject == "" {
+		subject = defaultCommandSubject
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+	retryBackoff := time.Duration(cfg.RetryBackoffMs) * time.Millisecond
+	if retryBackoff <= 0 {
+		retryBackoff = defaultRetryBackoff
+	}
+
+	return &CommandConsumer{
+		reader:    reader,
+		writer:    writer,
+		companies: companies,
+		identity: &auth.Identity{
+			Subject:  subject,
+			Method:   auth.MethodCommand,
+			Roles:    cfg.Identity.Roles,
+			Groups:   cfg.Identity.Groups,
+			TenantID: cfg.Identity.TenantID,
+		},
+		deadLetterTopic: cfg.DeadLetterTopic,
+		replyTopic:      cfg.ReplyTopic,
+		maxRetries:      maxRetries,
+		retryBackoff:    retryBackoff,
+		log:             log,
+	}
+}
+
+// Run consumes commands until ctx is done. The command being handled when
+// ctx is cancelled is finished first, unless it is failing with a transient
+// error: it is then left uncommitted for the next consumer. The reader and
+// writer are closed on return.
+func (c *CommandConsumer) Run(ctx context.Context) error {
+	defer c.reader.Close()
+	if closer, ok := c.writer.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to fetch command: %w", err)
+		}
+
+		if err := c.handle(context.WithoutCancel(ctx), ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// handle applies a command, replies and commits it. Nothing is committed
+// when the command can't be dead-lettered before stop is done, or when it is
+// still failing with a transient error once stop is done. The command runs in
+// a span continuing the trace of the message, if any.
+func (c *CommandConsumer) handle(ctx, stop context.Context, msg kafka.Message) error {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, &eventservice.KafkaHeaderCarrier{Headers: msg.Headers})
+	ctx, span := otel.Tracer(tracerName).Start(ctx, msg.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition)),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+		),
+	)
+	defer span.End()
+
+	cmd, err := decodeCommand(msg)
+	// The correlation ID plays the part of the request ID of API calls, the
+	// events caused by the command carry it
+	if requestid.Valid(cmd.CorrelationID) {
+		ctx = requestid.NewContext(ctx, cmd.CorrelationID)
+		ctx = logger.NewContext(ctx, c.log.With("request_id", cmd.CorrelationID))
+	}
+	var company *entity.Company
+	if err == nil {
+		company, err = c.executeWithRetry(ctx, stop, cmd)
+		// Shutting down, the command may well succeed once redelivered
+		if err != nil && retryable(err) && stop.Err() != nil {
+			c.log.Warn("Command left uncommitted on shutdown", "type", cmd.Type, "correlation_id", cmd.CorrelationID, "error", err)
+			return stop.Err()
+		}
+	}
+
+	reply := Reply{CorrelationID: cmd.CorrelationID, Command: cmd.Type, Status: StatusOK, Code: successCode(cmd.Type), Company: company}
+	// The change is stored, only its event is late, so the command succeeded
+	// and running it again would apply it twice
+	var deliveryErr *customerrors.EventDeliveryError
+	if errors.As(err, &deliveryErr) {
+		reply.Warning = err.Error()
+		c.log.Warn("Command applied but its event could not be delivered", "type", cmd.Type, "correlation_id", cmd.CorrelationID, "error", err)
+		err = nil
+	}
+	if err != nil {
+		reply.Status, reply.Code, reply.Error = StatusError, httperr.StatusCode(err), err.Error()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		c.log.Error("Command failed", "type", cmd.Type, "correlation_id", cmd.CorrelationID, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		if err := c.deadLetter(ctx, stop, msg, cmd, reply); err != nil {
+			return err
+		}
+	}
+	c.reply(ctx, reply)
+
+	if err := c.reader.CommitMessages(ctx, msg); err != nil {
+		return fmt.Errorf("failed to commit command: %w", err)
+	}
+	return nil
+}
+
+func decodeCommand(msg kafka.Message) (Command, error) {
+	var cmd Command
+	err := json.Unmarshal(msg.Value, &cmd)
+	for _, h := range msg.Headers {
+		if h.Key == HeaderCorrelationID {
+			cmd.CorrelationID = string(h.Value)
+		}
+	}
+	if cmd.CorrelationID == "" {
+		cmd.CorrelationID = uuid.NewString()
+	}
+	if err != nil {
+		return cmd, &customerrors.InvalidInputError{Msg: "Invalid command: " + err.Error()}
+	}
+	return cmd, nil
+}
+
+// executeWithRetry retries commands failing with a server side error, such
+// as an unreachable database. Invalid commands are never retried, and neither
+// are commands whose change was saved but whose event wasn't delivered.
+func (c *CommandConsumer) executeWithRetry(ctx, stop context.Context, cmd Command) (*entity.Company, error) {
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		company, err := c.execute(ctx, cmd)
+		if err == nil || !retryable(err) || attempt >= c.maxRetries {
+			return company, err
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-stop.Done():
+			return nil, err
+		}
+	}
+}
+
+// retryable tells whether a failed command may succeed when run again
+func retryable(err error) bool {
+	var deliveryErr *customerrors.EventDeliveryError
+	return !errors.As(err, &deliveryErr) && httperr.StatusCode(err) >= http.StatusInternalServerError
+}
+
+func (c *CommandConsumer) execute(ctx context.Context, cmd Command) (*entity.Company, error) {
+	ctx = auth.NewContext(ctx, c.identity)
+
+	switch cmd.Type {
+	case CommandCreate, CommandUpdate:
+		if cmd.Company == nil {
+			return nil, &customerrors.InvalidInputError{Msg: "company is required"}
+		}
+		if err := binding.Validator.ValidateStruct(cmd.Company); err != nil {
+			return nil, &customerrors.InvalidInputError{Msg: err.Error()}
+		}
+		if cmd.Type == CommandCreate {
+			return c.companies.CreateCompany(ctx, cmd.Company)
+		}
+		if cmd.ID == uuid.Nil {
+			return nil, &customerrors.InvalidInputError{Msg: "id is required"}
+		}
+		return c.companies.UpdateCompany(ctx, cmd.ID, cmd.Company)
+	case CommandDelete:
+		if cmd.ID == uuid.Nil {
+			return nil, &customerrors.InvalidInputError{Msg: "id is required"}
+		}
+		return nil, c.companies.DeleteCompany(ctx, cmd.ID)
+	default:
+		return nil, &customerrors.InvalidInputError{Msg: fmt.Sprintf("unknown command type %q", cmd.Type)}
+	}
+}
+
+// deadLetter copies the failed command to the dead-letter topic, with the
+// error and its origin in headers. It keeps trying until stop is done, since
+// the command must not be committed before it is dead-lettered.
+func (c *CommandConsumer) deadLetter(ctx, stop context.Context, msg kafka.Message, cmd Command, reply Reply) error {
+	headers := append([]kafka.Header{}, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderCorrelationID, Value: []byte(cmd.CorrelationID)},
+		kafka.Header{Key: HeaderError, Value: []byte(reply.Error)},
+		kafka.Header{Key: HeaderErrorCode, Value: []byte(strconv.Itoa(reply.Code))},
+		kafka.Header{Key: HeaderSourceTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderSourcePartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderSourceOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+	)
+	dead := kafka.Message{Topic: c.deadLetterTopic, Key: msg.Key, Value: msg.Value, Headers: headers}
+
+	backoff := c.retryBackoff
+	for {
+		err := c.writer.WriteMessages(ctx, dead)
+		if err == nil {
+			return nil
+		}
+		c.log.Error("Failed to dead-letter command", "correlation_id", cmd.CorrelationID, "error", err)
+		select {
+		case <-time.After(backoff):
+			backoff = min(backoff*2, time.Minute)
+		case <-stop.Done():
+			return err
+		}
+	}
+}
+
+// reply publishes the result of a command. Replies are best effort, a lost
+// reply doesn't undo the command.
+func (c *CommandConsumer) reply(ctx context.Context, reply Reply) {
+	if c.replyTopic == "" {
+		return
+	}
+	value, err := json.Marshal(reply)
+	if err == nil {
+		err = c.writer.WriteMessages(ctx, kafka.Message{
+			Topic:   c.replyTopic,
+			Key:     []byte(reply.CorrelationID),
+			Value:   value,
+			Headers: []kafka.Header{{Key: HeaderCorrelationID, Value: []byte(reply.CorrelationID)}},
+		})
+	}
+	if err != nil {
+		c.log.Error("Failed to publish reply to command", "correlation_id", reply.CorrelationID, "error", err)
+	}
+}
+
+// successCode is the status the REST API answers a successful change with
+func successCode(commandType string) int {
+	switch commandType {
+	case CommandCreate:
+		return http.StatusCreated
+	case CommandDelete:
+		return http.StatusNoContent
+	}
+	return http.StatusOK
+}
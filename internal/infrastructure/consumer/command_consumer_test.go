@@ -0,0 +1,193 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReader struct {
+	msgs      []kafka.Message
+	committed []int64
+}
+
+func (r *fakeReader) FetchMessage(context.Context) (kafka.Message, error) {
+	if len(r.msgs) == 0 {
+		return kafka.Message{}, io.EOF
+	}
+	msg := r.msgs[0]
+	r.msgs = r.msgs[1:]
+	return msg, nil
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+type fakeWriter struct {
+	written map[string][]kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	for _, m := range msgs {
+		w.written[m.Topic] = append(w.written[m.Topic], m)
+	}
+	return nil
+}
+
+// fakeCompanies creates companies, and fails with a database error the first
+// failures times. With undelivered set the companies are created but their
+// event isn't delivered.
+type fakeCompanies struct {
+	usecase.CompanyUsecaseInterface
+	failures    int
+	undelivered bool
+	callers     []string
+}
+
+func (u *fakeCompanies) CreateCompany(ctx context.Context, company *entity.Company) (*entity.Company, error) {
+	caller, _ := auth.FromContext(ctx)
+	u.callers = append(u.callers, caller.Subject)
+	if u.failures > 0 {
+		u.failures--
+		return nil, &customerrors.GenericTxError{Msg: "connection reset"}
+	}
+	company.ID = uuid.New()
+	if u.undelivered {
+		return nil, &customerrors.EventDeliveryError{Msg: "queue full"}
+	}
+	return company, nil
+}
+
+func newTestConsumer(companies *fakeCompanies, msgs ...kafka.Message) (*CommandConsumer, *fakeReader, *fakeWriter) {
+	reader := &fakeReader{msgs: msgs}
+	writer := &fakeWriter{written: map[string][]kafka.Message{}}
+	c := newCommandConsumer(reader, writer, config.CommandsConf{
+		DeadLetterTopic: "commands.dlq",
+		ReplyTopic:      "commands.replies",
+		MaxRetries:      2,
+		RetryBackoffMs:  1,
+		Identity:        config.CommandIdentityConf{Subject: "svc:partner"},
+	}, companies, logger.Discard())
+	return c, reader, writer
+}
+
+func command(t *testing.T, offset int64, cmd Command) kafka.Message {
+	value, err := json.Marshal(cmd)
+	require.NoError(t, err)
+	return kafka.Message{Topic: "commands", Offset: offset, Value: value}
+}
+
+func replies(t *testing.T, w *fakeWriter) []Reply {
+	var out []Reply
+	for _, m := range w.written["commands.replies"] {
+		var r Reply
+		require.NoError(t, json.Unmarshal(m.Value, &r))
+		out = append(out, r)
+	}
+	return out
+}
+
+func TestCommandConsumer(t *testing.T) {
+	company := &entity.Company{Name: "Acme", AmountOfEmployees: 10, Registered: true, Type: entity.Corporation}
+	companies := &fakeCompanies{failures: 1}
+	c, reader, writer := newTestConsumer(companies,
+		command(t, 1, Command{Type: CommandCreate, CorrelationID: "c-1", Company: company}),
+		command(t, 2, Command{Type: "company.rename", CorrelationID: "c-2"}),
+		kafka.Message{Topic: "commands", Offset: 3, Value: []byte("{"), Headers: []kafka.Header{{Key: HeaderCorrelationID, Value: []byte("c-3")}}},
+	)
+
+	err := c.Run(context.Background())
+	assert.ErrorIs(t, err, io.EOF)
+
+	// The transient failure is retried, and every command is committed once handled
+	assert.Equal(t, []string{"svc:partner", "svc:partner"}, companies.callers)
+	assert.Equal(t, []int64{1, 2, 3}, reader.committed)
+
+	got := replies(t, writer)
+	require.Len(t, got, 3)
+	assert.Equal(t, "c-1", got[0].CorrelationID)
+	assert.Equal(t, StatusOK, got[0].Status)
+	assert.Equal(t, 201, got[0].Code)
+	assert.Equal(t, "Acme", got[0].Company.Name)
+	assert.Equal(t, StatusError, got[1].Status)
+	assert.Equal(t, 400, got[1].Code)
+	assert.Equal(t, "c-3", got[2].CorrelationID)
+
+	dead := writer.written["commands.dlq"]
+	require.Len(t, dead, 2)
+	assert.Contains(t, dead[0].Headers, kafka.Header{Key: HeaderSourceOffset, Value: []byte("2")})
+	assert.Equal(t, []byte("{"), dead[1].Value)
+}
+
+func TestCommandConsumer_GivesUpOnTransientErrors(t *testing.T) {
+	company := &entity.Company{Name: "Acme", AmountOfEmployees: 10, Registered: true, Type: entity.Corporation}
+	companies := &fakeCompanies{failures: 10}
+	c, reader, writer := newTestConsumer(companies, command(t, 7, Command{Type: CommandCreate, Company: company}))
+
+	assert.ErrorIs(t, c.Run(context.Background()), io.EOF)
+
+	assert.Len(t, companies.callers, 3)
+	assert.Equal(t, []int64{7}, reader.committed)
+	require.Len(t, writer.written["commands.dlq"], 1)
+	assert.Equal(t, 500, replies(t, writer)[0].Code)
+}
+
+func TestCommandConsumer_ShutdownLeavesTransientFailuresUncommitted(t *testing.T) {
+	company := &entity.Company{Name: "Acme", AmountOfEmployees: 10, Registered: true, Type: entity.Corporation}
+	companies := &fakeCompanies{failures: 10}
+	c, reader, writer := newTestConsumer(companies, command(t, 5, Command{Type: CommandCreate, Company: company}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, c.Run(ctx))
+
+	// Redelivered to the next consumer rather than dead-lettered
+	assert.NotEmpty(t, companies.callers)
+	assert.Empty(t, reader.committed)
+	assert.Empty(t, writer.written["commands.dlq"])
+	assert.Empty(t, replies(t, writer))
+}
+
+func TestCommandConsumer_UndeliveredEventIsNotRetried(t *testing.T) {
+	company := &entity.Company{Name: "Acme", AmountOfEmployees: 10, Registered: true, Type: entity.Corporation}
+	companies := &fakeCompanies{undelivered: true}
+	c, reader, writer := newTestConsumer(companies, command(t, 4, Command{Type: CommandCreate, Company: company}))
+
+	assert.ErrorIs(t, c.Run(context.Background()), io.EOF)
+
+	// The company exists, creating it again would duplicate it
+	assert.Len(t, companies.callers, 1)
+	assert.Equal(t, []int64{4}, reader.committed)
+	assert.Empty(t, writer.written["commands.dlq"])
+	got := replies(t, writer)
+	require.Len(t, got, 1)
+	assert.Equal(t, StatusOK, got[0].Status)
+	assert.Equal(t, 201, got[0].Code)
+	assert.Contains(t, got[0].Warning, "queue full")
+}
+
+func TestNewCommandConsumer_RequiresDeadLetterTopic(t *testing.T) {
+	_, err := NewCommandConsumer(config.KafkaConfig{
+		Brokers:  []string{"localhost:9092"},
+		Commands: config.CommandsConf{Enabled: true, Topic: "commands", GroupID: "xmgo"},
+	}, &fakeCompanies{}, logger.Discard())
+	assert.ErrorContains(t, err, "dead_letter_topic")
+}
@@ -0,0 +1,117 @@
+package postgresrepository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/interface/repository"
+	"gorm.io/gorm"
+)
+
+// interface assertion to make sure it implements all methods
+var _ repository.APIKeyRepositoryInterface = &APIKeyRepository{}
+
+// APIKeyRepository struct
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository creates a new instance of APIKeyRepository
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// Create inserts an api key into the database
+func (r *APIKeyRepository) Create(ctx context.Context, key *entity.APIKey) (*entity.APIKey, error) {
+	err := withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		key.TenantID = tenant
+		if err := tx.Create(key).Error; err != nil {
+			return translateError(err, uuid.Nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// List returns the api keys of the caller's tenant, newest first
+func (r *APIKeyRepository) List(ctx context.Context) ([]entity.APIKey, error) {
+	var keys []entity.APIKey
+	err := withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		if err := tx.Where("tenant_id = ?", tenant).Order("created_at DESC").Find(&keys).Error; err != nil {
+			return translateError(err, uuid.Nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetByPrefix gets an api key by its public prefix. It isn't tenant scoped
+// because the tenant is only known once the key has been authenticated, the
+// row-level security policies only expose the key with that prefix.
+func (r *APIKeyRepository) GetByPrefix(ctx context.Context, prefix string) (*entity.APIKey, error) {
+	var key entity.APIKey
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT set_config('app.api_key_prefix', ?, true)", prefix).Error; err != nil {
+			return translateError(err, uuid.Nil)
+		}
+		if err := tx.Where("prefix = ?", prefix).First(&key).Error; err != nil {
+			return translateError(err, uuid.Nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Revoke marks an api key of the caller's tenant as revoked
+func (r *APIKeyRepository) Revoke(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		res := tx.Model(&entity.APIKey{}).
+			Where("id = ? AND tenant_id = ? AND revoked_at IS NULL", id, tenant).
+			Update("revoked_at", at)
+		if res.Error != nil {
+			return translateError(res.Error, id)
+		}
+		if res.RowsAffected == 0 {
+			return &customerrors.RecordNotFoundError{ID: id}
+		}
+		return nil
+	})
+}
+
+// TouchLastUsed records when an api key of the caller's tenant was last used
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		err := tx.Model(&entity.APIKey{}).
+			Where("id = ? AND tenant_id = ?", id, tenant).
+			Update("last_used_at", at).Error
+		if err != nil {
+			return translateError(err, id)
+		}
+		return nil
+	})
+}
+
+// translateError maps a gorm error to one of our custom errors
+func translateError(err error, id uuid.UUID) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &customerrors.RecordNotFoundError{ID: id}
+	}
+	if strings.Contains(err.Error(), "connection refused") {
+		return &customerrors.DBConnectionError{}
+	}
+	return &customerrors.GenericTxError{Msg: err.Error()}
+}
@@ -0,0 +1,93 @@
+package postgresrepository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/interface/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// interface assertion to make sure it implements all methods
+var _ repository.CompanyGrantRepositoryInterface = &CompanyGrantRepository{}
+
+// CompanyGrantRepository struct
+type CompanyGrantRepository struct {
+	db *gorm.DB
+}
+
+// NewCompanyGrantRepository creates a new instance of CompanyGrantRepository
+func NewCompanyGrantRepository(db *gorm.DB) *CompanyGrantRepository {
+	return &CompanyGrantRepository{db: db}
+}
+
+// Save inserts a grant, or updates the permission if the principal already has one on the company
+func (r *CompanyGrantRepository) Save(ctx context.Context, grant *entity.CompanyGrant) (*entity.CompanyGrant, error) {
+	err := withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		grant.TenantID = tenant
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "company_id"}, {Name: "principal_type"}, {Name: "principal"}},
+			DoUpdates: clause.AssignmentColumns([]string{"permission", "granted_by"}),
+		}).Create(grant).Error
+		if err != nil {
+			return translateError(err, grant.CompanyID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// List lists the grants of a company
+func (r *CompanyGrantRepository) List(ctx context.Context, companyID uuid.UUID) ([]entity.CompanyGrant, error) {
+	var grants []entity.CompanyGrant
+	err := withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		err := tx.Where("tenant_id = ? AND company_id = ?", tenant, companyID).Order("created_at").Find(&grants).Error
+		if err != nil {
+			return translateError(err, companyID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// Delete deletes a grant from a company
+func (r *CompanyGrantRepository) Delete(ctx context.Context, companyID uuid.UUID, grantID uuid.UUID) error {
+	return withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		res := tx.Where("tenant_id = ? AND company_id = ? AND id = ?", tenant, companyID, grantID).Delete(&entity.CompanyGrant{})
+		if res.Error != nil {
+			return translateError(res.Error, grantID)
+		}
+		if res.RowsAffected == 0 {
+			return &customerrors.RecordNotFoundError{ID: grantID}
+		}
+		return nil
+	})
+}
+
+// FindForViewer returns the grants on a company held by the viewer or one of their groups
+func (r *CompanyGrantRepository) FindForViewer(ctx context.Context, companyID uuid.UUID, viewer repository.CompanyViewer) ([]entity.CompanyGrant, error) {
+	var grants []entity.CompanyGrant
+	err := withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		err := tx.Where(
+			"tenant_id = ? AND company_id = ? AND ((principal_type = ? AND principal = ?) OR (principal_type = ? AND principal IN ?))",
+			tenant, companyID, entity.PrincipalUser, viewer.Subject, entity.PrincipalGroup, viewer.Groups,
+		).Find(&grants).Error
+		if err != nil {
+			return translateError(err, companyID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
@@ -2,13 +2,12 @@ package postgresrepository
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"github.com/google/uuid"
 	"github.com/innoglobe/xmgo/internal/customerrors"
 	"github.com/innoglobe/xmgo/internal/entity"
 	"github.com/innoglobe/xmgo/internal/interface/repository"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"strings"
 )
 
@@ -27,76 +26,145 @@ func NewPostgresRepository(db *gorm.DB) *PostgresRepository {
 
 // Create insert company into the database
 func (r *PostgresRepository) Create(ctx context.Context, company *entity.Company) (*entity.Company, error) {
-	if err := r.db.WithContext(ctx).Create(company).Error; err != nil {
-		fmt.Printf("ERROR: %T\n", err)
-		// We use the sqlstate search because gorm.ErrDuplicatedKey doesn't catch the unique constraint violation
-		if strings.Contains(err.Error(), "SQLSTATE 23505") {
-			return nil, &customerrors.CompanyExistsError{Name: company.Name}
+	err := withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		company.TenantID = tenant
+		if err := tx.Create(company).Error; err != nil {
+			// We use the sqlstate search because gorm.ErrDuplicatedKey doesn't catch the unique constraint violation
+			if strings.Contains(err.Error(), "SQLSTATE 23505") {
+				return &customerrors.CompanyExistsError{Name: company.Name}
+			}
+			return translateError(err, uuid.Nil)
 		}
-		if strings.Contains(err.Error(), "connection refused") {
-			return nil, &customerrors.DBConnectionError{}
-		}
-		return nil, &customerrors.GenericTxError{Msg: err.Error()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return company, nil
 }
 
-// Update updates company in the database
-func (r *PostgresRepository) Update(ctx context.Context, id uuid.UUID, company *entity.Company) (*entity.Company, error) {
-	var existingCompany entity.Company
-	if err := r.db.WithContext(ctx).First(&existingCompany, id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, &customerrors.RecordNotFoundError{ID: id}
-		}
-		if strings.Contains(err.Error(), "connection refused") {
-			return nil, &customerrors.DBConnectionError{}
+// Update updates company in the database. The row is locked while it is
+// read, so before is the state this update overwrote.
+func (r *PostgresRepository) Update(ctx context.Context, id uuid.UUID, company *entity.Company) (*entity.Company, *entity.Company, error) {
+	var before, existingCompany entity.Company
+	err := withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("tenant_id = ?", tenant).First(&existingCompany, id).Error; err != nil {
+			return translateError(err, id)
 		}
-		return nil, &customerrors.GenericTxError{Msg: err.Error()}
-	}
+		before = existingCompany
 
-	if company.ID != uuid.Nil && existingCompany.ID != company.ID {
-		return nil, &customerrors.IDUpdateError{ID: id}
-	}
+		if company.ID != uuid.Nil && existingCompany.ID != company.ID {
+			return &customerrors.IDUpdateError{ID: id}
+		}
 
-	if err := r.db.WithContext(ctx).Model(&existingCompany).Updates(company).Error; err != nil {
-		return nil, &customerrors.GenericTxError{Msg: err.Error()}
+		// Tenant and ownership never move through an update, empty fields
+		// are left alone by Updates
+		company.TenantID = ""
+		company.Owner = ""
+		if err := tx.Model(&existingCompany).Updates(company).Error; err != nil {
+			if strings.Contains(err.Error(), "SQLSTATE 23505") {
+				return &customerrors.CompanyExistsError{Name: company.Name}
+			}
+			return &customerrors.GenericTxError{Msg: err.Error()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return &existingCompany, nil
+	return &before, &existingCompany, nil
 }
 
 // Delete deletes a company from the database
 func (r *PostgresRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	var company entity.Company
-	if err := r.db.WithContext(ctx).First(&company, id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return &customerrors.RecordNotFoundError{ID: id}
-		}
-		if strings.Contains(err.Error(), "connection refused") {
-			return &customerrors.DBConnectionError{}
+	return withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		var company entity.Company
+		if err := tx.Where("tenant_id = ?", tenant).First(&company, id).Error; err != nil {
+			return translateError(err, id)
 		}
-		return &customerrors.GenericTxError{Msg: err.Error()}
-	}
-
-	if err := r.db.WithContext(ctx).Delete(&company).Error; err != nil {
-		return &customerrors.GenericTxError{Msg: err.Error()}
-	}
 
-	return nil
+		if err := tx.Delete(&company).Error; err != nil {
+			return &customerrors.GenericTxError{Msg: err.Error()}
+		}
+		return nil
+	})
 }
 
 // Get gets a company from the database
 func (r *PostgresRepository) Get(ctx context.Context, id uuid.UUID) (*entity.Company, error) {
 	var company entity.Company
-	if err := r.db.WithContext(ctx).First(&company, id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, &customerrors.RecordNotFoundError{ID: id}
+	err := withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		if err := tx.Where("tenant_id = ?", tenant).First(&company, id).Error; err != nil {
+			return translateError(err, id)
 		}
-		if strings.Contains(err.Error(), "connection refused") {
-			return nil, &customerrors.DBConnectionError{}
-		}
-		return nil, &customerrors.GenericTxError{Msg: err.Error()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return &company, nil
 }
+
+// List lists companies, restricted to what the filter's viewer can see
+func (r *PostgresRepository) List(ctx context.Context, filter repository.CompanyListFilter) ([]entity.Company, error) {
+	var companies []entity.Company
+	err := withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		q := tx.Model(&entity.Company{}).Where("tenant_id = ?", tenant)
+		if v := filter.Viewer; v != nil {
+			granted := tx.Session(&gorm.Session{NewDB: true}).Model(&entity.CompanyGrant{}).Select("company_id").Where(
+				"tenant_id = ? AND ((principal_type = ? AND principal = ?) OR (principal_type = ? AND principal IN ?))",
+				tenant, entity.PrincipalUser, v.Subject, entity.PrincipalGroup, v.Groups,
+			)
+			q = q.Where("(owner = ? OR id IN (?))", v.Subject, granted)
+		}
+		if filter.Limit > 0 {
+			q = q.Limit(filter.Limit)
+		}
+		if filter.Offset > 0 {
+			q = q.Offset(filter.Offset)
+		}
+
+		if err := q.Order("created_at, id").Find(&companies).Error; err != nil {
+			return translateError(err, uuid.Nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return companies, nil
+}
+
+// Snapshot returns the next page of companies by ID, see CompanySnapshotFilter
+func (r *PostgresRepository) Snapshot(ctx context.Context, filter repository.CompanySnapshotFilter) ([]entity.Company, error) {
+	var companies []entity.Company
+	err := withTenant(ctx, r.db, func(tx *gorm.DB, tenant string) error {
+		q := tx.Model(&entity.Company{}).Where("tenant_id = ?", tenant)
+		if filter.AfterID != uuid.Nil {
+			q = q.Where("id > ?", filter.AfterID)
+		}
+		if filter.Type != "" {
+			q = q.Where("type = ?", filter.Type)
+		}
+		if filter.Registered != nil {
+			q = q.Where("registered = ?", *filter.Registered)
+		}
+		if !filter.UpdatedSince.IsZero() {
+			q = q.Where("updated_at >= ?", filter.UpdatedSince)
+		}
+		if filter.Limit > 0 {
+			q = q.Limit(filter.Limit)
+		}
+
+		if err := q.Order("id").Find(&companies).Error; err != nil {
+			return translateError(err, uuid.Nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return companies, nil
+}
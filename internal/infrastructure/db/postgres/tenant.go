@@ -0,0 +1,22 @@
+package postgresrepository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"gorm.io/gorm"
+)
+
+// withTenant runs fn in a transaction scoped to the tenant of the caller in ctx.
+// The tenant is set as app.tenant_id for the row-level security policies, and
+// handed to fn so queries can filter on it explicitly as well.
+func withTenant(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB, tenant string) error) error {
+	tenant := auth.TenantFromContext(ctx)
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT set_config('app.tenant_id', ?, true)", tenant).Error; err != nil {
+			return translateError(err, uuid.Nil)
+		}
+		return fn(tx, tenant)
+	})
+}
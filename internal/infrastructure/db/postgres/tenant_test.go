@@ -0,0 +1,142 @@
+package postgresrepository_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/entity"
+	postgresrepository "github.com/innoglobe/xmgo/internal/infrastructure/db/postgres"
+	"github.com/innoglobe/xmgo/internal/interface/repository"
+	"github.com/innoglobe/xmgo/pkg/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// The tests run against the database of config.yaml, or XMGO_TEST_DSN, and
+// are skipped when it isn't reachable
+var dsn = fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+	"xmgo", "xmgopass", "127.0.0.1", 25432, "xmgo_db")
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	if env := os.Getenv("XMGO_TEST_DSN"); env != "" {
+		dsn = env
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Skipf("database not available: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil || sqlDB.Ping() != nil {
+		t.Skip("database not available")
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, migrations.Migrate(dsn, "../../../../migrations"))
+	return db
+}
+
+func tenantContext(subject, tenant string) context.Context {
+	return auth.NewContext(context.Background(), &auth.Identity{Subject: subject, TenantID: tenant})
+}
+
+func TestRepositories_TenantIsolation(t *testing.T) {
+	db := openDB(t)
+	companies := postgresrepository.NewPostgresRepository(db)
+	grants := postgresrepository.NewCompanyGrantRepository(db)
+	apiKeys := postgresrepository.NewAPIKeyRepository(db)
+	acme, globex := tenantContext("alice", "acme-"+gofakeit.UUID()), tenantContext("alice", "globex-"+gofakeit.UUID())
+
+	company, err := companies.Create(acme, &entity.Company{Name: gofakeit.Company() + " " + gofakeit.UUID(), Type: entity.Corporation, Owner: "alice"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = companies.Delete(acme, company.ID) })
+	_, err = grants.Save(acme, &entity.CompanyGrant{CompanyID: company.ID, PrincipalType: entity.PrincipalUser, Principal: "bob", Permission: entity.PermissionRead})
+	require.NoError(t, err)
+	key, err := apiKeys.Create(acme, &entity.APIKey{Name: "k", Prefix: gofakeit.LetterN(8), Hash: gofakeit.LetterN(64), Scopes: []string{auth.ScopeCompaniesRead}})
+	require.NoError(t, err)
+
+	// The same company name is free in another tenant
+	other, err := companies.Create(globex, &entity.Company{Name: company.Name, Type: entity.Corporation, Owner: "alice"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = companies.Delete(globex, other.ID) })
+
+	_, err = companies.Get(globex, company.ID)
+	assert.IsType(t, &customerrors.RecordNotFoundError{}, err)
+	_, _, err = companies.Update(globex, company.ID, &entity.Company{Description: "taken over"})
+	assert.IsType(t, &customerrors.RecordNotFoundError{}, err)
+	assert.IsType(t, &customerrors.RecordNotFoundError{}, companies.Delete(globex, company.ID))
+
+	listed, err := companies.List(globex, repository.CompanyListFilter{})
+	require.NoError(t, err)
+	for _, c := range listed {
+		assert.NotEqual(t, company.ID, c.ID)
+	}
+
+	found, err := grants.List(globex, company.ID)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+	found, err = grants.FindForViewer(globex, company.ID, repository.CompanyViewer{Subject: "bob"})
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	keys, err := apiKeys.List(globex)
+	require.NoError(t, err)
+	for _, k := range keys {
+		assert.NotEqual(t, key.ID, k.ID)
+	}
+	assert.IsType(t, &customerrors.RecordNotFoundError{}, apiKeys.Revoke(globex, key.ID, key.CreatedAt))
+
+	// Keys are looked up by prefix before their tenant is known
+	byPrefix, err := apiKeys.GetByPrefix(context.Background(), key.Prefix)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, byPrefix.ID)
+}
+
+// TestRowLevelSecurity queries the tables without any tenant filter as a role
+// the policies apply to, superusers bypass them
+func TestRowLevelSecurity(t *testing.T) {
+	db := openDB(t)
+	companies := postgresrepository.NewPostgresRepository(db)
+	apiKeys := postgresrepository.NewAPIKeyRepository(db)
+	acme := tenantContext("alice", "acme-"+gofakeit.UUID())
+
+	company, err := companies.Create(acme, &entity.Company{Name: gofakeit.Company() + " " + gofakeit.UUID(), Type: entity.Corporation, Owner: "alice"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = companies.Delete(acme, company.ID) })
+	key, err := apiKeys.Create(acme, &entity.APIKey{Name: "k", Prefix: gofakeit.LetterN(8), Hash: gofakeit.LetterN(64), Scopes: []string{auth.ScopeCompaniesRead}})
+	require.NoError(t, err)
+
+	// Everything, the role included, is rolled back
+	tx := db.Begin()
+	defer tx.Rollback()
+	if err := tx.Exec("CREATE ROLE xmgo_rls_probe NOLOGIN").Error; err != nil {
+		t.Skipf("can't create a role to probe the policies: %v", err)
+	}
+	require.NoError(t, tx.Exec("GRANT SELECT ON companies, company_grants, api_keys TO xmgo_rls_probe").Error)
+	require.NoError(t, tx.Exec("SET LOCAL ROLE xmgo_rls_probe").Error)
+
+	count := func(query string, args ...any) int64 {
+		var n int64
+		require.NoError(t, tx.Raw(query, args...).Scan(&n).Error)
+		return n
+	}
+
+	require.NoError(t, tx.Exec("SELECT set_config('app.tenant_id', 'globex', true)").Error)
+	assert.Zero(t, count("SELECT count(*) FROM companies WHERE id = ?", company.ID))
+	assert.Zero(t, count("SELECT count(*) FROM company_grants WHERE company_id = ?", company.ID))
+	assert.Zero(t, count("SELECT count(*) FROM api_keys WHERE id = ?", key.ID))
+
+	require.NoError(t, tx.Exec("SELECT set_config('app.api_key_prefix', ?, true)", key.Prefix).Error)
+	assert.Equal(t, int64(1), count("SELECT count(*) FROM api_keys WHERE id = ?", key.ID))
+	assert.Equal(t, int64(1), count("SELECT count(*) FROM api_keys"), "the prefix only exposes its own key")
+
+	require.NoError(t, tx.Exec("SELECT set_config('app.tenant_id', ?, true)", auth.TenantFromContext(acme)).Error)
+	assert.Equal(t, int64(1), count("SELECT count(*) FROM companies WHERE id = ?", company.ID))
+}
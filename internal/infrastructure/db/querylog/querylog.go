@@ -0,0 +1,238 @@
+// Package querylog is the gorm logger of the service. It logs slow and failed
+// statements through the structured logger and keeps statistics per statement,
+// so hot or slow queries can be found without pg_stat_statements.
+package querylog
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/tracing"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+)
+
+const (
+	// DefaultSlowThreshold is used when database.slow_query_ms is not set
+	DefaultSlowThreshold = 200 * time.Millisecond
+	// DefaultMaxStatements is used when database.query_stats_size is not set
+	DefaultMaxStatements = 500
+)
+
+// Statistics orders accepted by Top
+const (
+	SortTotal = "total"
+	SortMean  = "mean"
+	SortMax   = "max"
+	SortCalls = "calls"
+)
+
+// StatementStats are the statistics of one sanitized statement since it was
+// first seen, or since the last reset
+type StatementStats struct {
+	SQL      string    `json:"sql"`
+	Caller   string    `json:"caller"`
+	Calls    int64     `json:"calls"`
+	Errors   int64     `json:"errors"`
+	Slow     int64     `json:"slow"`
+	Rows     int64     `json:"rows"`
+	TotalMs  float64   `json:"total_ms"`
+	MeanMs   float64   `json:"mean_ms"`
+	MaxMs    float64   `json:"max_ms"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Logger implements gorm's logger.Interface
+type Logger struct {
+	log           logger.LoggerInterface
+	level         gormlogger.LogLevel
+	slow          time.Duration
+	maxStatements int
+
+	// stats is shared by the loggers returned by LogMode
+	stats *stats
+}
+
+type stats struct {
+	mu         sync.Mutex
+	statements map[string]*StatementStats
+}
+
+var _ gormlogger.Interface = &Logger{}
+
+// New returns a logger writing to log, or to the logger of the request when
+// the context carries one. Statements slower than database.slow_query_ms are
+// logged at warn level, failed ones at error level. The statistics of at most
+// database.query_stats_size statements are kept, the least recently seen
+// statement makes room for a new one.
+func New(cfg config.DBConf, log logger.LoggerInterface) *Logger {
+	l := &Logger{
+		log:           log,
+		level:         gormlogger.Warn,
+		slow:          DefaultSlowThreshold,
+		maxStatements: DefaultMaxStatements,
+		stats:         &stats{statements: map[string]*StatementStats{}},
+	}
+	if cfg.SlowQueryMs > 0 {
+		l.slow = time.Duration(cfg.SlowQueryMs) * time.Millisecond
+	}
+	if cfg.QueryStatsSize > 0 {
+		l.maxStatements = cfg.QueryStatsSize
+	}
+	return l
+}
+
+// LogMode returns a logger with the given gorm level, Silent turns logging
+// off but the statistics are still recorded
+func (l *Logger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	c := *l
+	c.level = level
+	return &c
+}
+
+func (l *Logger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Info {
+		logger.FromContext(ctx, l.log).Info(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *Logger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		logger.FromContext(ctx, l.log).Warn(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *Logger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Error {
+		logger.FromContext(ctx, l.log).Error(fmt.Sprintf(msg, args...))
+	}
+}
+
+// Trace is called by gorm after every statement. Records not found are not
+// failures, the repositories report them to the caller.
+func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	statement, rows := fc()
+	statement = normalize(tracing.SanitizeSQL(statement))
+	caller := utils.FileWithLineNum()
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	slow := elapsed >= l.slow
+
+	l.stats.record(statement, caller, elapsed, rows, failed, slow, l.maxStatements)
+
+	if l.level == gormlogger.Silent || (!failed && !slow) {
+		return
+	}
+	args := []any{
+		"sql", statement,
+		"duration_ms", float64(elapsed.Microseconds()) / 1000,
+		"rows", rows,
+		"caller", caller,
+	}
+	log := logger.FromContext(ctx, l.log)
+	switch {
+	case failed && l.level >= gormlogger.Error:
+		log.Error("Query failed", append(args, "error", err)...)
+	case slow && l.level >= gormlogger.Warn:
+		log.Warn("Slow query", append(args, "threshold_ms", l.slow.Milliseconds())...)
+	}
+}
+
+// Top returns the statistics of the n statements ranking first by the given
+// order, all of them when n is 0
+func (l *Logger) Top(by string, n int) ([]StatementStats, error) {
+	var key func(StatementStats) float64
+	switch by {
+	case "", SortTotal:
+		key = func(s StatementStats) float64 { return s.TotalMs }
+	case SortMean:
+		key = func(s StatementStats) float64 { return s.MeanMs }
+	case SortMax:
+		key = func(s StatementStats) float64 { return s.MaxMs }
+	case SortCalls:
+		key = func(s StatementStats) float64 { return float64(s.Calls) }
+	default:
+		return nil, fmt.Errorf("invalid sort %q, expected total, mean, max or calls", by)
+	}
+
+	l.stats.mu.Lock()
+	res := make([]StatementStats, 0, len(l.stats.statements))
+	for _, s := range l.stats.statements {
+		res = append(res, *s)
+	}
+	l.stats.mu.Unlock()
+
+	slices.SortFunc(res, func(a, b StatementStats) int {
+		if c := cmp.Compare(key(b), key(a)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.SQL, b.SQL)
+	})
+	if n > 0 && n < len(res) {
+		res = res[:n]
+	}
+	return res, nil
+}
+
+// Reset drops the statistics
+func (l *Logger) Reset() {
+	l.stats.mu.Lock()
+	defer l.stats.mu.Unlock()
+	l.stats.statements = map[string]*StatementStats{}
+}
+
+func (s *stats) record(statement, caller string, elapsed time.Duration, rows int64, failed, slow bool, limit int) {
+	ms := float64(elapsed.Microseconds()) / 1000
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.statements[statement]
+	if !ok {
+		if len(s.statements) >= limit {
+			s.evict()
+		}
+		st = &StatementStats{SQL: statement}
+		s.statements[statement] = st
+	}
+	st.Caller = caller
+	st.Calls++
+	if failed {
+		st.Errors++
+	}
+	if slow {
+		st.Slow++
+	}
+	st.Rows += max(rows, 0)
+	st.TotalMs += ms
+	st.MeanMs = st.TotalMs / float64(st.Calls)
+	st.MaxMs = max(st.MaxMs, ms)
+	st.LastSeen = time.Now()
+}
+
+// evict drops the least recently seen statement
+func (s *stats) evict() {
+	var oldest *StatementStats
+	for _, st := range s.statements {
+		if oldest == nil || st.LastSeen.Before(oldest.LastSeen) {
+			oldest = st
+		}
+	}
+	if oldest != nil {
+		delete(s.statements, oldest.SQL)
+	}
+}
+
+// normalize collapses the whitespace of a statement, so statements differing
+// only by their layout share their statistics
+func normalize(statement string) string {
+	return strings.Join(strings.Fields(statement), " ")
+}
@@ -0,0 +1,89 @@
+package querylog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/infrastructure/db/querylog"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newQueryLog(t *testing.T, cfg config.DBConf) (*querylog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	log, err := logger.New(logger.Options{Level: "debug", Format: logger.FormatJSON, Output: &buf})
+	require.NoError(t, err)
+	return querylog.New(cfg, log), &buf
+}
+
+func trace(l *querylog.Logger, sql string, took time.Duration, rows int64, err error) {
+	l.Trace(context.Background(), time.Now().Add(-took), func() (string, int64) { return sql, rows }, err)
+}
+
+func TestLogger_LogsSlowAndFailedQueries(t *testing.T) {
+	l, buf := newQueryLog(t, config.DBConf{SlowQueryMs: 50})
+
+	trace(l, "SELECT * FROM companies WHERE id = 'a1'", time.Millisecond, 1, nil)
+	trace(l, "SELECT * FROM companies WHERE id = 'a2'", time.Millisecond, 0, gorm.ErrRecordNotFound)
+	assert.Empty(t, buf.String())
+
+	trace(l, "SELECT * FROM companies WHERE name = 'Acme'", 100*time.Millisecond, 3, nil)
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "Slow query", record["msg"])
+	assert.Equal(t, "SELECT * FROM companies WHERE name = ?", record["sql"])
+	assert.EqualValues(t, 3, record["rows"])
+	assert.Contains(t, record["caller"], "querylog_test.go")
+	assert.NotContains(t, buf.String(), "Acme")
+
+	buf.Reset()
+	trace(l, "INSERT INTO companies (name) VALUES ('Acme')", time.Millisecond, 0, errors.New("duplicate key"))
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "Query failed", record["msg"])
+	assert.Equal(t, "duplicate key", record["error"])
+}
+
+func TestLogger_Stats(t *testing.T) {
+	l, _ := newQueryLog(t, config.DBConf{SlowQueryMs: 50, QueryStatsSize: 2})
+
+	for _, id := range []string{"1", "2", "3"} {
+		trace(l, "SELECT *  FROM companies\n WHERE id = "+id, 10*time.Millisecond, 1, nil)
+	}
+	trace(l, "DELETE FROM companies WHERE id = 4", 60*time.Millisecond, 1, nil)
+
+	stats, err := l.Top(querylog.SortCalls, 0)
+	require.NoError(t, err)
+	require.Len(t, stats, 2)
+	assert.Equal(t, "SELECT * FROM companies WHERE id = ?", stats[0].SQL)
+	assert.EqualValues(t, 3, stats[0].Calls)
+	assert.EqualValues(t, 3, stats[0].Rows)
+	assert.InDelta(t, 10, stats[0].MeanMs, 1)
+	assert.EqualValues(t, 1, stats[1].Slow)
+
+	stats, err = l.Top(querylog.SortMax, 1)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.True(t, strings.HasPrefix(stats[0].SQL, "DELETE"))
+
+	// The least recently seen statement makes room for a new one
+	trace(l, "UPDATE companies SET name = 'x'", time.Millisecond, 1, nil)
+	stats, _ = l.Top(querylog.SortTotal, 0)
+	require.Len(t, stats, 2)
+	assert.Equal(t, "DELETE FROM companies WHERE id = ?", stats[0].SQL)
+	assert.Equal(t, "UPDATE companies SET name = ?", stats[1].SQL)
+
+	_, err = l.Top("rows", 0)
+	assert.Error(t, err)
+
+	l.Reset()
+	stats, _ = l.Top("", 0)
+	assert.Empty(t, stats)
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"expvar"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/infrastructure/server/handler"
+)
+
+var (
+	startedAt          = time.Now()
+	publishRuntimeOnce sync.Once
+)
+
+// NewAdminRouter builds the engine of the admin server: pprof under
+// /debug/pprof, expvar under /debug/vars and the admin handler routes, all
+// behind basic auth. public is served without auth, e.g. the metrics.
+func NewAdminRouter(adminHandler *handler.AdminHandler, username, password string, public map[string]gin.HandlerFunc) *gin.Engine {
+	publishRuntimeOnce.Do(func() {
+		expvar.Publish("runtime", expvar.Func(runtimeStats))
+	})
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	for path, h := range public {
+		router.GET(path, h)
+	}
+
+	private := router.Group("/", gin.BasicAuth(gin.Accounts{username: password}))
+	private.GET("/debug/pprof/*profile", pprofHandler)
+	private.POST("/debug/pprof/symbol", gin.WrapF(pprof.Symbol))
+	private.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	adminHandler.RegisterRoutes(private)
+	return router
+}
+
+// pprofHandler serves the pprof endpoints, pprof.Index serves the named profiles
+func pprofHandler(c *gin.Context) {
+	switch c.Param("profile") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request)
+	}
+}
+
+// runtimeStats complements the memstats published by expvar
+func runtimeStats() any {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return map[string]any{
+		"go_version":     runtime.Version(),
+		"goroutines":     runtime.NumGoroutine(),
+		"gomaxprocs":     runtime.GOMAXPROCS(0),
+		"num_cpu":        runtime.NumCPU(),
+		"num_gc":         mem.NumGC,
+		"heap_alloc":     mem.HeapAlloc,
+		"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+	}
+}
@@ -0,0 +1,97 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/infrastructure/db/querylog"
+	"github.com/innoglobe/xmgo/internal/infrastructure/server"
+	"github.com/innoglobe/xmgo/internal/infrastructure/server/handler"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAdminRouter(t *testing.T) (*gin.Engine, *logger.Logger) {
+	gin.SetMode(gin.TestMode)
+	log, err := logger.New(logger.Options{Level: "info"})
+	require.NoError(t, err)
+
+	api := gin.New()
+	api.GET("/api/companies/:id", func(*gin.Context) {})
+	cfg := &config.Config{
+		JWT:      config.JWTConf{Secret: "jwt-secret"},
+		Database: config.DBConf{User: "xmgo", Pass: "db-pass"},
+	}
+	adminHandler := handler.NewAdminHandler(func() *config.Config { return cfg }, log, api.Routes, querylog.New(config.DBConf{}, logger.Discard()))
+	public := map[string]gin.HandlerFunc{"/metrics": func(c *gin.Context) { c.String(http.StatusOK, "metrics") }}
+	return server.NewAdminRouter(adminHandler, "admin", "s3cret", public), log
+}
+
+func serve(router http.Handler, method, path, body string, auth bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if auth {
+		req.SetBasicAuth("admin", "s3cret")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminRouter_RequiresAuth(t *testing.T) {
+	router, _ := newAdminRouter(t)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(router, http.MethodGet, "/admin/config", "", false).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, http.MethodGet, "/debug/pprof/", "", false).Code)
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/debug/pprof/", "", true).Code)
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/metrics", "", false).Code)
+}
+
+func TestAdminRouter_LogLevel(t *testing.T) {
+	router, log := newAdminRouter(t)
+
+	w := serve(router, http.MethodPut, "/admin/loglevel", `{"level": "debug"}`, true)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level": "DEBUG"}`, w.Body.String())
+	assert.Equal(t, "DEBUG", log.Level())
+
+	assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodPut, "/admin/loglevel", `{"level": "loud"}`, true).Code)
+}
+
+func TestAdminRouter_ConfigAndRoutes(t *testing.T) {
+	router, _ := newAdminRouter(t)
+
+	w := serve(router, http.MethodGet, "/admin/config", "", true)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "jwt-secret")
+	assert.NotContains(t, w.Body.String(), "db-pass")
+	var cfg struct {
+		JWT      map[string]any `json:"jwt"`
+		Database map[string]any `json:"database"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &cfg))
+	assert.Equal(t, config.RedactedValue, cfg.JWT["secret"])
+	assert.Equal(t, config.RedactedValue, cfg.Database["pass"])
+	assert.Equal(t, "xmgo", cfg.Database["user"])
+
+	w = serve(router, http.MethodGet, "/admin/routes", "", true)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"path":"/api/companies/:id"`)
+}
+
+func TestAdminRouter_QueryStats(t *testing.T) {
+	router, _ := newAdminRouter(t)
+
+	w := serve(router, http.MethodGet, "/admin/queries?sort=mean&limit=10", "", true)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodGet, "/admin/queries?sort=rows", "", true).Code)
+	assert.Equal(t, http.StatusNoContent, serve(router, http.MethodDelete, "/admin/queries", "", true).Code)
+}
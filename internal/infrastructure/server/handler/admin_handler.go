@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/infrastructure/db/querylog"
+	"github.com/innoglobe/xmgo/pkg/httperr"
+)
+
+// LevelSetter changes the log level at runtime, it is satisfied by *logger.Logger
+type LevelSetter interface {
+	Level() string
+	SetLevel(level string) error
+}
+
+// QueryStats holds the statistics of the database statements, it is
+// satisfied by *querylog.Logger
+type QueryStats interface {
+	Top(by string, n int) ([]querylog.StatementStats, error)
+	Reset()
+}
+
+// AdminHandler serves the operational endpoints of the admin server
+type AdminHandler struct {
+	cfg     func() *config.Config
+	log     LevelSetter
+	routes  func() gin.RoutesInfo
+	queries QueryStats
+}
+
+// NewAdminHandler is a function that returns a new AdminHandler. cfg returns
+// the current config and routes lists the routes of the API server.
+func NewAdminHandler(cfg func() *config.Config, log LevelSetter, routes func() gin.RoutesInfo, queries QueryStats) *AdminHandler {
+	return &AdminHandler{cfg: cfg, log: log, routes: routes, queries: queries}
+}
+
+type LogLevelRequest struct {
+	Level string `json:"level" binding:"required,oneof=debug info warn error DEBUG INFO WARN ERROR"`
+}
+
+type LogLevelResponse struct {
+	Level string `json:"level"`
+}
+
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Handler string `json:"handler"`
+}
+
+// RegisterRoutes registers the admin routes
+func (h *AdminHandler) RegisterRoutes(r gin.IRoutes) {
+	r.GET("/admin/loglevel", h.GetLogLevel)
+	r.PUT("/admin/loglevel", h.SetLogLevel)
+	r.GET("/admin/config", h.GetConfig)
+	r.GET("/admin/routes", h.GetRoutes)
+	r.GET("/admin/queries", h.GetQueryStats)
+	r.DELETE("/admin/queries", h.ResetQueryStats)
+}
+
+// GetLogLevel returns the current log level
+func (h *AdminHandler) GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, LogLevelResponse{Level: h.log.Level()})
+}
+
+// SetLogLevel changes the log level until the next restart
+func (h *AdminHandler) SetLogLevel(c *gin.Context) {
+	var req LogLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if err := h.log.SetLevel(req.Level); err != nil {
+		c.JSON(http.StatusBadRequest, httperr.Body(c, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, LogLevelResponse{Level: h.log.Level()})
+}
+
+// GetConfig returns the effective config with the secrets redacted
+func (h *AdminHandler) GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, config.Redacted(h.cfg()))
+}
+
+// GetRoutes lists the routes of the API server
+func (h *AdminHandler) GetRoutes(c *gin.Context) {
+	routes := h.routes()
+	res := make([]RouteInfo, len(routes))
+	for i, route := range routes {
+		res[i] = RouteInfo{Method: route.Method, Path: route.Path, Handler: route.Handler}
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// GetQueryStats lists the statistics of the database statements, sorted by
+// total, mean or max duration, or by calls, and limited to limit statements
+func (h *AdminHandler) GetQueryStats(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, httperr.Body(c, "Invalid limit"))
+		return
+	}
+	stats, err := h.queries.Top(c.Query("sort"), limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httperr.Body(c, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// ResetQueryStats drops the statistics of the database statements
+func (h *AdminHandler) ResetQueryStats(c *gin.Context) {
+	h.queries.Reset()
+	c.Status(http.StatusNoContent)
+}
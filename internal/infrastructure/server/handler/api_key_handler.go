@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/middleware"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/innoglobe/xmgo/pkg/httperr"
+)
+
+// APIKeyHandler is a struct that contains the usecase for api keys
+type APIKeyHandler struct {
+	apiKeyUsecase usecase.APIKeyUsecaseInterface
+}
+
+// NewAPIKeyHandler is a function that returns a new APIKeyHandler
+func NewAPIKeyHandler(apiKeyUsecase usecase.APIKeyUsecaseInterface) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyUsecase: apiKeyUsecase,
+	}
+}
+
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name" binding:"required"`
+	Scopes     []string   `json:"scopes" binding:"required"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	AllowedIPs []string   `json:"allowed_ips"`
+}
+
+type CreateAPIKeyResponse struct {
+	// Key is the plaintext api key. It is only returned once.
+	Key    string         `json:"key"`
+	APIKey *entity.APIKey `json:"api_key"`
+}
+
+// RegisterRoutes registers the admin routes for api keys
+func (h *APIKeyHandler) RegisterRoutes(r *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
+	keyRoutes := r.Group("/api-keys")
+	keyRoutes.Use(authMiddleware, middleware.RequireAdmin())
+	{
+		keyRoutes.POST("/", h.CreateAPIKey)
+		keyRoutes.GET("/", h.ListAPIKeys)
+		keyRoutes.DELETE("/:id", h.RevokeAPIKey) // DELETE /api-keys/:id
+	}
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Create an API key for a machine-to-machine client. The key is only shown once.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body CreateAPIKeyRequest true "API key details"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/admin/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	key, raw, err := h.apiKeyUsecase.CreateAPIKey(c.Request.Context(), &entity.APIKey{
+		Name:       req.Name,
+		Scopes:     req.Scopes,
+		ExpiresAt:  req.ExpiresAt,
+		AllowedIPs: req.AllowedIPs,
+	})
+	if err != nil {
+		c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{Key: raw, APIKey: key})
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description List all API keys. Secrets are never returned.
+// @Tags api-keys
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} entity.APIKey
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/admin/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeyUsecase.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key by its ID
+// @Tags api-keys
+// @Produce json
+// @Security Bearer
+// @Param id path string true "API key ID"
+// @Success 204 {object} nil
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/admin/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httperr.Body(c, "Invalid id"))
+		return
+	}
+
+	if err := h.apiKeyUsecase.RevokeAPIKey(c.Request.Context(), id); err != nil {
+		c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -3,16 +3,26 @@ package handler
 import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/pkg/httperr"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 )
 
 type AuthHandler struct {
-	secretKey string
+	secretKey  string
+	adminUsers []string
+	throttler  *auth.LoginThrottler
 }
 
-func NewAuthHandler(secretKey string) *AuthHandler {
-	return &AuthHandler{secretKey: secretKey}
+// NewAuthHandler signs tokens with cfg.Secret. Only the users listed in
+// cfg.AdminUsers get the admin role.
+func NewAuthHandler(cfg config.JWTConf, throttler *auth.LoginThrottler) *AuthHandler {
+	return &AuthHandler{secretKey: cfg.Secret, adminUsers: cfg.AdminUsers, throttler: throttler}
 }
 
 type SignInRequest struct {
@@ -21,13 +31,15 @@ type SignInRequest struct {
 }
 
 type Claims struct {
-	Username string `json:"username"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"`
+	TenantID string   `json:"tenant_id,omitempty"`
 	jwt.StandardClaims
 }
 
 // SignIn godoc
 // @Summary Sign in
-// @Description Sign in to get a JWT token
+// @Description Sign in to get a JWT token. Repeated failures are throttled per username and per IP.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -35,35 +47,86 @@ type Claims struct {
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Header 401,429 {integer} Retry-After "Seconds to wait before the next attempt"
 // @Router /auth/signin [post]
 func (h *AuthHandler) SignIn(c *gin.Context) {
 	var req SignInRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		c.JSON(400, httperr.Body(c, err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if status := h.throttler.Check(ctx, req.Username, c.ClientIP()); status.RetryAfter > 0 {
+		setRetryAfter(c, status.RetryAfter)
+		msg := "Too many failed sign-in attempts, try again later"
+		if status.Locked {
+			msg = "Account temporarily locked due to too many failed sign-in attempts"
+		}
+		c.JSON(http.StatusTooManyRequests, httperr.Body(c, msg))
 		return
 	}
 
 	// Dummy demo/demo login
 	if req.Username != "demo" || req.Password != "demo" {
-		c.JSON(401, gin.H{"error": "Invalid credentials"})
+		if status := h.throttler.Failure(ctx, req.Username, c.ClientIP()); status.RetryAfter > 0 {
+			setRetryAfter(c, status.RetryAfter)
+		}
+		c.JSON(401, httperr.Body(c, "Invalid credentials"))
 		return
 	}
+	h.throttler.Success(ctx, req.Username)
 
 	expirationTime := time.Now().Add(24 * time.Hour)
 	claims := &Claims{
 		Username: req.Username,
 		StandardClaims: jwt.StandardClaims{
+			Subject:   req.Username,
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
 
+	if slices.Contains(h.adminUsers, req.Username) {
+		claims.Roles = []string{auth.RoleAdmin}
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(h.secretKey))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, httperr.Body(c, "Failed to generate token"))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"token": tokenString})
 }
+
+// UnlockUser godoc
+// @Summary Unlock a user
+// @Description Lift a sign-in lockout on a username before it expires
+// @Tags auth
+// @Produce json
+// @Security Bearer
+// @Param username path string true "Username"
+// @Success 204 {object} nil
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/lockouts/{username} [delete]
+func (h *AuthHandler) UnlockUser(c *gin.Context) {
+	var actor string
+	if id, ok := auth.FromContext(c.Request.Context()); ok {
+		actor = id.Subject
+	}
+
+	if !h.throttler.Unlock(c.Request.Context(), c.Param("username"), actor) {
+		c.JSON(http.StatusNotFound, httperr.Body(c, "User is not locked"))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func setRetryAfter(c *gin.Context, d time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
@@ -0,0 +1,77 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/audit"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/infrastructure/server/handler"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signIn(t *testing.T, cfg config.JWTConf) handler.Claims {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	throttler := auth.NewLoginThrottler(config.LoginConf{FreeAttempts: 3, LockoutThreshold: 10}, audit.NewLogAuditor(logger.Discard()))
+	router := gin.New()
+	router.POST("/auth/signin", handler.NewAuthHandler(cfg, throttler).SignIn)
+
+	body, _ := json.Marshal(handler.SignInRequest{Username: "demo", Password: "demo"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/signin", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var res map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	var claims handler.Claims
+	_, err := jwt.ParseWithClaims(res["token"], &claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(cfg.Secret), nil
+	})
+	require.NoError(t, err)
+	return claims
+}
+
+func TestAuthHandler_SignInIsNotAdminByDefault(t *testing.T) {
+	claims := signIn(t, config.JWTConf{Secret: "test-secret"})
+	assert.Equal(t, "demo", claims.Subject)
+	assert.Empty(t, claims.Roles)
+}
+
+func TestAuthHandler_SignInAdminUsers(t *testing.T) {
+	claims := signIn(t, config.JWTConf{Secret: "test-secret", AdminUsers: []string{"demo"}})
+	assert.Equal(t, []string{auth.RoleAdmin}, claims.Roles)
+}
+
+func TestAuthHandler_ThrottleIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	throttler := auth.NewLoginThrottler(config.LoginConf{FreeAttempts: 3, LockoutThreshold: 3}, audit.NewLogAuditor(logger.Discard()))
+	router := gin.New()
+	// No trusted proxies, the server.trusted_proxies default
+	require.NoError(t, router.SetTrustedProxies(nil))
+	router.POST("/auth/signin", handler.NewAuthHandler(config.JWTConf{Secret: "test-secret"}, throttler).SignIn)
+
+	signIn := func(username, password, forwardedFor string) int {
+		body, _ := json.Marshal(handler.SignInRequest{Username: username, Password: password})
+		req := httptest.NewRequest(http.MethodPost, "/auth/signin", bytes.NewReader(body))
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Every guess claims another address, all come from 192.0.2.1
+	for i, username := range []string{"alice", "bob", "carol"} {
+		require.Equal(t, http.StatusUnauthorized, signIn(username, "guess", fmt.Sprintf("198.51.100.%d", i)))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, signIn("demo", "demo", "198.51.100.9"), "the address of the connection is locked")
+}
@@ -1,13 +1,13 @@
 package handler
 
 import (
-	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
 	"github.com/innoglobe/xmgo/internal/entity"
 	"github.com/innoglobe/xmgo/internal/middleware"
 	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/innoglobe/xmgo/pkg/httperr"
 	"net/http"
 )
 
@@ -24,14 +24,21 @@ func NewCompanyHandler(companyUsecase usecase.CompanyUsecaseInterface) *CompanyH
 }
 
 // RegisterRoutes is a function that registers the routes for the company handler
-func (h *CompanyHandler) RegisterRoutes(r *gin.RouterGroup, secretKey string) {
+func (h *CompanyHandler) RegisterRoutes(r *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
 	companyRoutes := r.Group("/companies")
-	companyRoutes.Use(middleware.JWTAuthMiddleware(secretKey))
+	companyRoutes.Use(authMiddleware)
 	{
-		companyRoutes.POST("/", h.CreateCompany)
-		companyRoutes.PATCH("/:id", h.PatchCompany)   // PATCH /companies/:id
-		companyRoutes.DELETE("/:id", h.DeleteCompany) // DELETE /companies/:id
-		companyRoutes.GET("/:id", h.GetCompany)       // GET /companies/:id
+		read := middleware.RequireScope(auth.ScopeCompaniesRead)
+		write := middleware.RequireScope(auth.ScopeCompaniesWrite)
+		companyRoutes.POST("/", write, h.CreateCompany)
+		companyRoutes.GET("/", read, h.ListCompanies)
+		companyRoutes.PATCH("/:id", write, h.PatchCompany)   // PATCH /companies/:id
+		companyRoutes.DELETE("/:id", write, h.DeleteCompany) // DELETE /companies/:id
+		companyRoutes.GET("/:id", read, h.GetCompany)        // GET /companies/:id
+
+		companyRoutes.POST("/:id/grants", write, h.GrantAccess)            // POST /companies/:id/grants
+		companyRoutes.GET("/:id/grants", read, h.ListGrants)               // GET /companies/:id/grants
+		companyRoutes.DELETE("/:id/grants/:grantId", write, h.RevokeGrant) // DELETE /companies/:id/grants/:grantId
 	}
 }
 
@@ -51,20 +58,50 @@ func (h *CompanyHandler) CreateCompany(c *gin.Context) {
 
 	// Validate the request
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.handleValidationError(c, err)
+		handleValidationError(c, err)
 		//c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
 		return
 	}
 
 	res, err := h.companyUsecase.CreateCompany(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(h.getStatusCode(err), gin.H{"error": err.Error()})
+		c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
 		return
 	}
 
 	c.JSON(http.StatusCreated, res)
 }
 
+// ListCompanies godoc
+// @Summary List companies
+// @Description List the companies the caller owns or has been granted access to. Admins see every company.
+// @Tags companies
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Number of companies to skip"
+// @Success 200 {array} entity.Company
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/companies [get]
+func (h *CompanyHandler) ListCompanies(c *gin.Context) {
+	var page struct {
+		Limit  int `form:"limit" binding:"min=0"`
+		Offset int `form:"offset" binding:"min=0"`
+	}
+	if err := c.ShouldBindQuery(&page); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	companies, err := h.companyUsecase.ListCompanies(c.Request.Context(), page.Limit, page.Offset)
+	if err != nil {
+		c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, companies)
+}
+
 // GetCompany godoc
 // @Summary Get a company by ID
 // @Description Get details of a company by its ID
@@ -80,13 +117,13 @@ func (h *CompanyHandler) GetCompany(c *gin.Context) {
 	id := c.Param("id")
 	cid, err := uuid.Parse(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		c.JSON(http.StatusBadRequest, httperr.Body(c, "Invalid id"))
 		return
 	}
 
 	company, err := h.companyUsecase.GetCompany(c.Request.Context(), cid)
 	if err != nil {
-		c.JSON(h.getStatusCode(err), gin.H{"error": err.Error()})
+		c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
 		return
 	}
 
@@ -110,19 +147,19 @@ func (h *CompanyHandler) PatchCompany(c *gin.Context) {
 	id := c.Param("id")
 	cid, err := uuid.Parse(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		c.JSON(http.StatusBadRequest, httperr.Body(c, "Invalid id"))
 		return
 	}
 
 	var req entity.Company
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.handleValidationError(c, err)
+		handleValidationError(c, err)
 		return
 	}
 
 	res, err := h.companyUsecase.UpdateCompany(c.Request.Context(), cid, &req)
 	if err != nil {
-		c.JSON(h.getStatusCode(err), gin.H{"error": err.Error()})
+		c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
 		return
 	}
 
@@ -143,42 +180,112 @@ func (h *CompanyHandler) DeleteCompany(c *gin.Context) {
 	id := c.Param("id")
 	cid, err := uuid.Parse(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		c.JSON(http.StatusBadRequest, httperr.Body(c, "Invalid id"))
 		return
 	}
 
 	err = h.companyUsecase.DeleteCompany(c.Request.Context(), cid)
 	if err != nil {
-		c.JSON(h.getStatusCode(err), gin.H{"error": err.Error()})
+		c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
 		return
 	}
 
 	c.JSON(http.StatusNoContent, gin.H{"message": "Company deleted successfully"})
 }
 
-func (h *CompanyHandler) handleValidationError(c *gin.Context, err error) {
-	var ve validator.ValidationErrors
-	if errors.As(err, &ve) {
-		out := make([]map[string]string, len(ve))
-		for i, fe := range ve {
-			out[i] = map[string]string{
-				"field":   fe.Field(),
-				"message": fe.Error(),
-			}
-		}
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid input data",
-			"details": out,
-		})
-		return
-	}
-	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data", "details": err.Error()})
+// GrantAccess godoc
+// @Summary Grant access to a company
+// @Description Give a user or a group read or write access to a company. Only the owner or an admin can do this.
+// @Tags companies
+// @Accept json
+// @Produce json
+// @Param id path string true "Company ID"
+// @Param grant body entity.CompanyGrant true "Grant details"
+// @Success 201 {object} entity.CompanyGrant
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/companies/{id}/grants [post]
+func (h *CompanyHandler) GrantAccess(c *gin.Context) {
+	cid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httperr.Body(c, "Invalid id"))
+		return
+	}
+
+	var req entity.CompanyGrant
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	res, err := h.companyUsecase.GrantAccess(c.Request.Context(), cid, &req)
+	if err != nil {
+		c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+// ListGrants godoc
+// @Summary List the grants of a company
+// @Description List who has been granted access to a company. Only the owner or an admin can do this.
+// @Tags companies
+// @Produce json
+// @Param id path string true "Company ID"
+// @Success 200 {array} entity.CompanyGrant
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/companies/{id}/grants [get]
+func (h *CompanyHandler) ListGrants(c *gin.Context) {
+	cid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httperr.Body(c, "Invalid id"))
+		return
+	}
+
+	grants, err := h.companyUsecase.ListGrants(c.Request.Context(), cid)
+	if err != nil {
+		c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, grants)
 }
 
-func (h *CompanyHandler) getStatusCode(err interface{}) int {
-	if customErr, ok := err.(interface{ StatusCode() int }); ok {
-		return customErr.StatusCode()
+// RevokeGrant godoc
+// @Summary Revoke a grant
+// @Description Remove a grant from a company. Only the owner or an admin can do this.
+// @Tags companies
+// @Produce json
+// @Param id path string true "Company ID"
+// @Param grantId path string true "Grant ID"
+// @Success 204 {object} nil
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/companies/{id}/grants/{grantId} [delete]
+func (h *CompanyHandler) RevokeGrant(c *gin.Context) {
+	cid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httperr.Body(c, "Invalid id"))
+		return
+	}
+	gid, err := uuid.Parse(c.Param("grantId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httperr.Body(c, "Invalid grant id"))
+		return
+	}
+
+	if err := h.companyUsecase.RevokeGrant(c.Request.Context(), cid, gid); err != nil {
+		c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
+		return
 	}
 
-	return http.StatusInternalServerError
+	c.Status(http.StatusNoContent)
 }
@@ -7,9 +7,11 @@ import (
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/config"
 	"github.com/innoglobe/xmgo/internal/entity"
 	postgresrepository "github.com/innoglobe/xmgo/internal/infrastructure/db/postgres"
 	"github.com/innoglobe/xmgo/internal/infrastructure/server/handler"
+	"github.com/innoglobe/xmgo/internal/middleware"
 	eventservice "github.com/innoglobe/xmgo/internal/service"
 	"github.com/innoglobe/xmgo/internal/usecase"
 	"github.com/stretchr/testify/assert"
@@ -36,13 +38,14 @@ func setupRouter(dsn string) *gin.Engine {
 	}
 
 	repo := postgresrepository.NewPostgresRepository(db)
-	usecase := usecase.NewCompanyUsecase(repo, &eventservice.NoOpProducer{})
+	grantRepo := postgresrepository.NewCompanyGrantRepository(db)
+	usecase := usecase.NewCompanyUsecase(repo, grantRepo, &eventservice.NoOpProducer{}, config.EventsConf{})
 	companyHandler := handler.NewCompanyHandler(usecase)
 
 	r := gin.New()
 	gin.SetMode(gin.TestMode)
 	api := r.Group("/api")
-	companyHandler.RegisterRoutes(api, "test-secret")
+	companyHandler.RegisterRoutes(api, middleware.JWTAuthMiddleware("test-secret"))
 	return r
 }
 
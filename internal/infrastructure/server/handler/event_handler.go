@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/interface/repository"
+	"github.com/innoglobe/xmgo/internal/middleware"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/innoglobe/xmgo/pkg/checkpoint"
+	"github.com/innoglobe/xmgo/pkg/httperr"
+)
+
+// EventHandler is a struct that contains the usecase for republishing events.
+// It is an app.Worker: the republish jobs run for as long as the app does and
+// are cancelled and waited for on shutdown. Like the xmgo CLI, the jobs
+// checkpoint their progress in checkpointDir and resume from it.
+type EventHandler struct {
+	snapshotUsecase usecase.SnapshotUsecaseInterface
+	checkpointDir   string
+
+	mu      sync.Mutex
+	jobs    map[string]*republishJob // by tenant
+	ctx     context.Context
+	stop    context.CancelFunc
+	running sync.WaitGroup
+}
+
+// NewEventHandler is a function that returns a new EventHandler
+func NewEventHandler(snapshotUsecase usecase.SnapshotUsecaseInterface, checkpointDir string) *EventHandler {
+	ctx, stop := context.WithCancel(context.Background())
+	return &EventHandler{
+		snapshotUsecase: snapshotUsecase,
+		checkpointDir:   checkpointDir,
+		jobs:            make(map[string]*republishJob),
+		ctx:             ctx,
+		stop:            stop,
+	}
+}
+
+// Run waits for ctx to be done, then cancels the running republish jobs and
+// waits for them to stop, so they are over before the event producer closes
+func (h *EventHandler) Run(ctx context.Context) error {
+	<-ctx.Done()
+	h.mu.Lock()
+	h.stop()
+	h.mu.Unlock()
+	h.running.Wait()
+	return nil
+}
+
+type RepublishRequest struct {
+	// AfterID starts after the company with this ID instead of the checkpoint
+	AfterID      *uuid.UUID         `json:"after_id"`
+	Type         entity.CompanyType `json:"type"`
+	Registered   *bool              `json:"registered"`
+	UpdatedSince *time.Time         `json:"updated_since"`
+	// RatePerSecond limits the events published per second, 100 when unset, 0 is unlimited
+	RatePerSecond *int `json:"rate_per_second" binding:"omitempty,gte=0"`
+	// Reset ignores the checkpoint and starts from the first company
+	Reset  bool `json:"reset"`
+	DryRun bool `json:"dry_run"`
+}
+
+// RepublishStatus is the state of the latest republish of a tenant
+type RepublishStatus struct {
+	usecase.RepublishResult
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type republishJob struct {
+	status RepublishStatus
+	cancel context.CancelFunc
+}
+
+// RegisterRoutes registers the admin routes for events
+func (h *EventHandler) RegisterRoutes(r *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
+	eventRoutes := r.Group("/events")
+	eventRoutes.Use(authMiddleware, middleware.RequireAdmin())
+	{
+		eventRoutes.POST("/republish", h.Republish)
+		eventRoutes.GET("/republish", h.RepublishStatus)
+		eventRoutes.DELETE("/republish", h.CancelRepublish)
+	}
+}
+
+// Republish godoc
+// @Summary Republish company snapshots
+// @Description Publish a com.xmgo.company.snapshot event for every company of the tenant, or the filtered subset.
+// @Description A dry run answers with the number of matching companies, otherwise the republish runs in the background.
+// @Description Progress is checkpointed, a republish with the same filters resumes where the previous one stopped unless reset is set.
+// @Tags events
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body RepublishRequest true "Republish options"
+// @Success 200 {object} usecase.RepublishResult
+// @Success 202 {object} RepublishStatus
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /api/admin/events/republish [post]
+func (h *EventHandler) Republish(c *gin.Context) {
+	var req RepublishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if req.Type != "" {
+		if err := req.Type.IsValid(); err != nil {
+			c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
+			return
+		}
+	}
+
+	opts := usecase.RepublishOptions{
+		Filter: repository.CompanySnapshotFilter{
+			Type:       req.Type,
+			Registered: req.Registered,
+		},
+		RatePerSecond: usecase.DefaultRepublishRate,
+		DryRun:        req.DryRun,
+	}
+	if req.RatePerSecond != nil {
+		opts.RatePerSecond = *req.RatePerSecond
+	}
+	if req.AfterID != nil {
+		opts.Filter.AfterID = *req.AfterID
+	}
+	if req.UpdatedSince != nil {
+		opts.Filter.UpdatedSince = *req.UpdatedSince
+	}
+
+	// Each filter set of a tenant resumes from its own checkpoint
+	tenant := auth.TenantFromContext(c.Request.Context())
+	cp := checkpoint.NewFile(usecase.RepublishCheckpointPath(h.checkpointDir, tenant, opts.Filter))
+
+	if req.DryRun {
+		// Counts what a resumed republish would publish
+		if !req.Reset {
+			opts.Checkpoint = cp
+		}
+		res, err := h.snapshotUsecase.Republish(c.Request.Context(), opts)
+		if err != nil {
+			c.JSON(httperr.StatusCode(err), httperr.Body(c, err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, res)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ctx.Err() != nil {
+		c.JSON(http.StatusServiceUnavailable, httperr.Body(c, "The server is shutting down"))
+		return
+	}
+	if job, ok := h.jobs[tenant]; ok && job.status.Running {
+		c.JSON(http.StatusConflict, httperr.Body(c, "A republish is already running"))
+		return
+	}
+	if req.Reset {
+		if err := cp.Clear(); err != nil {
+			c.JSON(http.StatusInternalServerError, httperr.Body(c, "Failed to reset the checkpoint"))
+			return
+		}
+	}
+	opts.Checkpoint = cp
+
+	// The job outlives the request but keeps the caller's identity and tenant,
+	// it is cancelled when the app shuts down
+	ctx, cancel := context.WithCancel(context.WithoutCancel(c.Request.Context()))
+	stopWithApp := context.AfterFunc(h.ctx, cancel)
+	job := &republishJob{status: RepublishStatus{Running: true, StartedAt: time.Now()}, cancel: cancel}
+	h.jobs[tenant] = job
+	h.running.Add(1)
+
+	opts.Progress = func(res usecase.RepublishResult) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		job.status.RepublishResult = res
+	}
+	go func() {
+		defer h.running.Done()
+		defer stopWithApp()
+		defer cancel()
+		res, err := h.snapshotUsecase.Republish(ctx, opts)
+		if err == nil {
+			// Done, the next republish starts over
+			err = cp.Clear()
+		}
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		finished := time.Now()
+		job.status.RepublishResult = res
+		job.status.Running = false
+		job.status.FinishedAt = &finished
+		if err != nil {
+			job.status.Error = err.Error()
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, job.status)
+}
+
+// RepublishStatus godoc
+// @Summary Get the republish status
+// @Description Get the progress of the latest republish of the tenant
+// @Tags events
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} RepublishStatus
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/events/republish [get]
+func (h *EventHandler) RepublishStatus(c *gin.Context) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	job, ok := h.jobs[auth.TenantFromContext(c.Request.Context())]
+	if !ok {
+		c.JSON(http.StatusNotFound, httperr.Body(c, "No republish has been started"))
+		return
+	}
+	c.JSON(http.StatusOK, job.status)
+}
+
+// CancelRepublish godoc
+// @Summary Cancel the running republish
+// @Description Stop the running republish of the tenant. Starting it again with the same filters resumes from the checkpoint.
+// @Tags events
+// @Produce json
+// @Security Bearer
+// @Success 204 {object} nil
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/admin/events/republish [delete]
+func (h *EventHandler) CancelRepublish(c *gin.Context) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	job, ok := h.jobs[auth.TenantFromContext(c.Request.Context())]
+	if !ok || !job.status.Running {
+		c.JSON(http.StatusNotFound, httperr.Body(c, "No republish is running"))
+		return
+	}
+	job.cancel()
+	c.Status(http.StatusNoContent)
+}
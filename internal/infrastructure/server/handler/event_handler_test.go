@@ -0,0 +1,176 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/infrastructure/server/handler"
+	"github.com/innoglobe/xmgo/internal/interface/repository"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/innoglobe/xmgo/pkg/checkpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingSnapshots republishes until its context is cancelled
+type blockingSnapshots struct {
+	started chan context.Context
+}
+
+func (s *blockingSnapshots) Republish(ctx context.Context, opts usecase.RepublishOptions) (usecase.RepublishResult, error) {
+	if opts.DryRun {
+		return usecase.RepublishResult{DryRun: true}, nil
+	}
+	s.started <- ctx
+	<-ctx.Done()
+	return usecase.RepublishResult{Published: 3}, ctx.Err()
+}
+
+// checkpointingSnapshots publishes one company, checkpoints it and fails with err
+type checkpointingSnapshots struct {
+	err  error
+	opts chan usecase.RepublishOptions
+}
+
+func (s *checkpointingSnapshots) Republish(_ context.Context, opts usecase.RepublishOptions) (usecase.RepublishResult, error) {
+	s.opts <- opts
+	if opts.DryRun {
+		return usecase.RepublishResult{Matched: 1, DryRun: true}, nil
+	}
+	res := usecase.RepublishResult{Matched: 1, Published: 1, LastID: uuid.New()}
+	if err := opts.Checkpoint.Save(res.LastID.String()); err != nil {
+		return res, err
+	}
+	return res, s.err
+}
+
+func eventRouter(h *handler.EventHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	asAdmin := func(c *gin.Context) {
+		id := &auth.Identity{Subject: "alice", Roles: []string{auth.RoleAdmin}, TenantID: "acme"}
+		c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), id))
+	}
+	h.RegisterRoutes(router.Group("/api/admin"), asAdmin)
+	return router
+}
+
+func republish(t *testing.T, router *gin.Engine, method string) *httptest.ResponseRecorder {
+	return republishWith(t, router, method, `{}`)
+}
+
+func republishWith(t *testing.T, router *gin.Engine, method, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, "/api/admin/events/republish", strings.NewReader(body)))
+	return w
+}
+
+// finished waits for the republish to be over and returns its status
+func finished(t *testing.T, router *gin.Engine) handler.RepublishStatus {
+	t.Helper()
+	var status handler.RepublishStatus
+	require.Eventually(t, func() bool {
+		status = handler.RepublishStatus{}
+		_ = json.Unmarshal(republish(t, router, http.MethodGet).Body.Bytes(), &status)
+		return status.FinishedAt != nil
+	}, time.Second, 10*time.Millisecond)
+	return status
+}
+
+func TestEventHandler_RepublishOutlivesTheRequest(t *testing.T) {
+	snapshots := &blockingSnapshots{started: make(chan context.Context, 1)}
+	h := handler.NewEventHandler(snapshots, t.TempDir())
+	router := eventRouter(h)
+
+	require.Equal(t, http.StatusAccepted, republish(t, router, http.MethodPost).Code)
+	ctx := <-snapshots.started
+	assert.NoError(t, ctx.Err(), "the job keeps running once the request is over")
+	id, ok := auth.FromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, "acme", id.TenantID)
+
+	assert.Equal(t, http.StatusConflict, republish(t, router, http.MethodPost).Code)
+	assert.Equal(t, http.StatusNoContent, republish(t, router, http.MethodDelete).Code)
+	assert.Eventually(t, func() bool {
+		var status handler.RepublishStatus
+		_ = json.Unmarshal(republish(t, router, http.MethodGet).Body.Bytes(), &status)
+		return !status.Running && status.Error == context.Canceled.Error()
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestEventHandler_ShutdownStopsRepublish(t *testing.T) {
+	snapshots := &blockingSnapshots{started: make(chan context.Context, 1)}
+	h := handler.NewEventHandler(snapshots, t.TempDir())
+	router := eventRouter(h)
+
+	appCtx, shutdown := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- h.Run(appCtx) }()
+
+	require.Equal(t, http.StatusAccepted, republish(t, router, http.MethodPost).Code)
+	ctx := <-snapshots.started
+
+	// Run returns once the running job has stopped
+	shutdown()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return on shutdown")
+	}
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	var status handler.RepublishStatus
+	require.NoError(t, json.Unmarshal(republish(t, router, http.MethodGet).Body.Bytes(), &status))
+	assert.False(t, status.Running)
+	assert.Equal(t, 3, status.Published)
+
+	// No new job starts while shutting down
+	assert.Equal(t, http.StatusServiceUnavailable, republish(t, router, http.MethodPost).Code)
+}
+
+func TestEventHandler_RepublishRateAndCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	snapshots := &checkpointingSnapshots{err: errors.New("broker down"), opts: make(chan usecase.RepublishOptions, 1)}
+	router := eventRouter(handler.NewEventHandler(snapshots, dir))
+
+	// The rate defaults to the one of the CLI
+	require.Equal(t, http.StatusAccepted, republish(t, router, http.MethodPost).Code)
+	opts := <-snapshots.opts
+	assert.Equal(t, usecase.DefaultRepublishRate, opts.RatePerSecond)
+	status := finished(t, router)
+	assert.Equal(t, "broker down", status.Error)
+
+	// The failed republish left its checkpoint for the next one
+	cp := checkpoint.NewFile(usecase.RepublishCheckpointPath(dir, "acme", repository.CompanySnapshotFilter{}))
+	saved, err := cp.Load()
+	require.NoError(t, err)
+	assert.Equal(t, status.LastID.String(), saved)
+
+	// A dry run counts from the checkpoint, unless reset
+	require.Equal(t, http.StatusOK, republishWith(t, router, http.MethodPost, `{"dry_run": true}`).Code)
+	assert.Equal(t, cp, (<-snapshots.opts).Checkpoint)
+	require.Equal(t, http.StatusOK, republishWith(t, router, http.MethodPost, `{"dry_run": true, "reset": true}`).Code)
+	assert.Nil(t, (<-snapshots.opts).Checkpoint)
+
+	// An explicit 0 is unlimited, and a complete republish clears the checkpoint
+	snapshots.err = nil
+	require.Equal(t, http.StatusAccepted, republishWith(t, router, http.MethodPost, `{"rate_per_second": 0}`).Code)
+	assert.Zero(t, (<-snapshots.opts).RatePerSecond)
+	assert.Empty(t, finished(t, router).Error)
+	saved, err = cp.Load()
+	require.NoError(t, err)
+	assert.Empty(t, saved)
+
+	assert.Equal(t, http.StatusBadRequest, republishWith(t, router, http.MethodPost, `{"rate_per_second": -1}`).Code)
+}
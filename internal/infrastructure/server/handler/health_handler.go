@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/health"
+)
+
+// HealthHandler serves the liveness and readiness probes
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+// NewHealthHandler is a function that returns a new HealthHandler
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// RegisterRoutes registers the probes, they need no authentication
+func (h *HealthHandler) RegisterRoutes(r gin.IRoutes) {
+	r.GET("/healthz", h.Liveness)
+	r.GET("/readyz", h.Readiness)
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description Always 200 while the process serves requests, with the latest dependency checks for information.
+// @Description The checks are never run for this probe.
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Router /healthz [get]
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, h.checker.Liveness())
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Description 200 when the database, its migrations and Kafka are up, 503 otherwise or while shutting down.
+// @Description Check results are cached for health.cache_ttl_ms.
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report, ready := h.checker.Readiness(c.Request.Context())
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/innoglobe/xmgo/pkg/httperr"
+	"net/http"
+)
+
+// handleValidationError reports binding errors field by field
+func handleValidationError(c *gin.Context, err error) {
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		out := make([]map[string]string, len(ve))
+		for i, fe := range ve {
+			out[i] = map[string]string{
+				"field":   fe.Field(),
+				"message": fe.Error(),
+			}
+		}
+		body := httperr.Body(c, "Invalid input data")
+		body["details"] = out
+		c.JSON(http.StatusBadRequest, body)
+		return
+	}
+	body := httperr.Body(c, "Invalid input data")
+	body["details"] = err.Error()
+	c.JSON(http.StatusBadRequest, body)
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const httpWorkerShutdownTimeout = 5 * time.Second
+
+// HTTPWorker serves a handler on its own listener for as long as the app runs,
+// e.g. the metrics on a port that isn't exposed publicly. It is an app.Worker.
+type HTTPWorker struct {
+	server *http.Server
+}
+
+func NewHTTPWorker(addr string, handler http.Handler) *HTTPWorker {
+	return &HTTPWorker{server: &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}}
+}
+
+// Addr is the address the worker listens on
+func (w *HTTPWorker) Addr() string {
+	return w.server.Addr
+}
+
+// Run serves until ctx is done, then shuts the server down gracefully
+func (w *HTTPWorker) Run(ctx context.Context) error {
+	failed := make(chan error, 1)
+	go func() {
+		if err := w.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		return fmt.Errorf("failed to serve on %s: %w", w.server.Addr, err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpWorkerShutdownTimeout)
+		defer cancel()
+		return w.server.Shutdown(shutdownCtx)
+	}
+}
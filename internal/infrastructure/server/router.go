@@ -1,30 +1,59 @@
 package server
 
 import (
+	"io/fs"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/docs/events"
 	"github.com/innoglobe/xmgo/internal/infrastructure/server/handler"
+	"github.com/innoglobe/xmgo/internal/middleware"
 )
 
 type RouterInterface interface {
-	RegisterRoutes(secretKey string) *gin.Engine
+	RegisterRoutes(authMiddleware gin.HandlerFunc, middlewares ...gin.HandlerFunc) *gin.Engine
 }
 
 type Router struct {
 	companyHandler *handler.CompanyHandler
 	authHandler    *handler.AuthHandler
+	apiKeyHandler  *handler.APIKeyHandler
+	eventHandler   *handler.EventHandler
+	healthHandler  *handler.HealthHandler
 }
 
-func NewRouter(companyHandler *handler.CompanyHandler, authHandler *handler.AuthHandler) *Router {
+func NewRouter(companyHandler *handler.CompanyHandler, authHandler *handler.AuthHandler, apiKeyHandler *handler.APIKeyHandler, eventHandler *handler.EventHandler, healthHandler *handler.HealthHandler) *Router {
 	return &Router{
 		companyHandler: companyHandler,
 		authHandler:    authHandler,
+		apiKeyHandler:  apiKeyHandler,
+		eventHandler:   eventHandler,
+		healthHandler:  healthHandler,
 	}
 }
 
-func (r *Router) RegisterRoutes(secretKey string) *gin.Engine {
-	router := gin.Default()
+// RegisterRoutes builds the engine. middlewares run before every route, ahead
+// of authMiddleware. Requests are only logged by the middlewares, such as
+// middleware.AccessLog.
+func (r *Router) RegisterRoutes(authMiddleware gin.HandlerFunc, middlewares ...gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	// Probes are registered ahead of the middlewares, so they don't flood the traces
+	r.healthHandler.RegisterRoutes(router)
+	router.Use(middlewares...)
 	api := router.Group("/api")
-	r.companyHandler.RegisterRoutes(api, secretKey)
+	r.companyHandler.RegisterRoutes(api, authMiddleware)
+	admin := api.Group("/admin")
+	r.apiKeyHandler.RegisterRoutes(admin, authMiddleware)
+	r.eventHandler.RegisterRoutes(admin, authMiddleware)
+	admin.DELETE("/lockouts/:username", authMiddleware, middleware.RequireAdmin(), r.authHandler.UnlockUser)
+
+	// The AsyncAPI document and the JSON Schemas referenced by the dataschema of events
+	schemas, _ := fs.Sub(events.FS, "schemas")
+	router.StaticFS("/schemas/events", http.FS(schemas))
+	router.GET("/asyncapi.json", func(c *gin.Context) {
+		c.FileFromFS("asyncapi.json", http.FS(events.FS))
+	})
 
 	authRoutes := router.Group("/auth")
 	// For the shake of simplicity put the route inline
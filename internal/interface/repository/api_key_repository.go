@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/entity"
+)
+
+type APIKeyRepositoryInterface interface {
+	Create(ctx context.Context, key *entity.APIKey) (*entity.APIKey, error)
+	List(ctx context.Context) ([]entity.APIKey, error)
+	GetByPrefix(ctx context.Context, prefix string) (*entity.APIKey, error)
+	Revoke(ctx context.Context, id uuid.UUID, at time.Time) error
+	TouchLastUsed(ctx context.Context, id uuid.UUID, at time.Time) error
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/entity"
+)
+
+type CompanyGrantRepositoryInterface interface {
+	// Save creates the grant or updates the permission of an existing grant for the same principal
+	Save(ctx context.Context, grant *entity.CompanyGrant) (*entity.CompanyGrant, error)
+	List(ctx context.Context, companyID uuid.UUID) ([]entity.CompanyGrant, error)
+	Delete(ctx context.Context, companyID uuid.UUID, grantID uuid.UUID) error
+	// FindForViewer returns the grants on a company held by the viewer or one of their groups
+	FindForViewer(ctx context.Context, companyID uuid.UUID, viewer CompanyViewer) ([]entity.CompanyGrant, error)
+}
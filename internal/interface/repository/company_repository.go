@@ -2,13 +2,44 @@ package repository
 
 import (
 	"context"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/innoglobe/xmgo/internal/entity"
 )
 
+// CompanyViewer restricts a listing to the companies a caller can see:
+// the ones they own and the ones granted to them or to one of their groups
+type CompanyViewer struct {
+	Subject string
+	Groups  []string
+}
+
+// CompanyListFilter narrows down a company listing. A nil Viewer lists every company.
+type CompanyListFilter struct {
+	Viewer *CompanyViewer
+	Limit  int
+	Offset int
+}
+
+// CompanySnapshotFilter selects a page of companies ordered by ID, for
+// walking through all of them. Pass the last ID of a page as AfterID to get
+// the next one. Empty fields don't filter.
+type CompanySnapshotFilter struct {
+	AfterID      uuid.UUID
+	Type         entity.CompanyType
+	Registered   *bool
+	UpdatedSince time.Time
+	Limit        int
+}
+
 type CompanyRepositoryInterface interface {
 	Create(ctx context.Context, company *entity.Company) (*entity.Company, error)
-	Update(ctx context.Context, id uuid.UUID, company *entity.Company) (*entity.Company, error)
+	// Update applies the non-zero fields of company and returns the record as
+	// it was before and after, both read within the update transaction
+	Update(ctx context.Context, id uuid.UUID, company *entity.Company) (before, after *entity.Company, err error)
 	Delete(ctx context.Context, id uuid.UUID) error
 	Get(ctx context.Context, id uuid.UUID) (*entity.Company, error)
+	List(ctx context.Context, filter CompanyListFilter) ([]entity.Company, error)
+	Snapshot(ctx context.Context, filter CompanySnapshotFilter) ([]entity.Company, error)
 }
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/usecase"
+)
+
+// Company changes
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// companyUsecase counts the company changes saved by the wrapped usecase
+type companyUsecase struct {
+	usecase.CompanyUsecaseInterface
+	metrics *Metrics
+}
+
+// InstrumentCompanyUsecase wraps u so the companies it creates, updates and
+// deletes are counted, whether the change came through the API or a command.
+// A change counts once it is saved, even when its event isn't delivered.
+func (m *Metrics) InstrumentCompanyUsecase(u usecase.CompanyUsecaseInterface) usecase.CompanyUsecaseInterface {
+	for _, change := range []string{ChangeCreated, ChangeUpdated, ChangeDeleted} {
+		m.companyChanges.WithLabelValues(change)
+	}
+	return &companyUsecase{CompanyUsecaseInterface: u, metrics: m}
+}
+
+func (u *companyUsecase) CreateCompany(ctx context.Context, company *entity.Company) (*entity.Company, error) {
+	res, err := u.CompanyUsecaseInterface.CreateCompany(ctx, company)
+	if saved(err) {
+		u.metrics.companyChanges.WithLabelValues(ChangeCreated).Inc()
+	}
+	return res, err
+}
+
+func (u *companyUsecase) UpdateCompany(ctx context.Context, id uuid.UUID, company *entity.Company) (*entity.Company, error) {
+	res, err := u.CompanyUsecaseInterface.UpdateCompany(ctx, id, company)
+	if saved(err) {
+		u.metrics.companyChanges.WithLabelValues(ChangeUpdated).Inc()
+	}
+	return res, err
+}
+
+func (u *companyUsecase) DeleteCompany(ctx context.Context, id uuid.UUID) error {
+	err := u.CompanyUsecaseInterface.DeleteCompany(ctx, id)
+	if saved(err) {
+		u.metrics.companyChanges.WithLabelValues(ChangeDeleted).Inc()
+	}
+	return err
+}
+
+// saved tells whether a change that returned err reached the database
+func saved(err error) bool {
+	var deliveryErr *customerrors.EventDeliveryError
+	return err == nil || errors.As(err, &deliveryErr)
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"sync"
+
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// KafkaStatsProvider is implemented by eventservice.KafkaProducer
+type KafkaStatsProvider interface {
+	Stats() eventservice.KafkaProducerStats
+}
+
+// RegisterProducer exports the statistics of the Kafka producers among
+// producer, looking into fan-out producers. Other backends have no metrics.
+func (m *Metrics) RegisterProducer(producer eventservice.Producer) error {
+	switch p := producer.(type) {
+	case KafkaStatsProvider:
+		return m.Registry.Register(newKafkaCollector(p))
+	case interface {
+		Producers() []eventservice.Producer
+	}:
+		for _, child := range p.Producers() {
+			if err := m.RegisterProducer(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	kafkaProducedDesc      = kafkaDesc("producer_produced_total", "Events written to Kafka.")
+	kafkaFailedDesc        = kafkaDesc("producer_failed_total", "Events that failed all retries and were spooled.")
+	kafkaDroppedDesc       = kafkaDesc("producer_dropped_total", "Events rejected because the queue was full.")
+	kafkaInFlightDesc      = kafkaDesc("producer_in_flight", "Events accepted and not delivered yet.")
+	kafkaQueueDepthDesc    = kafkaDesc("producer_queue_depth", "Events waiting in the producer queues.")
+	kafkaQueueCapacityDesc = kafkaDesc("producer_queue_capacity", "Capacity of the producer queues.")
+	kafkaWritesDesc        = kafkaDesc("writer_writes_total", "Write requests sent to the brokers.")
+	kafkaMessagesDesc      = kafkaDesc("writer_messages_total", "Messages written by the writer.")
+	kafkaBytesDesc         = kafkaDesc("writer_bytes_total", "Bytes written by the writer.")
+	kafkaErrorsDesc        = kafkaDesc("writer_errors_total", "Write errors of the writer.")
+	kafkaRetriesDesc       = kafkaDesc("writer_retries_total", "Write retries of the writer.")
+)
+
+func kafkaDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(Namespace, "kafka", name), help, nil, nil)
+}
+
+// kafkaCollector reads the producer statistics at scrape time. The writer
+// statistics are deltas since the previous read, so they are summed up here.
+type kafkaCollector struct {
+	producer KafkaStatsProvider
+
+	mu                                       sync.Mutex
+	writes, messages, bytes, errors, retries int64
+}
+
+func newKafkaCollector(producer KafkaStatsProvider) *kafkaCollector {
+	return &kafkaCollector{producer: producer}
+}
+
+func (c *kafkaCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		kafkaProducedDesc, kafkaFailedDesc, kafkaDroppedDesc, kafkaInFlightDesc, kafkaQueueDepthDesc,
+		kafkaQueueCapacityDesc, kafkaWritesDesc, kafkaMessagesDesc, kafkaBytesDesc, kafkaErrorsDesc, kafkaRetriesDesc,
+	} {
+		ch <- d
+	}
+}
+
+func (c *kafkaCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	stats := c.producer.Stats()
+	c.writes += stats.Writer.Writes
+	c.messages += stats.Writer.Messages
+	c.bytes += stats.Writer.Bytes
+	c.errors += stats.Writer.Errors
+	c.retries += stats.Writer.Retries
+	writes, messages, bytes, errors, retries := c.writes, c.messages, c.bytes, c.errors, c.retries
+	c.mu.Unlock()
+
+	counter := func(d *prometheus.Desc, v int64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v))
+	}
+	gauge := func(d *prometheus.Desc, v int64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, float64(v))
+	}
+	counter(kafkaProducedDesc, stats.Produced)
+	counter(kafkaFailedDesc, stats.Failed)
+	counter(kafkaDroppedDesc, stats.Dropped)
+	gauge(kafkaInFlightDesc, stats.InFlight)
+	gauge(kafkaQueueDepthDesc, int64(stats.QueueDepth))
+	gauge(kafkaQueueCapacityDesc, int64(stats.QueueCapacity))
+	counter(kafkaWritesDesc, writes)
+	counter(kafkaMessagesDesc, messages)
+	counter(kafkaBytesDesc, bytes)
+	counter(kafkaErrorsDesc, errors)
+	counter(kafkaRetriesDesc, retries)
+}
@@ -0,0 +1,119 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/metrics"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGinMiddleware_LabelsByRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := metrics.New()
+	router := gin.New()
+	router.Use(m.GinMiddleware())
+	router.GET("/api/companies/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, path := range []string{"/api/companies/1", "/api/companies/2", "/nope"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expected := `
+# HELP xmgo_http_requests_total HTTP requests by method, route and status code.
+# TYPE xmgo_http_requests_total counter
+xmgo_http_requests_total{method="GET",route="/api/companies/:id",status="204"} 2
+xmgo_http_requests_total{method="GET",route="unmatched",status="404"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(m.Registry, strings.NewReader(expected), "xmgo_http_requests_total"))
+}
+
+type fakeCompanyUsecase struct {
+	usecase.CompanyUsecaseInterface
+	err error
+}
+
+func (u *fakeCompanyUsecase) CreateCompany(_ context.Context, company *entity.Company) (*entity.Company, error) {
+	return company, u.err
+}
+
+func (u *fakeCompanyUsecase) DeleteCompany(context.Context, uuid.UUID) error {
+	return u.err
+}
+
+func TestInstrumentCompanyUsecase_CountsSavedChanges(t *testing.T) {
+	m := metrics.New()
+	fake := &fakeCompanyUsecase{}
+	companies := m.InstrumentCompanyUsecase(fake)
+
+	_, err := companies.CreateCompany(context.Background(), &entity.Company{})
+	require.NoError(t, err)
+	require.NoError(t, companies.DeleteCompany(context.Background(), uuid.New()))
+	fake.err = errors.New("boom")
+	_, err = companies.CreateCompany(context.Background(), &entity.Company{})
+	require.Error(t, err)
+	// Saved, only the event is missing
+	fake.err = &customerrors.EventDeliveryError{Msg: "queue full"}
+	_, err = companies.CreateCompany(context.Background(), &entity.Company{})
+	require.Error(t, err)
+
+	expected := `
+# HELP xmgo_company_changes_total Companies created, updated and deleted.
+# TYPE xmgo_company_changes_total counter
+xmgo_company_changes_total{change="created"} 2
+xmgo_company_changes_total{change="deleted"} 1
+xmgo_company_changes_total{change="updated"} 0
+`
+	assert.NoError(t, testutil.GatherAndCompare(m.Registry, strings.NewReader(expected), "xmgo_company_changes_total"))
+}
+
+type fakeKafkaProducer struct {
+	eventservice.NoOpProducer
+	stats eventservice.KafkaProducerStats
+}
+
+func (p *fakeKafkaProducer) Stats() eventservice.KafkaProducerStats {
+	return p.stats
+}
+
+func TestRegisterProducer_SumsWriterDeltas(t *testing.T) {
+	m := metrics.New()
+	kafkaProducer := &fakeKafkaProducer{stats: eventservice.KafkaProducerStats{
+		Produced: 5,
+		InFlight: 2,
+		Writer:   kafka.WriterStats{Messages: 3},
+	}}
+	require.NoError(t, m.RegisterProducer(eventservice.NewFanOutProducer(&eventservice.NoOpProducer{}, kafkaProducer)))
+
+	// Every scrape sees the writer messages written since the previous one
+	_, err := m.Registry.Gather()
+	require.NoError(t, err)
+	kafkaProducer.stats.Writer.Messages = 4
+
+	expected := `
+# HELP xmgo_kafka_producer_in_flight Events accepted and not delivered yet.
+# TYPE xmgo_kafka_producer_in_flight gauge
+xmgo_kafka_producer_in_flight 2
+# HELP xmgo_kafka_producer_produced_total Events written to Kafka.
+# TYPE xmgo_kafka_producer_produced_total counter
+xmgo_kafka_producer_produced_total 5
+# HELP xmgo_kafka_writer_messages_total Messages written by the writer.
+# TYPE xmgo_kafka_writer_messages_total counter
+xmgo_kafka_writer_messages_total 7
+`
+	assert.NoError(t, testutil.GatherAndCompare(m.Registry, strings.NewReader(expected),
+		"xmgo_kafka_producer_in_flight", "xmgo_kafka_producer_produced_total", "xmgo_kafka_writer_messages_total"))
+}
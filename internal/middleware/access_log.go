@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/innoglobe/xmgo/pkg/requestid"
+)
+
+// Access log formats
+const (
+	AccessLogJSON     = "json"
+	AccessLogCommon   = "common"
+	AccessLogCombined = "combined"
+)
+
+const (
+	defaultSlowThreshold = time.Second
+	// maxLoggedBody bounds the part of a request body read for the log
+	maxLoggedBody = 4096
+	redacted      = "[REDACTED]"
+	clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+// redactedHeaders carry credentials, they are never logged in clear
+var redactedHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"X-Api-Key":     true,
+}
+
+type accessLogger struct {
+	format     string
+	out        io.Writer
+	outMu      sync.Mutex
+	json       logger.LoggerInterface
+	sampleRate float64
+	slow       time.Duration
+	exclude    map[string]bool
+	logHeaders bool
+	logBody    bool
+	redact     map[string]bool
+}
+
+// AccessLog logs every request once it is served, in the json format through
+// a JSON logger, or as common or combined log format lines. Excluded paths are
+// never logged, other requests are sampled unless they failed or were slow.
+// Credentials headers and the password and configured body fields are redacted.
+func AccessLog(cfg config.AccessLogConf) (gin.HandlerFunc, error) {
+	out, err := accessLogOutput(cfg.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &accessLogger{
+		format:     strings.ToLower(cfg.Format),
+		out:        out,
+		sampleRate: 1,
+		slow:       defaultSlowThreshold,
+		exclude:    make(map[string]bool, len(cfg.ExcludePaths)),
+		logHeaders: cfg.LogHeaders,
+		logBody:    cfg.LogBody,
+		redact:     map[string]bool{"password": true},
+	}
+	// Left unset, every request is logged
+	if cfg.SampleRate != nil {
+		a.sampleRate = *cfg.SampleRate
+	}
+	if cfg.SlowThresholdMs > 0 {
+		a.slow = time.Duration(cfg.SlowThresholdMs) * time.Millisecond
+	}
+	for _, path := range cfg.ExcludePaths {
+		a.exclude[path] = true
+	}
+	for _, field := range cfg.RedactFields {
+		a.redact[strings.ToLower(field)] = true
+	}
+
+	switch a.format {
+	case "", AccessLogJSON:
+		a.format = AccessLogJSON
+		if a.json, err = logger.New(logger.Options{Format: logger.FormatJSON, Output: out}); err != nil {
+			return nil, err
+		}
+	case AccessLogCommon, AccessLogCombined:
+	default:
+		return nil, fmt.Errorf("invalid access log format %q, expected json, common or combined", cfg.Format)
+	}
+	return a.handle, nil
+}
+
+func accessLogOutput(output string) (io.Writer, error) {
+	switch output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	default:
+		return os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	}
+}
+
+func (a *accessLogger) handle(c *gin.Context) {
+	if a.exclude[c.Request.URL.Path] {
+		c.Next()
+		return
+	}
+
+	var body []byte
+	if a.logBody && a.format == AccessLogJSON && c.Request.Body != nil {
+		body, _ = io.ReadAll(io.LimitReader(c.Request.Body, maxLoggedBody))
+		c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(body), c.Request.Body), c.Request.Body}
+	}
+
+	start := time.Now()
+	c.Next()
+	latency := time.Since(start)
+
+	status := c.Writer.Status()
+	slow := latency >= a.slow
+	if status < http.StatusInternalServerError && !slow && rand.Float64() >= a.sampleRate {
+		return
+	}
+
+	if a.format == AccessLogJSON {
+		a.logJSON(c, latency, slow, body)
+		return
+	}
+	a.logLine(c, start)
+}
+
+func (a *accessLogger) logJSON(c *gin.Context, latency time.Duration, slow bool, body []byte) {
+	req := c.Request
+	args := []any{
+		"method", req.Method,
+		"path", req.URL.Path,
+		"query", req.URL.RawQuery,
+		"status", c.Writer.Status(),
+		"latency_ms", float64(latency.Microseconds()) / 1000,
+		"bytes", max(c.Writer.Size(), 0),
+		"client_ip", c.ClientIP(),
+		"user_agent", req.UserAgent(),
+		"referer", req.Referer(),
+	}
+	if id := requestid.FromContext(req.Context()); id != "" {
+		args = append(args, "request_id", id)
+	}
+	if id, ok := auth.FromContext(req.Context()); ok {
+		args = append(args, "user", id.Subject)
+	}
+	if slow {
+		args = append(args, "slow", true)
+	}
+	if a.logHeaders {
+		args = append(args, "headers", a.headers(req.Header))
+	}
+	if len(body) > 0 {
+		args = append(args, "body", a.body(body))
+	}
+
+	switch {
+	case c.Writer.Status() >= http.StatusInternalServerError:
+		a.json.Error("request", args...)
+	case slow:
+		a.json.Warn("request", args...)
+	default:
+		a.json.Info("request", args...)
+	}
+}
+
+// logLine writes a common or combined log format line
+func (a *accessLogger) logLine(c *gin.Context, start time.Time) {
+	req := c.Request
+	user := "-"
+	if id, ok := auth.FromContext(req.Context()); ok && id.Subject != "" {
+		user = id.Subject
+	}
+	size := "-"
+	if c.Writer.Size() > 0 {
+		size = fmt.Sprint(c.Writer.Size())
+	}
+
+	line := fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		c.ClientIP(), user, start.Format(clfTimeFormat), req.Method, req.RequestURI, req.Proto, c.Writer.Status(), size)
+	if a.format == AccessLogCombined {
+		line += fmt.Sprintf(` %q %q`, req.Referer(), req.UserAgent())
+	}
+
+	a.outMu.Lock()
+	defer a.outMu.Unlock()
+	_, _ = io.WriteString(a.out, line+"\n")
+}
+
+func (a *accessLogger) headers(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if redactedHeaders[http.CanonicalHeaderKey(k)] {
+			out[k] = redacted
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+// body returns the JSON body with the redacted fields masked, anything else
+// is only described by its size
+func (a *accessLogger) body(body []byte) any {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("%d bytes", len(body))
+	}
+	return a.redactJSON(v)
+}
+
+func (a *accessLogger) redactJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if a.redact[strings.ToLower(k)] {
+				v[k] = redacted
+				continue
+			}
+			v[k] = a.redactJSON(field)
+		}
+	case []any:
+		for i := range v {
+			v[i] = a.redactJSON(v[i])
+		}
+	}
+	return v
+}
+
+// readCloser replays the part of the body read for the log, closing the original
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,113 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAccessLogRouter(t *testing.T, cfg config.AccessLogConf) (*gin.Engine, string) {
+	gin.SetMode(gin.TestMode)
+	cfg.Output = filepath.Join(t.TempDir(), "access.log")
+	accessLog, err := middleware.AccessLog(cfg)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(accessLog)
+	router.POST("/auth/signin", func(c *gin.Context) {
+		var body map[string]any
+		require.NoError(t, c.ShouldBindJSON(&body))
+		c.JSON(http.StatusOK, gin.H{"username": body["username"]})
+	})
+	router.GET("/healthz", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/fail", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+	return router, cfg.Output
+}
+
+func readLog(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestAccessLog_JSONRedactsCredentials(t *testing.T) {
+	router, out := newAccessLogRouter(t, config.AccessLogConf{
+		Format:       "json",
+		LogHeaders:   true,
+		LogBody:      true,
+		RedactFields: []string{"otp"},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/signin", strings.NewReader(`{"username": "bob", "password": "hunter2", "otp": "123456"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	// The handler still reads the whole body
+	require.Equal(t, http.StatusOK, w.Code)
+
+	line := readLog(t, out)
+	assert.NotContains(t, line, "hunter2")
+	assert.NotContains(t, line, "123456")
+	assert.NotContains(t, line, "Bearer token")
+
+	var record struct {
+		Msg     string            `json:"msg"`
+		Status  int               `json:"status"`
+		Path    string            `json:"path"`
+		Headers map[string]string `json:"headers"`
+		Body    map[string]any    `json:"body"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(line), &record))
+	assert.Equal(t, "request", record.Msg)
+	assert.Equal(t, http.StatusOK, record.Status)
+	assert.Equal(t, "/auth/signin", record.Path)
+	assert.Equal(t, "[REDACTED]", record.Headers["Authorization"])
+	assert.Equal(t, "bob", record.Body["username"])
+	assert.Equal(t, "[REDACTED]", record.Body["password"])
+}
+
+func TestAccessLog_CombinedExclusionAndSampling(t *testing.T) {
+	none := 0.0
+	router, out := newAccessLogRouter(t, config.AccessLogConf{
+		Format:       "combined",
+		SampleRate:   &none,
+		ExcludePaths: []string{"/healthz"},
+	})
+
+	for _, path := range []string{"/healthz", "/ok", "/fail"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("User-Agent", "probe")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Nothing is sampled but failures are always logged
+	lines := strings.Split(strings.TrimSpace(readLog(t, out)), "\n")
+	require.Len(t, lines, 1)
+	assert.Regexp(t, `^192\.0\.2\.1 - - \[.+\] "GET /fail HTTP/1\.1" 500 - "" "probe"$`, lines[0])
+}
+
+func TestAccessLog_UnsetSampleRateLogsEverything(t *testing.T) {
+	router, out := newAccessLogRouter(t, config.AccessLogConf{Format: "common"})
+
+	for range 3 {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	}
+	assert.Len(t, strings.Split(strings.TrimSpace(readLog(t, out)), "\n"), 3)
+}
+
+func TestAccessLog_InvalidFormat(t *testing.T) {
+	_, err := middleware.AccessLog(config.AccessLogConf{Format: "xml", Output: filepath.Join(t.TempDir(), "a.log")})
+	assert.Error(t, err)
+}
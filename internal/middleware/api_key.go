@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/usecase"
+)
+
+// APIKeyHeader is the header machine clients use to present their key
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator authenticates requests carrying an api key, either in
+// the X-API-Key header or as "Authorization: ApiKey <key>" / "Bearer <key>"
+type APIKeyAuthenticator struct {
+	apiKeys usecase.APIKeyUsecaseInterface
+}
+
+func NewAPIKeyAuthenticator(apiKeys usecase.APIKeyUsecaseInterface) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{apiKeys: apiKeys}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(c *gin.Context) (*auth.Identity, error) {
+	raw := extractAPIKey(c)
+	if raw == "" {
+		return nil, ErrNoCredentials
+	}
+
+	key, err := a.apiKeys.Authenticate(c.Request.Context(), raw, c.ClientIP())
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := key.Scopes
+	if scopes == nil {
+		// a nil slice would mean unrestricted
+		scopes = []string{}
+	}
+
+	return &auth.Identity{
+		Subject:  "apikey:" + key.Prefix,
+		Method:   auth.MethodAPIKey,
+		Scopes:   scopes,
+		TenantID: key.TenantID,
+	}, nil
+}
+
+func extractAPIKey(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+
+	authHeader := c.GetHeader("Authorization")
+	if key, ok := strings.CutPrefix(authHeader, "ApiKey "); ok {
+		return key
+	}
+	// Bearer tokens that look like api keys rather than JWTs
+	if key, ok := strings.CutPrefix(authHeader, "Bearer "); ok && strings.HasPrefix(key, usecase.APIKeyPrefix) {
+		return key
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/pkg/httperr"
+	"github.com/innoglobe/xmgo/pkg/logger"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credentials it understands, so the next authenticator in the chain is tried
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator resolves the identity of the caller of a request
+type Authenticator interface {
+	Authenticate(c *gin.Context) (*auth.Identity, error)
+}
+
+// AuthMiddleware tries each authenticator in turn and stores the first
+// identity found in the request context
+func AuthMiddleware(authenticators ...Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, a := range authenticators {
+			id, err := a.Authenticate(c)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if err != nil {
+				// The reason is only logged, it could reveal which keys exist
+				// or carry a database error
+				if log := logger.FromContext(c.Request.Context(), nil); log != nil {
+					log.Warn("Authentication failed", "error", err)
+				}
+				c.JSON(http.StatusUnauthorized, httperr.Body(c, "Invalid credentials"))
+				c.Abort()
+				return
+			}
+
+			ctx := auth.NewContext(c.Request.Context(), id)
+			if log := logger.FromContext(ctx, nil); log != nil {
+				ctx = logger.NewContext(ctx, log.With("user", id.Subject, "tenant", id.TenantID))
+			}
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusUnauthorized, httperr.Body(c, "Authorization header is required"))
+		c.Abort()
+	}
+}
+
+// RequireScope rejects callers whose identity doesn't cover the given scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := auth.FromContext(c.Request.Context())
+		if !ok || !id.HasScope(scope) {
+			c.JSON(http.StatusForbidden, httperr.Body(c, "Insufficient scope"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin rejects callers without administrative rights
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := auth.FromContext(c.Request.Context())
+		if !ok || !id.IsAdmin() {
+			c.JSON(http.StatusForbidden, httperr.Body(c, "Admin access required"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
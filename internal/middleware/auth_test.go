@@ -0,0 +1,153 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/middleware"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAPIKey = usecase.APIKeyPrefix + "0123abcd_secret"
+
+// apiKeys accepts testAPIKey from the addresses in its AllowedIPs, if any,
+// and fails every other key with err
+type apiKeys struct {
+	usecase.APIKeyUsecaseInterface
+	key *entity.APIKey
+	err error
+}
+
+func (k *apiKeys) Authenticate(_ context.Context, raw string, clientIP string) (*entity.APIKey, error) {
+	if raw != testAPIKey {
+		return nil, k.err
+	}
+	if len(k.key.AllowedIPs) > 0 && !slices.Contains(k.key.AllowedIPs, clientIP) {
+		return nil, &customerrors.ForbiddenError{Msg: "API key is not allowed from this address"}
+	}
+	return k.key, nil
+}
+
+func newAuthRouter(keys *apiKeys, handlers ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	chain := append([]gin.HandlerFunc{middleware.AuthMiddleware(middleware.NewAPIKeyAuthenticator(keys))}, handlers...)
+	chain = append(chain, func(c *gin.Context) {
+		id, _ := auth.FromContext(c.Request.Context())
+		c.String(http.StatusOK, id.Subject)
+	})
+	router.GET("/private", chain...)
+	return router
+}
+
+func serve(router *gin.Engine, header, value string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/private", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthMiddleware_APIKey(t *testing.T) {
+	keys := &apiKeys{key: &entity.APIKey{ID: uuid.New(), Prefix: "0123abcd", TenantID: "acme"}}
+	router := newAuthRouter(keys)
+
+	for header, value := range map[string]string{
+		middleware.APIKeyHeader: testAPIKey,
+		"Authorization":         "ApiKey " + testAPIKey,
+	} {
+		w := serve(router, header, value)
+		assert.Equal(t, http.StatusOK, w.Code, header)
+		assert.Equal(t, "apikey:0123abcd", w.Body.String())
+	}
+}
+
+func TestAuthMiddleware_APIKeyAllowlistIgnoresSpoofedForwardedFor(t *testing.T) {
+	keys := &apiKeys{key: &entity.APIKey{Prefix: "0123abcd", AllowedIPs: []string{"203.0.113.7"}}}
+	router := newAuthRouter(keys)
+	request := func() *httptest.ResponseRecorder {
+		// httptest requests come from 192.0.2.1
+		req := httptest.NewRequest(http.MethodGet, "/private", nil)
+		req.Header.Set(middleware.APIKeyHeader, testAPIKey)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// No trusted proxies, the server.trusted_proxies default
+	require.NoError(t, router.SetTrustedProxies(nil))
+	assert.Equal(t, http.StatusUnauthorized, request().Code)
+
+	// The header is believed from a trusted proxy
+	require.NoError(t, router.SetTrustedProxies([]string{"192.0.2.0/24"}))
+	assert.Equal(t, http.StatusOK, request().Code)
+}
+
+func TestAuthMiddleware_ErrorsAreNotLeaked(t *testing.T) {
+	for name, err := range map[string]error{
+		"database": errors.New(`pq: relation "api_keys" does not exist`),
+		"expired":  &customerrors.UnauthorizedError{Msg: "API key has expired"},
+		"ip":       &customerrors.ForbiddenError{Msg: "API key is not allowed from this address"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			router := newAuthRouter(&apiKeys{err: err})
+
+			w := serve(router, middleware.APIKeyHeader, usecase.APIKeyPrefix+"other")
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Contains(t, w.Body.String(), "Invalid credentials")
+			assert.NotContains(t, w.Body.String(), err.Error())
+		})
+	}
+}
+
+func TestAuthMiddleware_NoCredentials(t *testing.T) {
+	router := newAuthRouter(&apiKeys{})
+
+	w := serve(router, "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Authorization header is required")
+}
+
+func TestRequireScope(t *testing.T) {
+	for name, tc := range map[string]struct {
+		scopes []string
+		status int
+	}{
+		"granted":       {scopes: []string{auth.ScopeCompaniesWrite}, status: http.StatusOK},
+		"admin":         {scopes: []string{auth.ScopeAdmin}, status: http.StatusOK},
+		"other scope":   {scopes: []string{auth.ScopeCompaniesRead}, status: http.StatusForbidden},
+		"no scope":      {scopes: nil, status: http.StatusForbidden},
+		"empty allowed": {scopes: []string{}, status: http.StatusForbidden},
+	} {
+		t.Run(name, func(t *testing.T) {
+			keys := &apiKeys{key: &entity.APIKey{Prefix: "0123abcd", Scopes: tc.scopes}}
+			router := newAuthRouter(keys, middleware.RequireScope(auth.ScopeCompaniesWrite))
+
+			w := serve(router, middleware.APIKeyHeader, testAPIKey)
+			assert.Equal(t, tc.status, w.Code)
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	keys := &apiKeys{key: &entity.APIKey{Prefix: "0123abcd", Scopes: []string{auth.ScopeCompaniesWrite}}}
+	router := newAuthRouter(keys, middleware.RequireAdmin())
+	require.Equal(t, http.StatusForbidden, serve(router, middleware.APIKeyHeader, testAPIKey).Code)
+
+	keys.key.Scopes = []string{auth.ScopeAdmin}
+	assert.Equal(t, http.StatusOK, serve(router, middleware.APIKeyHeader, testAPIKey).Code)
+}
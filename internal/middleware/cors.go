@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/config"
+)
+
+const (
+	corsAllowMethods  = "GET, POST, PATCH, PUT, DELETE, OPTIONS"
+	corsAllowHeaders  = "Authorization, Content-Type, X-Api-Key, X-Request-ID, traceparent, tracestate"
+	corsExposeHeaders = "X-Request-ID, Retry-After"
+	corsMaxAge        = "43200"
+)
+
+// CORS answers the preflight requests of browsers and allows the configured
+// origins to read the responses. The origins can be changed at runtime.
+type CORS struct {
+	origins atomic.Pointer[[]string]
+}
+
+// NewCORS returns the CORS middleware for the origins of cfg
+func NewCORS(cfg config.CORSConf) *CORS {
+	c := &CORS{}
+	c.Configure(cfg)
+	return c
+}
+
+// Configure replaces the allowed origins
+func (c *CORS) Configure(cfg config.CORSConf) {
+	origins := make([]string, len(cfg.AllowedOrigins))
+	for i, origin := range cfg.AllowedOrigins {
+		origins[i] = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+	}
+	c.origins.Store(&origins)
+}
+
+// Handler returns the gin middleware. Requests from other origins get no CORS
+// headers, so browsers block them.
+func (c *CORS) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if origin == "" {
+			ctx.Next()
+			return
+		}
+		ctx.Writer.Header().Add("Vary", "Origin")
+		if !c.allowed(origin) {
+			ctx.Next()
+			return
+		}
+
+		h := ctx.Writer.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		if ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+			h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			h.Set("Access-Control-Max-Age", corsMaxAge)
+			ctx.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func (c *CORS) allowed(origin string) bool {
+	origins := *c.origins.Load()
+	return slices.Contains(origins, "*") || slices.Contains(origins, origin)
+}
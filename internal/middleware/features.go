@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/pkg/httperr"
+)
+
+// Features serves routes only while their feature flag is on. The flags can
+// be changed at runtime.
+type Features struct {
+	flags atomic.Pointer[map[string]bool]
+}
+
+// NewFeatures returns the feature gate for the flags of the config
+func NewFeatures(flags map[string]bool) *Features {
+	f := &Features{}
+	f.Configure(flags)
+	return f
+}
+
+// Configure replaces the flags
+func (f *Features) Configure(flags map[string]bool) {
+	lower := make(map[string]bool, len(flags))
+	for name, on := range flags {
+		lower[strings.ToLower(name)] = on
+	}
+	f.flags.Store(&lower)
+}
+
+// Enabled tells whether the feature flag name is on
+func (f *Features) Enabled(name string) bool {
+	return (*f.flags.Load())[strings.ToLower(name)]
+}
+
+// Require returns a middleware answering 404 while the feature flag name is
+// off, as if the route didn't exist
+func (f *Features) Require(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !f.Enabled(name) {
+			c.AbortWithStatusJSON(http.StatusNotFound, httperr.Body(c, "Not found"))
+			return
+		}
+		c.Next()
+	}
+}
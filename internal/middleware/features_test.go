@@ -0,0 +1,57 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/middleware"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatures_Require(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	features := middleware.NewFeatures(map[string]bool{"Swagger": true, "beta": false})
+	router := gin.New()
+	router.GET("/swagger", features.Require("swagger"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/beta", features.Require("beta"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	request := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("/swagger"))
+	assert.Equal(t, http.StatusNotFound, request("/beta"))
+
+	features.Configure(map[string]bool{"beta": true})
+	assert.Equal(t, http.StatusNotFound, request("/swagger"), "flags left out are off")
+	assert.Equal(t, http.StatusOK, request("/beta"))
+}
+
+func TestFeatures_FollowTheConfigWatcher(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(flags string) {
+		content := "server:\n  port: 8080\ndatabase:\n  host: db\n  port: 5432\n  user: xmgo\n  name: xmgo_db\njwt:\n  secret: s\nfeatures:\n" + flags
+		require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	}
+	write("  beta: false\n")
+	cfg, err := config.LoadConfig(file)
+	require.NoError(t, err)
+
+	// Wired like in cmd/server
+	watcher := config.NewWatcher(file, cfg, logger.Discard())
+	features := middleware.NewFeatures(cfg.Features)
+	watcher.Subscribe(func(_, cfg *config.Config) { features.Configure(cfg.Features) })
+	assert.False(t, features.Enabled("beta"))
+
+	write("  beta: true\n")
+	watcher.Reload()
+	assert.True(t, features.Enabled("beta"))
+}
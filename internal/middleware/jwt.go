@@ -1,43 +1,81 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"net/http"
+	"github.com/innoglobe/xmgo/internal/auth"
 	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+// JWTAuthMiddleware only accepts bearer tokens signed with secretKey
 func JWTAuthMiddleware(secretKey string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
-			return
-		}
+	return AuthMiddleware(NewJWTAuthenticator(secretKey))
+}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
-			c.Abort()
-			return
-		}
+// JWTAuthenticator authenticates requests carrying a bearer JWT
+type JWTAuthenticator struct {
+	secretKey string
+}
+
+func NewJWTAuthenticator(secretKey string) *JWTAuthenticator {
+	return &JWTAuthenticator{secretKey: secretKey}
+}
+
+func (a *JWTAuthenticator) Authenticate(c *gin.Context) (*auth.Identity, error) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		return nil, ErrNoCredentials
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return nil, errors.New("Authorization header format must be Bearer {token}")
+	}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(secretKey), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
+		return []byte(a.secretKey), nil
+	})
 
-		c.Next()
+	if err != nil || !token.Valid {
+		return nil, errors.New("Invalid token")
+	}
+
+	return identityFromClaims(claims), nil
+}
+
+func identityFromClaims(claims jwt.MapClaims) *auth.Identity {
+	id := &auth.Identity{Method: auth.MethodJWT}
+	if sub, ok := claims["sub"].(string); ok && sub != "" {
+		id.Subject = sub
+	} else if username, ok := claims["username"].(string); ok {
+		id.Subject = username
+	}
+	id.Roles = stringsClaim(claims, "roles")
+	id.Groups = stringsClaim(claims, "groups")
+	id.TenantID = auth.DefaultTenant
+	if tenant, ok := claims["tenant_id"].(string); ok && tenant != "" {
+		id.TenantID = tenant
+	}
+	return id
+}
+
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	raw, ok := claims[name].([]interface{})
+	if !ok {
+		return nil
+	}
+	out := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
 	}
+	return out
 }
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/innoglobe/xmgo/pkg/requestid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID correlating the logs, errors and events of a request
+const RequestIDHeader = requestid.Header
+
+// RequestLogger takes the request ID from the X-Request-ID header, or
+// generates one, and echoes it in the response. The ID and a child of log
+// carrying it are stored in the request context, so the usecases, the
+// repositories and the events can read it. The trace ID is added to the
+// logger when the request is traced. AuthMiddleware adds the caller once
+// authenticated.
+func RequestLogger(log logger.LoggerInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		c.Header(RequestIDHeader, id)
+
+		child := log.With("request_id", id)
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			child = child.With("trace_id", sc.TraceID().String())
+		}
+		ctx := requestid.NewContext(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(logger.NewContext(ctx, child))
+		c.Next()
+	}
+}
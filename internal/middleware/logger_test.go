@@ -0,0 +1,63 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/middleware"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/innoglobe/xmgo/pkg/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequestIDRouter(seen *string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.RequestLogger(logger.Discard()))
+	router.GET("/ok", func(c *gin.Context) {
+		*seen = requestid.FromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+	router.GET("/private", middleware.AuthMiddleware(), func(c *gin.Context) {})
+	return router
+}
+
+func TestRequestLogger_RequestID(t *testing.T) {
+	var seen string
+	router := newRequestIDRouter(&seen)
+
+	req := httptest.NewRequest(http.MethodGet, "/ok", nil)
+	req.Header.Set(middleware.RequestIDHeader, "client-id-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "client-id-1", seen)
+	assert.Equal(t, "client-id-1", w.Header().Get(middleware.RequestIDHeader))
+
+	// IDs that could inject anything into the logs are replaced
+	req = httptest.NewRequest(http.MethodGet, "/ok", nil)
+	req.Header.Set(middleware.RequestIDHeader, "bad id\n"+strings.Repeat("x", 200))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.True(t, requestid.Valid(seen))
+	assert.NotContains(t, seen, "bad")
+	assert.Equal(t, seen, w.Header().Get(middleware.RequestIDHeader))
+}
+
+func TestRequestLogger_ErrorBodyCarriesRequestID(t *testing.T) {
+	var seen string
+	router := newRequestIDRouter(&seen)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/private", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.NotEmpty(t, body["error"])
+	assert.Equal(t, w.Header().Get(middleware.RequestIDHeader), body["request_id"])
+}
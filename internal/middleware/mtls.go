@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/config"
+)
+
+// CertAuthenticator authenticates requests made over mutual TLS by mapping
+// the verified client certificate to a configured identity
+type CertAuthenticator struct {
+	identities []config.CertIdentityConf
+}
+
+func NewCertAuthenticator(identities []config.CertIdentityConf) *CertAuthenticator {
+	return &CertAuthenticator{identities: identities}
+}
+
+func (a *CertAuthenticator) Authenticate(c *gin.Context) (*auth.Identity, error) {
+	tlsState := c.Request.TLS
+	if tlsState == nil || len(tlsState.VerifiedChains) == 0 || len(tlsState.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := tlsState.VerifiedChains[0][0]
+
+	for _, m := range a.identities {
+		if !certMatches(cert, m) {
+			continue
+		}
+		id := &auth.Identity{
+			Subject:  m.Subject,
+			Method:   auth.MethodMTLS,
+			Roles:    m.Roles,
+			Groups:   m.Groups,
+			TenantID: m.TenantID,
+		}
+		if id.Subject == "" {
+			id.Subject = cert.Subject.CommonName
+		}
+		if id.TenantID == "" {
+			id.TenantID = auth.DefaultTenant
+		}
+		if len(m.Scopes) > 0 {
+			id.Scopes = m.Scopes
+		}
+		return id, nil
+	}
+
+	// A trusted but unmapped certificate doesn't identify anyone, let the
+	// request authenticate with a token instead
+	return nil, ErrNoCredentials
+}
+
+func certMatches(cert *x509.Certificate, m config.CertIdentityConf) bool {
+	if m.CommonName == "" && m.DNSName == "" && m.URI == "" && m.Email == "" {
+		return false
+	}
+	if m.CommonName != "" && cert.Subject.CommonName != m.CommonName {
+		return false
+	}
+	if m.DNSName != "" && !slices.Contains(cert.DNSNames, m.DNSName) {
+		return false
+	}
+	if m.Email != "" && !slices.Contains(cert.EmailAddresses, m.Email) {
+		return false
+	}
+	if m.URI != "" && !slices.ContainsFunc(cert.URIs, func(u *url.URL) bool { return u.String() == m.URI }) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var billingCert = &x509.Certificate{
+	Subject:        pkix.Name{CommonName: "billing-service"},
+	DNSNames:       []string{"billing.internal", "billing"},
+	EmailAddresses: []string{"billing@example.com"},
+	URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/billing"}},
+}
+
+// certContext returns a gin context for a request made with cert, verified
+// when cert isn't nil
+func certContext(cert *x509.Certificate) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	if cert != nil {
+		c.Request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	return c
+}
+
+func TestCertAuthenticator_Matching(t *testing.T) {
+	for name, tc := range map[string]struct {
+		identity config.CertIdentityConf
+		matches  bool
+	}{
+		"common name":        {identity: config.CertIdentityConf{CommonName: "billing-service"}, matches: true},
+		"dns name":           {identity: config.CertIdentityConf{DNSName: "billing"}, matches: true},
+		"uri":                {identity: config.CertIdentityConf{URI: "spiffe://example.com/billing"}, matches: true},
+		"email":              {identity: config.CertIdentityConf{Email: "billing@example.com"}, matches: true},
+		"every field":        {identity: config.CertIdentityConf{CommonName: "billing-service", DNSName: "billing.internal", URI: "spiffe://example.com/billing", Email: "billing@example.com"}, matches: true},
+		"other common name":  {identity: config.CertIdentityConf{CommonName: "reporting-service"}},
+		"other dns name":     {identity: config.CertIdentityConf{DNSName: "billing.example.com"}},
+		"other uri":          {identity: config.CertIdentityConf{URI: "spiffe://example.com/reporting"}},
+		"other email":        {identity: config.CertIdentityConf{Email: "reporting@example.com"}},
+		"one field differs":  {identity: config.CertIdentityConf{CommonName: "billing-service", DNSName: "reporting"}},
+		"no field to match":  {identity: config.CertIdentityConf{Subject: "svc:anyone"}},
+		"common name as dns": {identity: config.CertIdentityConf{DNSName: "billing-service"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a := middleware.NewCertAuthenticator([]config.CertIdentityConf{tc.identity})
+
+			id, err := a.Authenticate(certContext(billingCert))
+			if !tc.matches {
+				assert.ErrorIs(t, err, middleware.ErrNoCredentials)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, auth.MethodMTLS, id.Method)
+		})
+	}
+}
+
+func TestCertAuthenticator_Identity(t *testing.T) {
+	a := middleware.NewCertAuthenticator([]config.CertIdentityConf{
+		{CommonName: "reporting-service", Subject: "svc:reporting"},
+		{DNSName: "billing.internal", Subject: "svc:billing", Roles: []string{auth.RoleAdmin}, Groups: []string{"finance"}, TenantID: "acme", Scopes: []string{auth.ScopeCompaniesRead}},
+		{CommonName: "billing-service", Subject: "svc:never-reached"},
+	})
+
+	// The first match wins
+	id, err := a.Authenticate(certContext(billingCert))
+	require.NoError(t, err)
+	assert.Equal(t, &auth.Identity{
+		Subject:  "svc:billing",
+		Method:   auth.MethodMTLS,
+		Roles:    []string{auth.RoleAdmin},
+		Groups:   []string{"finance"},
+		TenantID: "acme",
+		Scopes:   []string{auth.ScopeCompaniesRead},
+	}, id)
+
+	// The subject defaults to the common name, the tenant to the default one,
+	// and no scopes means unrestricted
+	a = middleware.NewCertAuthenticator([]config.CertIdentityConf{{Email: "billing@example.com"}})
+	id, err = a.Authenticate(certContext(billingCert))
+	require.NoError(t, err)
+	assert.Equal(t, "billing-service", id.Subject)
+	assert.Equal(t, auth.DefaultTenant, id.TenantID)
+	assert.Nil(t, id.Scopes)
+}
+
+func TestCertAuthenticator_NoVerifiedCertificate(t *testing.T) {
+	a := middleware.NewCertAuthenticator([]config.CertIdentityConf{{CommonName: "billing-service"}})
+
+	_, err := a.Authenticate(certContext(nil))
+	assert.ErrorIs(t, err, middleware.ErrNoCredentials)
+
+	// A certificate presented but not verified doesn't identify anyone
+	c := certContext(nil)
+	c.Request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{billingCert}}
+	_, err = a.Authenticate(c)
+	assert.ErrorIs(t, err, middleware.ErrNoCredentials)
+}
@@ -0,0 +1,186 @@
+package eventservice
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/pkg/jsonschema"
+)
+
+// DefaultTopic is the topic described by the generated AsyncAPI document
+const DefaultTopic = "company_events"
+
+var schemaFormats = jsonschema.Formats{reflect.TypeOf(uuid.UUID{}): "uuid"}
+
+var eventDescriptions = map[string]string{
+	CompanyCreatedType:  "A company was created.",
+	CompanyUpdatedType:  "A company was updated. Carries the before and after states, or only the old and new values of the changed fields.",
+	CompanyDeletedType:  "A company was deleted.",
+	CompanySnapshotType: "The current state of a company, republished for consumers rebuilding their store.",
+}
+
+// PayloadSchema returns the JSON Schema of an event payload
+func PayloadSchema(data EventData) jsonschema.Schema {
+	s := jsonschema.Reflect(data, schemaFormats)
+	s["title"] = reflect.TypeOf(data).Name()
+	s["description"] = eventDescriptions[data.EventType()]
+	// The version of a schema is fixed
+	s["properties"].(jsonschema.Schema)["version"] = jsonschema.Schema{"type": "integer", "const": data.SchemaVersion()}
+	return s
+}
+
+// EventSchemas returns the JSON Schema documents of the company event
+// payloads, by file name, as served under events.schema_base_url
+func EventSchemas() (map[string][]byte, error) {
+	files := make(map[string][]byte, len(CompanyEventPayloads))
+	for _, data := range CompanyEventPayloads {
+		name := SchemaFileName(data.EventType(), data.SchemaVersion())
+		s := PayloadSchema(data)
+		s["$schema"] = jsonschema.Draft
+		s["$id"] = name
+
+		b, err := marshalDocument(s)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = b
+	}
+	return files, nil
+}
+
+// WriteEventSchemas writes the schemas of the current payload versions to dir
+// and returns the names of the files it wrote, those already up to date are
+// left alone. The schemas of older versions are kept: they stay published for
+// the consumers of events still carrying them.
+func WriteEventSchemas(dir string) ([]string, error) {
+	schemas, err := EventSchemas()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for name, b := range schemas {
+		path := filepath.Join(dir, name)
+		old, err := os.ReadFile(path)
+		if err == nil && bytes.Equal(old, b) {
+			continue
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			return nil, err
+		}
+		written = append(written, name)
+	}
+	slices.Sort(written)
+	return written, nil
+}
+
+// AsyncAPIDocument describes the company events published to topic as an
+// AsyncAPI 3.0 document, with the attributes as CloudEvents Kafka headers
+func AsyncAPIDocument(topic string) ([]byte, error) {
+	messages := jsonschema.Schema{}
+	schemas := jsonschema.Schema{}
+	refs := []jsonschema.Schema{}
+	for _, data := range CompanyEventPayloads {
+		name := reflect.TypeOf(data).Name()
+		key := strings.ToLower(name[:1]) + name[1:]
+		schemas[name] = PayloadSchema(data)
+		messages[key] = jsonschema.Schema{
+			"name":        data.EventType(),
+			"title":       name,
+			"summary":     eventDescriptions[data.EventType()],
+			"contentType": ContentTypeJSON,
+			"headers":     cloudEventHeaders(data),
+			"payload":     jsonschema.Schema{"$ref": "#/components/schemas/" + name},
+			"bindings": jsonschema.Schema{"kafka": jsonschema.Schema{
+				"key":            jsonschema.Schema{"type": "string", "format": "uuid", "description": "The company ID"},
+				"bindingVersion": "0.5.0",
+			}},
+		}
+		refs = append(refs, jsonschema.Schema{"$ref": "#/channels/companyEvents/messages/" + key})
+	}
+
+	channelMessages := jsonschema.Schema{}
+	for key := range messages {
+		channelMessages[key] = jsonschema.Schema{"$ref": "#/components/messages/" + key}
+	}
+
+	doc := jsonschema.Schema{
+		"asyncapi": "3.0.0",
+		"info": jsonschema.Schema{
+			"title":       "XMGO company events",
+			"version":     "1.0.0",
+			"description": "Changes to companies, published as CloudEvents 1.0 in Kafka binary content mode. Messages are keyed by company ID, so the events of a company keep their order.",
+		},
+		"defaultContentType": ContentTypeJSON,
+		"servers": jsonschema.Schema{
+			"kafka": jsonschema.Schema{"host": "localhost:9092", "protocol": "kafka", "description": "The brokers in kafka.brokers"},
+		},
+		"channels": jsonschema.Schema{
+			"companyEvents": jsonschema.Schema{
+				"address":     topic,
+				"description": "The topic in kafka.topic",
+				"messages":    channelMessages,
+			},
+		},
+		"operations": jsonschema.Schema{
+			"publishCompanyEvents": jsonschema.Schema{
+				"action":   "send",
+				"channel":  jsonschema.Schema{"$ref": "#/channels/companyEvents"},
+				"messages": refs,
+			},
+		},
+		"components": jsonschema.Schema{
+			"messages": messages,
+			"schemas":  schemas,
+		},
+	}
+	return marshalDocument(doc)
+}
+
+// cloudEventHeaders is the schema of the Kafka headers of an event
+func cloudEventHeaders(data EventData) jsonschema.Schema {
+	str := func(description string) jsonschema.Schema {
+		return jsonschema.Schema{"type": "string", "description": description}
+	}
+	return jsonschema.Schema{
+		"type": "object",
+		"properties": jsonschema.Schema{
+			"content-type":                str("Content type of the data, application/json or application/avro"),
+			"ce_specversion":              jsonschema.Schema{"type": "string", "const": SpecVersion},
+			"ce_id":                       str("Unique event ID"),
+			"ce_source":                   str("The service publishing the event, events.source"),
+			"ce_type":                     jsonschema.Schema{"type": "string", "const": data.EventType()},
+			"ce_time":                     jsonschema.Schema{"type": "string", "format": "date-time"},
+			"ce_subject":                  str("The company ID"),
+			"ce_dataschema":               str("URL of the schema of the data"),
+			"ce_" + PartitionKeyExtension: str("The message key, the company ID"),
+			"ce_" + SequenceExtension:     str("Position of the event among the events of the company sent by this producer, from 1"),
+			"ce_" + ProducerIDExtension:   str("ID of the producer instance, sequences restart with a new one"),
+			"ce_" + TenantExtension:       str("The tenant of the company"),
+			"ce_" + RequestIDExtension:    str("X-Request-ID of the API call, or correlation ID of the command, that caused the event"),
+		},
+		"required": []string{"ce_specversion", "ce_id", "ce_source", "ce_type", "ce_time", "ce_subject"},
+	}
+}
+
+func marshalDocument(v any) ([]byte, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,109 @@
+package eventservice_test
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/docs/events"
+	"github.com/innoglobe/xmgo/internal/entity"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/innoglobe/xmgo/pkg/jsonschema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const regenerate = "the published event docs are out of date, regenerate them with: make event-docs"
+
+// TestEventDocsUpToDate fails when the event structs and the published
+// AsyncAPI document or JSON Schemas in docs/events drift apart
+func TestEventDocsUpToDate(t *testing.T) {
+	schemas, err := eventservice.EventSchemas()
+	require.NoError(t, err)
+
+	for name, want := range schemas {
+		got, err := fs.ReadFile(events.FS, "schemas/"+name)
+		require.NoError(t, err, regenerate)
+		assert.JSONEq(t, string(want), string(got), "%s: %s", name, regenerate)
+	}
+
+	doc, err := eventservice.AsyncAPIDocument(eventservice.DefaultTopic)
+	require.NoError(t, err)
+	got, err := fs.ReadFile(events.FS, "asyncapi.json")
+	require.NoError(t, err)
+	assert.JSONEq(t, string(doc), string(got), regenerate)
+}
+
+// TestOlderSchemasStayPublished guards the schemas of the versions events
+// were published with before the current ones
+func TestOlderSchemasStayPublished(t *testing.T) {
+	for _, name := range []string{
+		"com.xmgo.company.updated.v1.json",
+	} {
+		_, err := fs.Stat(events.FS, "schemas/"+name)
+		assert.NoError(t, err, "%s was published and must not be removed", name)
+	}
+}
+
+func TestWriteEventSchemas(t *testing.T) {
+	dir := t.TempDir()
+	older := filepath.Join(dir, "com.xmgo.company.updated.v1.json")
+	require.NoError(t, os.WriteFile(older, []byte(`{"title": "CompanyUpdated"}`), 0o644))
+	stale := filepath.Join(dir, "com.xmgo.company.created.v1.json")
+	require.NoError(t, os.WriteFile(stale, []byte(`{}`), 0o644))
+
+	schemas, err := eventservice.EventSchemas()
+	require.NoError(t, err)
+	written, err := eventservice.WriteEventSchemas(dir)
+	require.NoError(t, err)
+	assert.Len(t, written, len(schemas))
+	for name, want := range schemas {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// The older version survives regeneration
+	got, err := os.ReadFile(older)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"title": "CompanyUpdated"}`, string(got))
+
+	// Nothing is written when the schemas are up to date
+	written, err = eventservice.WriteEventSchemas(dir)
+	require.NoError(t, err)
+	assert.Empty(t, written)
+}
+
+// TestEventSchemasDescribeEvents checks the data of real events only has
+// the properties of its schema, and all of the required ones
+func TestEventSchemasDescribeEvents(t *testing.T) {
+	company := entity.Company{ID: uuid.New(), Name: "Acme", Type: entity.Corporation}
+	changed := company
+	changed.Name = "Acme Inc"
+
+	for _, event := range []*eventservice.Event{
+		eventservice.NewCompanyCreatedEvent(company),
+		eventservice.NewCompanyUpdatedEvent(company, changed, eventservice.UpdatePayloadFull),
+		eventservice.NewCompanyUpdatedEvent(company, changed, eventservice.UpdatePayloadChanges),
+		eventservice.NewCompanyDeletedEvent(company),
+		eventservice.NewCompanySnapshotEvent(company),
+	} {
+		b, err := json.Marshal(event.Data)
+		require.NoError(t, err)
+		var data map[string]any
+		require.NoError(t, json.Unmarshal(b, &data))
+
+		schema := eventservice.PayloadSchema(event.Data)
+		properties := schema["properties"].(jsonschema.Schema)
+		for field := range data {
+			assert.Contains(t, properties, field, event.Type)
+		}
+		for _, field := range schema["required"].([]string) {
+			assert.Contains(t, data, field, event.Type)
+		}
+		assert.EqualValues(t, event.Data.SchemaVersion(), data["version"])
+	}
+}
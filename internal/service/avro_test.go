@@ -0,0 +1,130 @@
+package eventservice_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hamba/avro/v2"
+	"github.com/innoglobe/xmgo/internal/entity"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/innoglobe/xmgo/pkg/schemaregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry is a minimal stand-in for a Confluent schema registry
+type fakeRegistry struct {
+	mu           sync.Mutex
+	ids          map[string]int // by schema
+	subjects     map[string][]string
+	incompatible bool
+}
+
+func newFakeRegistry(t *testing.T) (*fakeRegistry, *httptest.Server) {
+	r := &fakeRegistry{ids: map[string]int{}, subjects: map[string][]string{}}
+	srv := httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func (r *fakeRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	_ = json.NewDecoder(req.Body).Decode(&body)
+	w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+
+	switch parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/"); {
+	case len(parts) == 5 && parts[0] == "compatibility":
+		if len(r.subjects[parts[2]]) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code": 40401, "message": "Subject not found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"is_compatible": !r.incompatible, "messages": []string{"field removed"}})
+	case len(parts) == 3 && parts[0] == "subjects" && req.Method == http.MethodPost:
+		id, ok := r.ids[body.Schema]
+		if !ok {
+			id = len(r.ids) + 1
+			r.ids[body.Schema] = id
+			r.subjects[parts[1]] = append(r.subjects[parts[1]], body.Schema)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]int{"id": id})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestAvroSerializer(t *testing.T) {
+	registry, srv := newFakeRegistry(t)
+	serializer := eventservice.NewAvroSerializer(schemaregistry.New(schemaregistry.Config{URL: srv.URL}))
+	require.NoError(t, serializer.Register(context.Background(), "company_events"))
+	assert.Len(t, registry.subjects, 4)
+	assert.Contains(t, registry.subjects, "company_events-com.xmgo.company.CompanyCreated")
+
+	company := entity.Company{ID: uuid.New(), Name: "Acme", AmountOfEmployees: 10, Type: entity.Corporation, CreatedAt: time.Now().UTC().Truncate(time.Microsecond)}
+	changed := company
+	changed.Name = "Acme Inc"
+
+	events := []*eventservice.Event{
+		eventservice.NewCompanyCreatedEvent(company),
+		eventservice.NewCompanyUpdatedEvent(company, changed, eventservice.UpdatePayloadFull),
+		eventservice.NewCompanyUpdatedEvent(company, changed, eventservice.UpdatePayloadChanges),
+		eventservice.NewCompanyDeletedEvent(company),
+		eventservice.NewCompanySnapshotEvent(company),
+	}
+	for _, event := range events {
+		value, err := serializer.Serialize(context.Background(), "company_events", event)
+		require.NoError(t, err, event.Type)
+
+		id, payload, err := schemaregistry.ParseWireFormat(value)
+		require.NoError(t, err)
+		assert.Equal(t, eventservice.ContentTypeAvro, event.DataContentType)
+		assert.Equal(t, srv.URL+"/schemas/ids/"+strconv.Itoa(id), event.DataSchema)
+
+		// Decode with the registered schema, as a consumer would
+		var schema string
+		for s, sid := range registry.ids {
+			if sid == id {
+				schema = s
+			}
+		}
+		var decoded map[string]any
+		require.NoError(t, avro.Unmarshal(avro.MustParse(schema), payload, &decoded), event.Type)
+		assert.EqualValues(t, event.Data.SchemaVersion(), decoded["version"])
+	}
+
+	created, _ := serializer.Serialize(context.Background(), "company_events", eventservice.NewCompanyCreatedEvent(company))
+	_, payload, _ := schemaregistry.ParseWireFormat(created)
+	var data eventservice.CompanyCreated
+	require.NoError(t, avro.Unmarshal(avro.MustParse(firstSchema(registry, "company_events-com.xmgo.company.CompanyCreated")), payload, &data))
+	assert.Equal(t, eventservice.NewCompanyData(company), data.Company)
+}
+
+func TestAvroSerializer_Incompatible(t *testing.T) {
+	registry, srv := newFakeRegistry(t)
+	registry.subjects["company_events-com.xmgo.company.CompanyCreated"] = []string{`"string"`}
+	registry.incompatible = true
+
+	serializer := eventservice.NewAvroSerializer(schemaregistry.New(schemaregistry.Config{URL: srv.URL}))
+	err := serializer.Register(context.Background(), "company_events")
+	assert.ErrorIs(t, err, schemaregistry.ErrIncompatible)
+	assert.Len(t, registry.subjects["company_events-com.xmgo.company.CompanyCreated"], 1)
+}
+
+func firstSchema(r *fakeRegistry, subject string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.subjects[subject][0]
+}
@@ -0,0 +1,120 @@
+package eventservice
+
+import (
+	"context"
+	"sync"
+)
+
+const defaultChannelBuffer = 100
+
+// DefaultBroker is the in-process broker used by the channel backend
+var DefaultBroker = NewChannelBroker(defaultChannelBuffer)
+
+// ChannelBroker delivers events to in-process subscribers over channels,
+// so tests and local tools can observe events without a message broker
+type ChannelBroker struct {
+	mu          sync.RWMutex
+	buffer      int
+	subscribers map[*subscription]struct{}
+}
+
+// subscription is the channel of one subscriber. done is closed when it
+// unsubscribes, so senders waiting on a full channel give up before the
+// channel is closed.
+type subscription struct {
+	mu     sync.RWMutex
+	events chan *Event
+	done   chan struct{}
+	closed bool
+}
+
+func NewChannelBroker(buffer int) *ChannelBroker {
+	return &ChannelBroker{
+		buffer:      intOr(buffer, defaultChannelBuffer),
+		subscribers: make(map[*subscription]struct{}),
+	}
+}
+
+// SetBuffer changes the buffer size of future subscriptions
+func (b *ChannelBroker) SetBuffer(buffer int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buffer = intOr(buffer, defaultChannelBuffer)
+}
+
+// Subscribe returns a channel receiving every event published from now on,
+// and a function ending the subscription
+func (b *ChannelBroker) Subscribe() (<-chan *Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &subscription{events: make(chan *Event, b.buffer), done: make(chan struct{})}
+	b.subscribers[sub] = struct{}{}
+	return sub.events, func() {
+		b.mu.Lock()
+		_, ok := b.subscribers[sub]
+		delete(b.subscribers, sub)
+		b.mu.Unlock()
+		if ok {
+			sub.close()
+		}
+	}
+}
+
+// Publish sends the event to every subscriber, waiting for slow ones until ctx
+// is done. The subscribers are sent to outside of the broker lock, so a slow
+// one doesn't hold up subscribing and unsubscribing.
+func (b *ChannelBroker) Publish(ctx context.Context, event *Event) error {
+	b.mu.RLock()
+	subs := make([]*subscription, 0, len(b.subscribers))
+	for sub := range b.subscribers {
+		subs = append(subs, sub)
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		if err := sub.send(ctx, event.Clone()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send queues the event unless the subscriber is gone
+func (s *subscription) send(ctx context.Context, event *Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil
+	}
+	select {
+	case s.events <- event:
+		return nil
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close releases the senders waiting on the subscription, then closes its channel
+func (s *subscription) close() {
+	close(s.done)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	close(s.events)
+}
+
+// brokerProducer publishes to a ChannelBroker
+type brokerProducer struct {
+	broker   *ChannelBroker
+	envelope Envelope
+}
+
+func (p *brokerProducer) Produce(ctx context.Context, event *Event) (*Delivery, error) {
+	p.envelope.Apply(event)
+	return completedDelivery(p.broker.Publish(ctx, event)), nil
+}
+
+func (p *brokerProducer) Close() error { return nil }
@@ -0,0 +1,67 @@
+package eventservice_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelBroker_SlowSubscriber(t *testing.T) {
+	broker := eventservice.NewChannelBroker(1)
+	slow, unsubscribeSlow := broker.Subscribe()
+	require.NoError(t, broker.Publish(context.Background(), companyEvent(uuid.New())))
+
+	// The publisher waits for room in the full channel of the slow subscriber
+	published := make(chan error, 1)
+	go func() { published <- broker.Publish(context.Background(), companyEvent(uuid.New())) }()
+
+	// Meanwhile others subscribe and unsubscribe freely
+	subscribed := make(chan struct{})
+	go func() {
+		_, unsubscribe := broker.Subscribe()
+		unsubscribe()
+		close(subscribed)
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("subscribing is held up by a slow subscriber")
+	}
+
+	// The slow subscriber leaving releases the publisher and closes its channel
+	unsubscribeSlow()
+	select {
+	case err := <-published:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the publisher is still waiting for a subscriber that left")
+	}
+	<-slow
+	_, open := <-slow
+	assert.False(t, open)
+}
+
+func TestChannelBroker_PublishGivesUpWithContext(t *testing.T) {
+	broker := eventservice.NewChannelBroker(1)
+	events, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+	require.NoError(t, broker.Publish(context.Background(), companyEvent(uuid.New())))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, broker.Publish(ctx, companyEvent(uuid.New())), context.DeadlineExceeded)
+
+	// Events go to every subscriber once there is room
+	<-events
+	other, unsubscribeOther := broker.Subscribe()
+	defer unsubscribeOther()
+	event := companyEvent(uuid.New())
+	require.NoError(t, broker.Publish(context.Background(), event))
+	assert.Equal(t, event.ID, (<-events).ID)
+	assert.Equal(t, event.ID, (<-other).ID)
+}
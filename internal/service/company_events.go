@@ -0,0 +1,197 @@
+package eventservice
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/entity"
+)
+
+// Company event types
+const (
+	CompanyCreatedType = "com.xmgo.company.created"
+	CompanyUpdatedType = "com.xmgo.company.updated"
+	CompanyDeletedType = "com.xmgo.company.deleted"
+	// CompanySnapshotType carries the current state of a company when the
+	// companies are republished, e.g. for a consumer rebuilding its store
+	CompanySnapshotType = "com.xmgo.company.snapshot"
+)
+
+// CompanyEventsVersion is the current schema version of the company event payloads.
+// Bump it, and publish the new schemas, whenever a payload changes incompatibly.
+const CompanyEventsVersion = 1
+
+// CompanyUpdatedVersion is the schema version of the update payload, which
+// replaced the bare company with before/after states in version 2
+const CompanyUpdatedVersion = 2
+
+// Update payload modes, see EventsConf.UpdatePayload
+const (
+	UpdatePayloadFull    = "full"
+	UpdatePayloadChanges = "changes"
+)
+
+// CompanyEventPayloads are the payloads of the current version of every
+// company event type, the published JSON Schemas are generated from them
+var CompanyEventPayloads = []EventData{
+	CompanyCreated{Version: CompanyEventsVersion},
+	CompanyUpdated{Version: CompanyUpdatedVersion},
+	CompanyDeleted{Version: CompanyEventsVersion},
+	CompanySnapshot{Version: CompanyEventsVersion},
+}
+
+// TenantExtension is the CloudEvents extension attribute carrying the tenant
+const TenantExtension = "tenantid"
+
+// CompanyData is the company representation used in events. It is kept apart
+// from entity.Company so the entity can change without breaking consumers.
+type CompanyData struct {
+	ID                uuid.UUID `json:"id" avro:"id"`
+	Name              string    `json:"name" avro:"name"`
+	Description       string    `json:"description" avro:"description"`
+	AmountOfEmployees int       `json:"amount_of_employees" avro:"amount_of_employees"`
+	Registered        bool      `json:"registered" avro:"registered"`
+	Type              string    `json:"type" avro:"type"`
+	Owner             string    `json:"owner" avro:"owner"`
+	CreatedAt         time.Time `json:"created_at" avro:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" avro:"updated_at"`
+}
+
+// NewCompanyData converts a company entity to its event representation
+func NewCompanyData(c entity.Company) CompanyData {
+	return CompanyData{
+		ID:                c.ID,
+		Name:              c.Name,
+		Description:       c.Description,
+		AmountOfEmployees: c.AmountOfEmployees,
+		Registered:        c.Registered,
+		Type:              string(c.Type),
+		Owner:             c.Owner,
+		CreatedAt:         c.CreatedAt,
+		UpdatedAt:         c.UpdatedAt,
+	}
+}
+
+// CompanyCreated is the payload of com.xmgo.company.created
+type CompanyCreated struct {
+	Version int         `json:"version" avro:"version"`
+	Company CompanyData `json:"company" avro:"company"`
+}
+
+func (CompanyCreated) EventType() string    { return CompanyCreatedType }
+func (d CompanyCreated) SchemaVersion() int { return d.Version }
+
+// CompanyUpdated is the payload of com.xmgo.company.updated. It carries the
+// full before and after states, or with the changes payload mode only the
+// old and new values of the changed fields.
+type CompanyUpdated struct {
+	Version       int                    `json:"version" avro:"version"`
+	ID            uuid.UUID              `json:"id" avro:"id"`
+	Before        *CompanyData           `json:"before,omitempty" avro:"before"`
+	After         *CompanyData           `json:"after,omitempty" avro:"after"`
+	ChangedFields []string               `json:"changed_fields" avro:"changed_fields"`
+	Changes       map[string]FieldChange `json:"changes,omitempty" avro:"changes"`
+}
+
+// FieldChange is the old and new value of a changed field
+type FieldChange struct {
+	Old any `json:"old" avro:"old"`
+	New any `json:"new" avro:"new"`
+}
+
+func (CompanyUpdated) EventType() string    { return CompanyUpdatedType }
+func (d CompanyUpdated) SchemaVersion() int { return d.Version }
+
+// CompanyDeleted is the payload of com.xmgo.company.deleted
+type CompanyDeleted struct {
+	Version int       `json:"version" avro:"version"`
+	ID      uuid.UUID `json:"id" avro:"id"`
+}
+
+func (CompanyDeleted) EventType() string    { return CompanyDeletedType }
+func (d CompanyDeleted) SchemaVersion() int { return d.Version }
+
+// CompanySnapshot is the payload of com.xmgo.company.snapshot
+type CompanySnapshot struct {
+	Version int         `json:"version" avro:"version"`
+	Company CompanyData `json:"company" avro:"company"`
+}
+
+func (CompanySnapshot) EventType() string    { return CompanySnapshotType }
+func (d CompanySnapshot) SchemaVersion() int { return d.Version }
+
+// NewCompanyCreatedEvent builds the event published after a company is created
+func NewCompanyCreatedEvent(c entity.Company) *Event {
+	return newCompanyEvent(c, CompanyCreated{Version: CompanyEventsVersion, Company: NewCompanyData(c)})
+}
+
+// NewCompanyUpdatedEvent builds the event published after a company is
+// updated from its state before and after the update. payload is either
+// UpdatePayloadFull or UpdatePayloadChanges, empty means full.
+func NewCompanyUpdatedEvent(before, after entity.Company, payload string) *Event {
+	oldData, newData := NewCompanyData(before), NewCompanyData(after)
+	changes := diffCompanyData(oldData, newData)
+
+	data := CompanyUpdated{Version: CompanyUpdatedVersion, ID: after.ID, ChangedFields: make([]string, 0, len(changes))}
+	for _, change := range changes {
+		data.ChangedFields = append(data.ChangedFields, change.field)
+	}
+	if payload == UpdatePayloadChanges {
+		data.Changes = make(map[string]FieldChange, len(changes))
+		for _, change := range changes {
+			data.Changes[change.field] = FieldChange{Old: change.old, New: change.new}
+		}
+	} else {
+		data.Before, data.After = &oldData, &newData
+	}
+	return newCompanyEvent(after, data)
+}
+
+// NewCompanyDeletedEvent builds the event published after a company is deleted
+func NewCompanyDeletedEvent(c entity.Company) *Event {
+	return newCompanyEvent(c, CompanyDeleted{Version: CompanyEventsVersion, ID: c.ID})
+}
+
+// NewCompanySnapshotEvent builds the event republishing the current state of a company
+func NewCompanySnapshotEvent(c entity.Company) *Event {
+	return newCompanyEvent(c, CompanySnapshot{Version: CompanyEventsVersion, Company: NewCompanyData(c)})
+}
+
+func newCompanyEvent(c entity.Company, data EventData) *Event {
+	event := NewEvent(c.ID.String(), data)
+	if c.TenantID != "" {
+		event.Extensions[TenantExtension] = c.TenantID
+	}
+	return event
+}
+
+// fieldDiff is a changed field of CompanyData, named by its JSON name
+type fieldDiff struct {
+	field    string
+	old, new any
+}
+
+// diffCompanyData lists the fields that differ between two company states,
+// in declaration order. updated_at is left out, it changes on every update.
+func diffCompanyData(before, after CompanyData) []fieldDiff {
+	var diffs []fieldDiff
+	b, a := reflect.ValueOf(before), reflect.ValueOf(after)
+	for i := 0; i < b.NumField(); i++ {
+		name, _, _ := strings.Cut(b.Type().Field(i).Tag.Get("json"), ",")
+		if name == "updated_at" {
+			continue
+		}
+		prev, next := b.Field(i).Interface(), a.Field(i).Interface()
+		if t, ok := prev.(time.Time); ok {
+			if t.Equal(next.(time.Time)) {
+				continue
+			}
+		} else if reflect.DeepEqual(prev, next) {
+			continue
+		}
+		diffs = append(diffs, fieldDiff{field: name, old: prev, new: next})
+	}
+	return diffs
+}
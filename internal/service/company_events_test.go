@@ -0,0 +1,65 @@
+package eventservice_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/entity"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/innoglobe/xmgo/pkg/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCompanyUpdatedEvent(t *testing.T) {
+	before := entity.Company{ID: uuid.New(), Name: "Acme", AmountOfEmployees: 10, Type: entity.Corporation, UpdatedAt: time.Now()}
+	after := before
+	after.Name = "Acme Inc"
+	after.AmountOfEmployees = 12
+	after.UpdatedAt = before.UpdatedAt.Add(time.Minute)
+
+	t.Run("full", func(t *testing.T) {
+		event := eventservice.NewCompanyUpdatedEvent(before, after, eventservice.UpdatePayloadFull)
+		data, ok := event.Data.(eventservice.CompanyUpdated)
+		require.True(t, ok)
+
+		assert.Equal(t, eventservice.CompanyUpdatedVersion, data.Version)
+		assert.Equal(t, []string{"name", "amount_of_employees"}, data.ChangedFields)
+		assert.Equal(t, "Acme", data.Before.Name)
+		assert.Equal(t, "Acme Inc", data.After.Name)
+		assert.Nil(t, data.Changes)
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		event := eventservice.NewCompanyUpdatedEvent(before, after, eventservice.UpdatePayloadChanges)
+		data := event.Data.(eventservice.CompanyUpdated)
+
+		assert.Nil(t, data.Before)
+		assert.Nil(t, data.After)
+		assert.Equal(t, map[string]eventservice.FieldChange{
+			"name":                {Old: "Acme", New: "Acme Inc"},
+			"amount_of_employees": {Old: 10, New: 12},
+		}, data.Changes)
+	})
+
+	t.Run("nothing changed", func(t *testing.T) {
+		event := eventservice.NewCompanyUpdatedEvent(before, before, "")
+		data := event.Data.(eventservice.CompanyUpdated)
+		assert.Empty(t, data.ChangedFields)
+		assert.NotNil(t, data.ChangedFields)
+	})
+}
+
+func TestWithRequestID(t *testing.T) {
+	company := entity.Company{ID: uuid.New(), Name: "Acme", TenantID: "t1"}
+
+	event := eventservice.WithRequestID(context.Background(), eventservice.NewCompanyDeletedEvent(company))
+	assert.NotContains(t, event.Extensions, eventservice.RequestIDExtension)
+
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	event = eventservice.WithRequestID(ctx, eventservice.NewCompanyDeletedEvent(company))
+	assert.Equal(t, "req-1", event.Extensions[eventservice.RequestIDExtension])
+	assert.Equal(t, "t1", event.Extensions[eventservice.TenantExtension])
+}
@@ -3,76 +3,241 @@ package eventservice
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/innoglobe/xmgo/pkg/requestid"
 	"github.com/segmentio/kafka-go"
-	"log"
-	"sync"
+	"maps"
+	"slices"
+	"time"
 )
 
+const (
+	// SpecVersion is the CloudEvents version our events conform to
+	SpecVersion = "1.0"
+	// ContentTypeJSON is the content type of JSON encoded event data
+	ContentTypeJSON = "application/json"
+)
+
+// EventData is the typed payload of an event. Each payload knows its
+// CloudEvents type and the version of its schema.
+type EventData interface {
+	EventType() string
+	SchemaVersion() int
+}
+
+// Event is a CloudEvents 1.0 event
 type Event struct {
-	Operation string
-	Entity    string
-	Data      interface{}
+	ID              string
+	Source          string
+	Type            string
+	Time            time.Time
+	Subject         string
+	DataSchema      string
+	DataContentType string
+	// Extensions holds CloudEvents extension attributes, e.g. tenantid
+	Extensions map[string]string
+	Data       EventData
 }
 
-type Producer interface {
-	Produce(event *Event)
-	Close() error
+// NewEvent wraps data into an event about subject. Source and DataSchema are
+// filled in by the producer from its Envelope.
+func NewEvent(subject string, data EventData) *Event {
+	return &Event{
+		ID:              uuid.NewString(),
+		Type:            data.EventType(),
+		Time:            time.Now().UTC(),
+		Subject:         subject,
+		DataContentType: ContentTypeJSON,
+		Extensions:      map[string]string{},
+		Data:            data,
+	}
 }
 
-type KafkaProducer struct {
-	kafkaWriter *kafka.Writer
-	wg          sync.WaitGroup
-	ctx         context.Context
-	cancel      context.CancelFunc
+// Clone returns a copy of the event that can be changed independently
+func (e *Event) Clone() *Event {
+	c := *e
+	c.Extensions = maps.Clone(e.Extensions)
+	return &c
 }
 
-func NewKafkaProducer(brokers []string, topic string) *KafkaProducer {
-	ctx, cancel := context.WithCancel(context.Background())
-	return &KafkaProducer{
-		kafkaWriter: &kafka.Writer{
-			Addr:     kafka.TCP(brokers...),
-			Topic:    topic,
-			Balancer: &kafka.LeastBytes{},
-		},
-		ctx:    ctx,
-		cancel: cancel,
+// MarshalJSON encodes the event in CloudEvents structured content mode
+func (e *Event) MarshalJSON() ([]byte, error) {
+	attrs := make(map[string]interface{}, len(e.Extensions)+9)
+	for k, v := range e.Extensions {
+		attrs[k] = v
 	}
+	attrs["specversion"] = SpecVersion
+	attrs["id"] = e.ID
+	attrs["source"] = e.Source
+	attrs["type"] = e.Type
+	attrs["time"] = e.Time.Format(time.RFC3339Nano)
+	if e.Subject != "" {
+		attrs["subject"] = e.Subject
+	}
+	if e.DataSchema != "" {
+		attrs["dataschema"] = e.DataSchema
+	}
+	if e.DataContentType != "" {
+		attrs["datacontenttype"] = e.DataContentType
+	}
+	attrs["data"] = e.Data
+	return json.Marshal(attrs)
 }
 
-func (p *KafkaProducer) Produce(event *Event) {
-	p.wg.Add(1)
-	go func() {
-		defer p.wg.Done()
-		log.Printf("Produced Event: %+v\n", event)
+// CloudEvents extension attributes set by the producers
+const (
+	// PartitionKeyExtension is the key events are partitioned and ordered by,
+	// see the CloudEvents partitioning extension
+	PartitionKeyExtension = "partitionkey"
+	// SequenceExtension numbers the events of one partition key, starting at 1
+	SequenceExtension = "sequence"
+	// ProducerIDExtension identifies the producer instance that numbered the
+	// event. Sequences restart when it changes.
+	ProducerIDExtension = "producerid"
+	// RequestIDExtension is the ID of the API call or command that caused the
+	// event, as found in the X-Request-ID header of the call or the
+	// correlation ID of the command
+	RequestIDExtension = "requestid"
+)
 
-		// Serialize the event
-		eventData, err := json.Marshal(event)
-		if err != nil {
-			log.Printf("Failed to serialize event: %v\n", err)
-			return
+// WithRequestID sets the request ID found in ctx on the event, so consumers
+// can match the event with the call that caused it
+func WithRequestID(ctx context.Context, event *Event) *Event {
+	if id := requestid.FromContext(ctx); id != "" {
+		if event.Extensions == nil {
+			event.Extensions = map[string]string{}
 		}
+		event.Extensions[RequestIDExtension] = id
+	}
+	return event
+}
+
+// PartitionKey returns the key the event is ordered by, which defaults to its subject
+func (e *Event) PartitionKey() string {
+	if key := e.Extensions[PartitionKeyExtension]; key != "" {
+		return key
+	}
+	return e.Subject
+}
+
+// Envelope holds the CloudEvents attributes describing this service rather than a single event
+type Envelope struct {
+	Source        string
+	SchemaBaseURL string
+}
+
+// Apply fills in the attributes the event doesn't set itself
+func (e Envelope) Apply(event *Event) {
+	if event.Source == "" {
+		event.Source = e.Source
+	}
+	if event.DataSchema == "" && e.SchemaBaseURL != "" && event.Data != nil {
+		event.DataSchema = SchemaURL(e.SchemaBaseURL, event.Type, event.Data.SchemaVersion())
+	}
+}
+
+// SchemaURL returns where the JSON Schema of an event type and version is published
+func SchemaURL(baseURL, eventType string, version int) string {
+	return baseURL + "/" + SchemaFileName(eventType, version)
+}
+
+// SchemaFileName is the name of the JSON Schema file of an event type and version
+func SchemaFileName(eventType string, version int) string {
+	return fmt.Sprintf("%s.v%d.json", eventType, version)
+}
 
-		// Send the event to Kafka
-		err = p.kafkaWriter.WriteMessages(p.ctx,
-			kafka.Message{
-				Value: eventData,
-			},
-		)
-		if err != nil {
-			log.Printf("Failed to send event to Kafka: %v\n", err)
+// kafkaHeaders returns the event attributes as Kafka headers for binary content mode
+func kafkaHeaders(event *Event) []kafka.Header {
+	attrs := map[string]string{
+		"ce_specversion": SpecVersion,
+		"ce_id":          event.ID,
+		"ce_source":      event.Source,
+		"ce_type":        event.Type,
+		"ce_time":        event.Time.Format(time.RFC3339Nano),
+		"ce_subject":     event.Subject,
+		"ce_dataschema":  event.DataSchema,
+	}
+	for k, v := range event.Extensions {
+		attrs["ce_"+k] = v
+	}
+
+	headers := []kafka.Header{{Key: "content-type", Value: []byte(event.DataContentType)}}
+	for _, k := range slices.Sorted(maps.Keys(attrs)) {
+		if attrs[k] != "" {
+			headers = append(headers, kafka.Header{Key: k, Value: []byte(attrs[k])})
 		}
-	}()
+	}
+	return headers
 }
 
-func (p *KafkaProducer) Close() error {
-	p.cancel()
-	p.wg.Wait()
-	return p.kafkaWriter.Close()
+var (
+	// ErrQueueFull is returned by Produce when the producer can't take more events
+	ErrQueueFull = errors.New("event queue is full")
+	// ErrProducerClosed is returned by Produce once the producer is closed
+	ErrProducerClosed = errors.New("event producer is closed")
+)
+
+type Producer interface {
+	// Produce hands the event over for delivery. An error means the event was
+	// not accepted at all, delivery itself is reported through the Delivery.
+	Produce(ctx context.Context, event *Event) (*Delivery, error)
+	Close() error
+}
+
+// Delivery is the future result of delivering one event
+type Delivery struct {
+	done chan struct{}
+	err  error
 }
 
-type NoOpProducer struct{}
+func newDelivery() *Delivery {
+	return &Delivery{done: make(chan struct{})}
+}
+
+// completedDelivery returns a delivery that is already resolved with err
+func completedDelivery(err error) *Delivery {
+	d := newDelivery()
+	d.resolve(err)
+	return d
+}
 
-func (p *NoOpProducer) Produce(event *Event) {
-	log.Printf("NoOpProducer: %+v\n", event)
+func (d *Delivery) resolve(err error) {
+	d.err = err
+	close(d.done)
+}
+
+// Done is closed once the event has been delivered or given up on
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Err returns the delivery error. It is only meaningful once Done is closed.
+func (d *Delivery) Err() error {
+	return d.err
+}
+
+// Wait blocks until the event is delivered or ctx is done
+func (d *Delivery) Wait(ctx context.Context) error {
+	select {
+	case <-d.done:
+		return d.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NoOpProducer drops every event, logging it at debug level when Log is set
+type NoOpProducer struct {
+	Log logger.LoggerInterface
+}
+
+func (p *NoOpProducer) Produce(_ context.Context, event *Event) (*Delivery, error) {
+	if p.Log != nil {
+		p.Log.Debug("Dropping event", "producer", "noop", "type", event.Type, "subject", event.Subject, "event_id", event.ID)
+	}
+	return completedDelivery(nil), nil
 }
 func (p *NoOpProducer) Close() error { return nil }
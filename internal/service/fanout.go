@@ -0,0 +1,61 @@
+package eventservice
+
+import (
+	"context"
+	"errors"
+)
+
+// FanOutProducer publishes every event to several producers at once
+type FanOutProducer struct {
+	producers []Producer
+}
+
+func NewFanOutProducer(producers ...Producer) *FanOutProducer {
+	return &FanOutProducer{producers: producers}
+}
+
+// Producers returns the producers events are fanned out to
+func (p *FanOutProducer) Producers() []Producer {
+	return p.producers
+}
+
+// Produce hands a copy of the event to every producer. It only fails when no
+// producer accepted the event, the returned delivery resolves once all are done.
+func (p *FanOutProducer) Produce(ctx context.Context, event *Event) (*Delivery, error) {
+	var (
+		deliveries []*Delivery
+		rejected   []error
+	)
+	for _, producer := range p.producers {
+		d, err := producer.Produce(ctx, event.Clone())
+		if err != nil {
+			rejected = append(rejected, err)
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	if len(deliveries) == 0 {
+		return nil, errors.Join(rejected...)
+	}
+
+	combined := newDelivery()
+	go func() {
+		errs := rejected
+		for _, d := range deliveries {
+			<-d.Done()
+			if d.Err() != nil {
+				errs = append(errs, d.Err())
+			}
+		}
+		combined.resolve(errors.Join(errs...))
+	}()
+	return combined, nil
+}
+
+func (p *FanOutProducer) Close() error {
+	var errs []error
+	for _, producer := range p.producers {
+		errs = append(errs, producer.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,144 @@
+package eventservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/innoglobe/xmgo/internal/config"
+)
+
+const (
+	defaultFileMaxSizeMB  = 100
+	defaultFileMaxBackups = 5
+)
+
+// FileProducer appends events as NDJSON, one CloudEvent in structured mode
+// per line, and rotates the file once it grows past its maximum size
+type FileProducer struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	envelope   Envelope
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewFileProducer(cfg config.FileSinkConf, envelope Envelope) (*FileProducer, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("events.file.path is required")
+	}
+	p := &FileProducer{
+		path:       cfg.Path,
+		maxSize:    int64(intOr(cfg.MaxSizeMB, defaultFileMaxSizeMB)) << 20,
+		maxBackups: intOr(cfg.MaxBackups, defaultFileMaxBackups),
+		envelope:   envelope,
+	}
+	if err := p.open(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FileProducer) Produce(_ context.Context, event *Event) (*Delivery, error) {
+	p.envelope.Apply(event)
+	line, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize event: %w", err)
+	}
+	line = append(line, '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file == nil {
+		return nil, ErrProducerClosed
+	}
+	if p.size > 0 && p.size+int64(len(line)) > p.maxSize {
+		if err := p.rotate(); err != nil {
+			return completedDelivery(err), nil
+		}
+	}
+	n, err := p.file.Write(line)
+	p.size += int64(n)
+	return completedDelivery(err), nil
+}
+
+func (p *FileProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file == nil {
+		return nil
+	}
+	err := p.file.Close()
+	p.file = nil
+	return err
+}
+
+func (p *FileProducer) open() error {
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o750); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	p.file = f
+	p.size = fi.Size()
+	return nil
+}
+
+// rotate shifts events.ndjson.N to .N+1, dropping the oldest, and starts a
+// new file. Must be called with p.mu held.
+func (p *FileProducer) rotate() error {
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+	p.file = nil
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", p.path, p.maxBackups))
+	for i := p.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", p.path, i), fmt.Sprintf("%s.%d", p.path, i+1))
+	}
+	if err := os.Rename(p.path, p.path+".1"); err != nil {
+		return err
+	}
+	return p.open()
+}
+
+// StdoutProducer writes events as NDJSON to stdout, handy for local development
+type StdoutProducer struct {
+	out      io.Writer
+	envelope Envelope
+	mu       sync.Mutex
+}
+
+func NewStdoutProducer(envelope Envelope) *StdoutProducer {
+	return &StdoutProducer{out: os.Stdout, envelope: envelope}
+}
+
+func (p *StdoutProducer) Produce(_ context.Context, event *Event) (*Delivery, error) {
+	p.envelope.Apply(event)
+	line, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize event: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.out.Write(append(line, '\n'))
+	return completedDelivery(err), nil
+}
+
+func (p *StdoutProducer) Close() error { return nil }
@@ -0,0 +1,129 @@
+package eventservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/pkg/logger"
+)
+
+const (
+	// ContentTypeCloudEventsJSON is the content type of a CloudEvent in structured mode
+	ContentTypeCloudEventsJSON = "application/cloudevents+json"
+
+	defaultHTTPTimeout   = 5 * time.Second
+	defaultHTTPQueueSize = 1000
+)
+
+type httpRequest struct {
+	body     []byte
+	delivery *Delivery
+}
+
+// HTTPProducer POSTs every event in CloudEvents structured mode to a URL.
+// Events are sent one at a time, in order, by a single worker.
+type HTTPProducer struct {
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	envelope Envelope
+	log      logger.LoggerInterface
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan httpRequest
+	wg     sync.WaitGroup
+}
+
+func NewHTTPProducer(cfg config.HTTPSinkConf, envelope Envelope, log logger.LoggerInterface) (*HTTPProducer, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("events.http.url is required")
+	}
+	p := &HTTPProducer{
+		url:      cfg.URL,
+		headers:  cfg.Headers,
+		client:   &http.Client{Timeout: millisOr(cfg.TimeoutMs, defaultHTTPTimeout)},
+		envelope: envelope,
+		log:      log,
+		queue:    make(chan httpRequest, intOr(cfg.QueueSize, defaultHTTPQueueSize)),
+	}
+	p.wg.Add(1)
+	go p.worker()
+	return p, nil
+}
+
+func (p *HTTPProducer) Produce(_ context.Context, event *Event) (*Delivery, error) {
+	p.envelope.Apply(event)
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize event: %w", err)
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return nil, ErrProducerClosed
+	}
+
+	req := httpRequest{body: body, delivery: newDelivery()}
+	select {
+	case p.queue <- req:
+		return req.delivery, nil
+	default:
+		return nil, ErrQueueFull
+	}
+}
+
+func (p *HTTPProducer) worker() {
+	defer p.wg.Done()
+	for req := range p.queue {
+		err := p.post(req.body)
+		if err != nil {
+			p.log.Error("Failed to POST event", "url", p.url, "error", err)
+		}
+		req.delivery.resolve(err)
+	}
+}
+
+func (p *HTTPProducer) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentTypeCloudEventsJSON)
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// Close stops accepting events and waits for the queued ones to be sent
+func (p *HTTPProducer) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return nil
+}
@@ -0,0 +1,549 @@
+package eventservice
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Queue full policies
+const (
+	QueueFullBlock = "block"
+	QueueFullDrop  = "drop"
+)
+
+// Defaults used when a KafkaConfig value is left empty
+const (
+	defaultQueueSize       = 10000
+	defaultWorkers         = 8
+	defaultBatchSize       = 100
+	defaultEnqueueTimeout  = time.Second
+	defaultMaxRetries      = 5
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryBackoffMax = 10 * time.Second
+	defaultDeadLetterDir   = "./var/dead-letter"
+	defaultSequenceKeys    = 100000
+)
+
+// KafkaWriter writes the messages of a KafkaProducer, it is satisfied by
+// *kafka.Writer
+type KafkaWriter interface {
+	MessageWriter
+	Stats() kafka.WriterStats
+	Close() error
+}
+
+// KafkaProducer publishes events keyed by their partition key. Events wait in
+// a bounded queue per worker and every partition key is always handled by the
+// same worker, so all events of a company land on the same partition in the
+// order they were produced. Failed writes are retried with backoff, and
+// events that still fail are spooled to disk for a later replay.
+type KafkaProducer struct {
+	kafkaWriter KafkaWriter
+	// topic is where new events are written, see SetTopic
+	topic      atomic.Pointer[string]
+	envelope   Envelope
+	serializer Serializer
+	log        logger.LoggerInterface
+	producerID string
+	spool      *DeadLetterSpool
+
+	batchSize       int
+	queueFullPolicy string
+	enqueueTimeout  time.Duration
+	maxRetries      int
+	retryBackoff    time.Duration
+	retryBackoffMax time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	shards []*kafkaShard
+
+	produced atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+	inFlight atomic.Int64
+
+	wg       sync.WaitGroup
+	stopping chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// queuedEvent is an event waiting to be written, already serialized
+type queuedEvent struct {
+	event    *Event
+	msg      kafka.Message
+	delivery *Delivery
+	// span is the producer span, ended once the event is settled.
+	// traceHeaders carry its context to the consumers.
+	span         trace.Span
+	traceHeaders []kafka.Header
+}
+
+func NewKafkaProducer(cfg config.KafkaConfig, envelope Envelope, serializer Serializer, log logger.LoggerInterface) (*KafkaProducer, error) {
+	// The topic is set per message so it can change at runtime
+	writer, err := NewKafkaWriter(cfg, "")
+	if err != nil {
+		return nil, err
+	}
+	return NewKafkaProducerWithWriter(cfg, writer, envelope, serializer, log), nil
+}
+
+// NewKafkaProducerWithWriter returns a producer writing to writer instead of
+// the cluster of cfg. The writer must take the topic from the messages.
+func NewKafkaProducerWithWriter(cfg config.KafkaConfig, writer KafkaWriter, envelope Envelope, serializer Serializer, log logger.LoggerInterface) *KafkaProducer {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &KafkaProducer{
+		kafkaWriter:     writer,
+		envelope:        envelope,
+		serializer:      serializer,
+		log:             log,
+		producerID:      uuid.NewString(),
+		spool:           NewDeadLetterSpool(DeadLetterDir(cfg)),
+		batchSize:       intOr(cfg.BatchSize, defaultBatchSize),
+		queueFullPolicy: stringOr(cfg.QueueFullPolicy, QueueFullBlock),
+		enqueueTimeout:  millisOr(cfg.EnqueueTimeoutMs, defaultEnqueueTimeout),
+		maxRetries:      intOr(cfg.MaxRetries, defaultMaxRetries),
+		retryBackoff:    millisOr(cfg.RetryBackoffMs, defaultRetryBackoff),
+		retryBackoffMax: millisOr(cfg.RetryBackoffMaxMs, defaultRetryBackoffMax),
+		stopping:        make(chan struct{}),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+	p.SetTopic(cfg.Topic)
+
+	workers := intOr(cfg.Workers, defaultWorkers)
+	perShard := max(intOr(cfg.QueueSize, defaultQueueSize)/workers, 1)
+	sequenceKeys := max(intOr(cfg.SequenceKeys, defaultSequenceKeys)/workers, 1)
+	p.shards = make([]*kafkaShard, workers)
+	for i := range p.shards {
+		p.shards[i] = &kafkaShard{
+			events:       make(chan *queuedEvent, perShard),
+			sequences:    make(map[string]*list.Element),
+			recent:       list.New(),
+			sequenceKeys: sequenceKeys,
+		}
+		p.wg.Add(1)
+		go p.worker(p.shards[i].events)
+	}
+	return p
+}
+
+// NewKafkaWriter builds a writer for the configured cluster. Messages are
+// partitioned by key. Leave topic empty to set it per message.
+func NewKafkaWriter(cfg config.KafkaConfig, topic string) (*kafka.Writer, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errNoBrokers
+	}
+	transport, err := NewKafkaTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	acks, err := kafkaRequiredAcks(cfg.RequiredAcks)
+	if err != nil {
+		return nil, err
+	}
+	compression, err := kafkaCompression(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		Transport:    transport,
+		RequiredAcks: acks,
+		Compression:  compression,
+		BatchSize:    intOr(cfg.BatchSize, defaultBatchSize),
+		BatchTimeout: millisOr(cfg.LingerMs, defaultLinger),
+		WriteTimeout: millisOr(cfg.WriteTimeoutMs, defaultWriteTimeout),
+		// Retries are handled by the producer so it can back off and spool
+		MaxAttempts: 1,
+	}, nil
+}
+
+// SetTopic routes the events produced from now on to topic. Events already
+// queued keep their topic.
+func (p *KafkaProducer) SetTopic(topic string) {
+	p.topic.Store(&topic)
+}
+
+// SetKafkaTopic routes the events of the Kafka producers among producer to
+// topic, looking into fan-out producers
+func SetKafkaTopic(producer Producer, topic string) {
+	switch p := producer.(type) {
+	case *KafkaProducer:
+		p.SetTopic(topic)
+	case interface{ Producers() []Producer }:
+		for _, child := range p.Producers() {
+			SetKafkaTopic(child, topic)
+		}
+	}
+}
+
+// Produce numbers the event within its partition key and queues it on the
+// worker owning that key. When the queue is full it waits for room or fails
+// with ErrQueueFull, depending on the queue full policy.
+func (p *KafkaProducer) Produce(ctx context.Context, event *Event) (*Delivery, error) {
+	p.envelope.Apply(event)
+	key := event.PartitionKey()
+	topic := *p.topic.Load()
+	span, traceHeaders := startPublishSpan(ctx, topic, event)
+
+	// Serialize the event data, the attributes travel as headers
+	eventData, err := p.serializer.Serialize(ctx, topic, event)
+	if err != nil {
+		err = fmt.Errorf("failed to serialize event: %w", err)
+		endSpan(span, err)
+		return nil, err
+	}
+	qe := &queuedEvent{
+		event:        event,
+		msg:          kafka.Message{Topic: topic, Key: []byte(key), Value: eventData},
+		delivery:     newDelivery(),
+		span:         span,
+		traceHeaders: traceHeaders,
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		endSpan(span, ErrProducerClosed)
+		return nil, ErrProducerClosed
+	}
+
+	shard := p.shards[shardOf(key, len(p.shards))]
+	if err := shard.enqueue(ctx, qe, key, p.producerID, p.enqueueWait()); err != nil {
+		p.dropped.Add(1)
+		p.log.Warn("Dropping event", "event_id", event.ID, "type", event.Type, "error", err)
+		endSpan(span, err)
+		return nil, err
+	}
+	p.inFlight.Add(1)
+	return qe.delivery, nil
+}
+
+// KafkaProducerStats is a snapshot of the counters of a KafkaProducer
+type KafkaProducerStats struct {
+	// Produced and Failed count the events written, or given up on, since the start
+	Produced int64
+	Failed   int64
+	// Dropped counts the events rejected because their queue was full
+	Dropped int64
+	// InFlight is the number of events accepted and not delivered yet
+	InFlight      int64
+	QueueDepth    int
+	QueueCapacity int
+	// Writer holds the writer statistics since the previous call to Stats
+	Writer kafka.WriterStats
+}
+
+// Stats returns the producer counters. The writer statistics are reset on
+// every call, so there should be a single caller, such as a metrics collector.
+func (p *KafkaProducer) Stats() KafkaProducerStats {
+	stats := KafkaProducerStats{
+		Produced: p.produced.Load(),
+		Failed:   p.failed.Load(),
+		Dropped:  p.dropped.Load(),
+		InFlight: p.inFlight.Load(),
+		Writer:   p.kafkaWriter.Stats(),
+	}
+	for _, shard := range p.shards {
+		stats.QueueDepth += len(shard.events)
+		stats.QueueCapacity += cap(shard.events)
+	}
+	return stats
+}
+
+// settle resolves the delivery of an event that left the queue
+func (p *KafkaProducer) settle(qe *queuedEvent, err error) {
+	if err != nil {
+		p.failed.Add(1)
+	} else {
+		p.produced.Add(1)
+	}
+	p.inFlight.Add(-1)
+	endSpan(qe.span, err)
+	qe.delivery.resolve(err)
+}
+
+// enqueueWait returns how long Produce may wait for room in a full queue
+func (p *KafkaProducer) enqueueWait() time.Duration {
+	if p.queueFullPolicy == QueueFullDrop {
+		return 0
+	}
+	return p.enqueueTimeout
+}
+
+// kafkaShard is the queue of one worker together with the sequence counters
+// of the partition keys it owns. Only the counters of the sequenceKeys most
+// recently produced keys are kept, a key seen again after its counter was
+// dropped starts over at 1.
+type kafkaShard struct {
+	mu           sync.Mutex
+	events       chan *queuedEvent
+	sequences    map[string]*list.Element
+	recent       *list.List
+	sequenceKeys int
+}
+
+// keySequence is the last sequence number used for a partition key
+type keySequence struct {
+	key  string
+	last uint64
+}
+
+// enqueue numbers the event and queues it. Both happen under the same lock
+// so sequence numbers match the order in which the worker sees the events.
+// A number is only used up once the event is queued.
+func (s *kafkaShard) enqueue(ctx context.Context, qe *queuedEvent, key, producerID string, wait time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := qe.event
+	if event.Extensions == nil {
+		event.Extensions = map[string]string{}
+	}
+	event.Extensions[PartitionKeyExtension] = key
+	event.Extensions[SequenceExtension] = strconv.FormatUint(s.lastSequence(key)+1, 10)
+	event.Extensions[ProducerIDExtension] = producerID
+	qe.msg.Headers = append(kafkaHeaders(event), qe.traceHeaders...)
+
+	select {
+	case s.events <- qe:
+		s.advance(key)
+		return nil
+	default:
+	}
+	if wait <= 0 {
+		return ErrQueueFull
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case s.events <- qe:
+		s.advance(key)
+		return nil
+	case <-timer.C:
+		return ErrQueueFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *kafkaShard) lastSequence(key string) uint64 {
+	if e, ok := s.sequences[key]; ok {
+		return e.Value.(*keySequence).last
+	}
+	return 0
+}
+
+// advance uses up the next sequence number of key, dropping the counter of
+// the least recently produced key when there are too many
+func (s *kafkaShard) advance(key string) {
+	if e, ok := s.sequences[key]; ok {
+		e.Value.(*keySequence).last++
+		s.recent.MoveToFront(e)
+		return
+	}
+	s.sequences[key] = s.recent.PushFront(&keySequence{key: key, last: 1})
+	if s.recent.Len() > s.sequenceKeys {
+		oldest := s.recent.Remove(s.recent.Back()).(*keySequence)
+		delete(s.sequences, oldest.key)
+	}
+}
+
+// worker writes the events of its queue in batches until the queue is closed
+func (p *KafkaProducer) worker(events <-chan *queuedEvent) {
+	defer p.wg.Done()
+	for {
+		first, ok := <-events
+		if !ok {
+			return
+		}
+
+		batch := []*queuedEvent{first}
+		open := true
+	fill:
+		for open && len(batch) < p.batchSize {
+			select {
+			case qe, more := <-events:
+				if !more {
+					open = false
+					break fill
+				}
+				batch = append(batch, qe)
+			default:
+				break fill
+			}
+		}
+
+		p.writeBatch(batch)
+		if !open {
+			return
+		}
+	}
+}
+
+// writeBatch writes a batch, retrying what failed with exponential backoff and
+// jitter. Whatever is left after the last retry goes to the dead-letter spool.
+func (p *KafkaProducer) writeBatch(batch []*queuedEvent) {
+	pending := batch
+	for attempt := 0; ; attempt++ {
+		msgs := make([]kafka.Message, len(pending))
+		for i, qe := range pending {
+			msgs[i] = qe.msg
+		}
+
+		err := p.kafkaWriter.WriteMessages(p.ctx, msgs...)
+		if err == nil {
+			for _, qe := range pending {
+				p.settle(qe, nil)
+			}
+			p.log.Debug("Produced events", "count", len(pending))
+			return
+		}
+
+		var writeErrs kafka.WriteErrors
+		if errors.As(err, &writeErrs) && len(writeErrs) == len(pending) {
+			pending = p.settleWritten(pending, writeErrs)
+		}
+
+		if attempt >= p.maxRetries || p.isStopping() {
+			p.deadLetter(pending, err)
+			return
+		}
+
+		delay := p.backoff(attempt)
+		p.log.Warn("Failed to send events to Kafka, retrying", "count", len(pending), "delay", delay, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-p.stopping:
+		}
+	}
+}
+
+// settleWritten settles the events written before the first failure of their
+// partition key and returns the rest to retry. The events of a key following
+// a failed one are retried even when they were written, so they are never
+// settled before it and the key keeps its order, consumers drop the copies by
+// their sequence.
+func (p *KafkaProducer) settleWritten(pending []*queuedEvent, writeErrs kafka.WriteErrors) []*queuedEvent {
+	failedKeys := make(map[string]bool)
+	retry := pending[:0:0]
+	for i, werr := range writeErrs {
+		key := string(pending[i].msg.Key)
+		if werr != nil {
+			failedKeys[key] = true
+		}
+		if failedKeys[key] {
+			retry = append(retry, pending[i])
+		} else {
+			p.settle(pending[i], nil)
+		}
+	}
+	return retry
+}
+
+func (p *KafkaProducer) deadLetter(pending []*queuedEvent, cause error) {
+	msgs := make([]kafka.Message, len(pending))
+	for i, qe := range pending {
+		msgs[i] = qe.msg
+	}
+
+	err := fmt.Errorf("failed to send event to Kafka: %w", cause)
+	if spoolErr := p.spool.Append(*p.topic.Load(), msgs, cause); spoolErr != nil {
+		p.log.Error("Failed to spool events, they are lost", "count", len(msgs), "error", spoolErr, "send_error", cause)
+	} else {
+		p.log.Error("Spooled events to the dead-letter spool", "count", len(msgs), "send_error", cause)
+	}
+	for _, qe := range pending {
+		p.settle(qe, err)
+	}
+}
+
+// backoff returns the delay before retry number attempt+1, between half and
+// all of the exponential delay so retries of several workers spread out
+func (p *KafkaProducer) backoff(attempt int) time.Duration {
+	d := p.retryBackoff
+	for i := 0; i < attempt && d < p.retryBackoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, p.retryBackoffMax)
+	return d/2 + rand.N(d/2+1)
+}
+
+func (p *KafkaProducer) isStopping() bool {
+	select {
+	case <-p.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting events and waits for the queued ones to be written.
+// Failing writes are no longer retried but spooled right away.
+func (p *KafkaProducer) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.stopping)
+		for _, shard := range p.shards {
+			close(shard.events)
+		}
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	p.cancel()
+	return p.kafkaWriter.Close()
+}
+
+// DeadLetterDir returns the configured dead-letter spool directory
+func DeadLetterDir(cfg config.KafkaConfig) string {
+	return stringOr(cfg.DeadLetterDir, defaultDeadLetterDir)
+}
+
+func shardOf(key string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+func intOr(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+func stringOr(v, def string) string {
+	if v != "" {
+		return v
+	}
+	return def
+}
+
+func millisOr(v int, def time.Duration) time.Duration {
+	if v > 0 {
+		return time.Duration(v) * time.Millisecond
+	}
+	return def
+}
@@ -0,0 +1,342 @@
+package eventservice_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/entity"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedWriter records the messages it writes. fail decides the outcome of
+// every call, and the first call blocks until release is called when the
+// writer is gated.
+type scriptedWriter struct {
+	fail func(call int, msgs []kafka.Message) error
+
+	mu      sync.Mutex
+	calls   []time.Time
+	written []kafka.Message
+
+	gated    bool
+	entered  chan struct{}
+	released chan struct{}
+	once     sync.Once
+}
+
+func newGatedWriter() *scriptedWriter {
+	return &scriptedWriter{gated: true, entered: make(chan struct{}), released: make(chan struct{})}
+}
+
+func (w *scriptedWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	call := len(w.calls)
+	w.calls = append(w.calls, time.Now())
+	w.mu.Unlock()
+
+	if w.gated && call == 0 {
+		close(w.entered)
+		<-w.released
+	}
+
+	var err error
+	if w.fail != nil {
+		err = w.fail(call, msgs)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	writeErrs, partial := err.(kafka.WriteErrors)
+	for i, msg := range msgs {
+		if err == nil || (partial && writeErrs[i] == nil) {
+			w.written = append(w.written, msg)
+		}
+	}
+	return err
+}
+
+func (w *scriptedWriter) release() {
+	if w.gated {
+		w.once.Do(func() { close(w.released) })
+	}
+}
+
+func (w *scriptedWriter) Stats() kafka.WriterStats { return kafka.WriterStats{} }
+func (w *scriptedWriter) Close() error             { return nil }
+
+func (w *scriptedWriter) writtenMessages() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.written)
+}
+
+func (w *scriptedWriter) callTimes() []time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.calls)
+}
+
+func newTestProducer(t *testing.T, cfg config.KafkaConfig, w *scriptedWriter) *eventservice.KafkaProducer {
+	t.Helper()
+	cfg.Topic = "company_events"
+	if cfg.DeadLetterDir == "" {
+		cfg.DeadLetterDir = t.TempDir()
+	}
+	p := eventservice.NewKafkaProducerWithWriter(cfg, w, eventservice.Envelope{Source: "test"}, eventservice.JSONSerializer{}, logger.Discard())
+	t.Cleanup(func() {
+		w.release()
+		_ = p.Close()
+	})
+	return p
+}
+
+func companyEvent(id uuid.UUID) *eventservice.Event {
+	return eventservice.NewCompanyCreatedEvent(entity.Company{ID: id})
+}
+
+func header(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func sequence(t *testing.T, msg kafka.Message) int {
+	t.Helper()
+	n, err := strconv.Atoi(header(msg, "ce_sequence"))
+	require.NoError(t, err)
+	return n
+}
+
+func produce(t *testing.T, p *eventservice.KafkaProducer, key uuid.UUID) (*eventservice.Delivery, string) {
+	t.Helper()
+	event := companyEvent(key)
+	delivery, err := p.Produce(context.Background(), event)
+	require.NoError(t, err)
+	return delivery, event.ID
+}
+
+func waitAll(t *testing.T, deliveries []*eventservice.Delivery) []error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errs := make([]error, len(deliveries))
+	for i, d := range deliveries {
+		errs[i] = d.Wait(ctx)
+		require.NotErrorIs(t, errs[i], context.DeadlineExceeded)
+	}
+	return errs
+}
+
+func TestKafkaProducer_PerKeyOrderAndSequences(t *testing.T) {
+	w := &scriptedWriter{}
+	p := newTestProducer(t, config.KafkaConfig{Workers: 4, BatchSize: 7}, w)
+
+	keys := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	produced := map[string][]string{}
+	var deliveries []*eventservice.Delivery
+	for range 50 {
+		for _, key := range keys {
+			delivery, id := produce(t, p, key)
+			deliveries = append(deliveries, delivery)
+			produced[key.String()] = append(produced[key.String()], id)
+		}
+	}
+	for _, err := range waitAll(t, deliveries) {
+		assert.NoError(t, err)
+	}
+
+	written := map[string][]kafka.Message{}
+	for _, msg := range w.writtenMessages() {
+		written[string(msg.Key)] = append(written[string(msg.Key)], msg)
+	}
+	for _, key := range keys {
+		msgs := written[key.String()]
+		require.Len(t, msgs, 50)
+		for i, msg := range msgs {
+			assert.Equal(t, produced[key.String()][i], header(msg, "ce_id"), "events of a key are written in order")
+			assert.Equal(t, i+1, sequence(t, msg), "sequences of a key have no gap")
+			assert.Equal(t, key.String(), header(msg, "ce_partitionkey"))
+			assert.Equal(t, header(msgs[0], "ce_producerid"), header(msg, "ce_producerid"))
+		}
+	}
+}
+
+func TestKafkaProducer_PartialFailureKeepsKeyOrder(t *testing.T) {
+	w := newGatedWriter()
+	failing, other := uuid.New(), uuid.New()
+	// The second event of the failing key fails once, the events around it succeed
+	w.fail = func(call int, msgs []kafka.Message) error {
+		if call != 1 {
+			return nil
+		}
+		errs := make(kafka.WriteErrors, len(msgs))
+		for i, msg := range msgs {
+			if string(msg.Key) == failing.String() && header(msg, "ce_sequence") == "2" {
+				errs[i] = kafka.LeaderNotAvailable
+			}
+		}
+		return errs
+	}
+	p := newTestProducer(t, config.KafkaConfig{Workers: 1, BatchSize: 10, RetryBackoffMs: 1}, w)
+
+	// The worker is stuck writing the first event, the next ones queue up and
+	// are written as one batch
+	first, _ := produce(t, p, other)
+	<-w.entered
+	deliveries := []*eventservice.Delivery{first}
+	for _, key := range []uuid.UUID{failing, other, failing, failing} {
+		delivery, _ := produce(t, p, key)
+		deliveries = append(deliveries, delivery)
+	}
+
+	w.release()
+	for _, err := range waitAll(t, deliveries) {
+		assert.NoError(t, err)
+	}
+
+	// The last copy of every event of the failing key comes in sequence order
+	last := map[int]int{}
+	var sequences []int
+	for i, msg := range w.writtenMessages() {
+		if string(msg.Key) == failing.String() {
+			last[sequence(t, msg)] = i
+			sequences = append(sequences, sequence(t, msg))
+		}
+	}
+	assert.Equal(t, []int{1, 3, 2, 3}, sequences, "the written events following the failed one are written again")
+	assert.Less(t, last[1], last[2])
+	assert.Less(t, last[2], last[3])
+
+	// The other key wasn't held back, it is written once
+	var others []string
+	for _, msg := range w.writtenMessages() {
+		if string(msg.Key) == other.String() {
+			others = append(others, header(msg, "ce_sequence"))
+		}
+	}
+	assert.Equal(t, []string{"1", "2"}, others)
+}
+
+func TestKafkaProducer_SequenceKeysBounded(t *testing.T) {
+	w := &scriptedWriter{}
+	p := newTestProducer(t, config.KafkaConfig{Workers: 1, SequenceKeys: 2}, w)
+
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	var deliveries []*eventservice.Delivery
+	for _, key := range []uuid.UUID{a, b, a, c, a, b} {
+		delivery, _ := produce(t, p, key)
+		deliveries = append(deliveries, delivery)
+	}
+	waitAll(t, deliveries)
+
+	var got []string
+	for _, msg := range w.writtenMessages() {
+		got = append(got, fmt.Sprintf("%s%d", map[string]string{a.String(): "a", b.String(): "b", c.String(): "c"}[string(msg.Key)], sequence(t, msg)))
+	}
+	// c pushes out b, the least recently produced key, which starts over
+	assert.Equal(t, []string{"a1", "b1", "a2", "c1", "a3", "b1"}, got)
+}
+
+// fillQueue blocks the single worker of p on a write and fills its queue of
+// one event, the next event finds the queue full
+func fillQueue(t *testing.T, p *eventservice.KafkaProducer, w *scriptedWriter) []*eventservice.Delivery {
+	t.Helper()
+	first, _ := produce(t, p, uuid.New())
+	<-w.entered
+	queued, _ := produce(t, p, uuid.New())
+	return []*eventservice.Delivery{first, queued}
+}
+
+func TestKafkaProducer_QueueFullDrop(t *testing.T) {
+	w := newGatedWriter()
+	p := newTestProducer(t, config.KafkaConfig{Workers: 1, QueueSize: 1, QueueFullPolicy: eventservice.QueueFullDrop, EnqueueTimeoutMs: 5000}, w)
+	deliveries := fillQueue(t, p, w)
+
+	start := time.Now()
+	_, err := p.Produce(context.Background(), companyEvent(uuid.New()))
+	assert.ErrorIs(t, err, eventservice.ErrQueueFull)
+	assert.Less(t, time.Since(start), time.Second, "the drop policy doesn't wait for room")
+	assert.Equal(t, int64(1), p.Stats().Dropped)
+
+	w.release()
+	for _, err := range waitAll(t, deliveries) {
+		assert.NoError(t, err)
+	}
+}
+
+func TestKafkaProducer_QueueFullBlock(t *testing.T) {
+	w := newGatedWriter()
+	p := newTestProducer(t, config.KafkaConfig{Workers: 1, QueueSize: 1, QueueFullPolicy: eventservice.QueueFullBlock, EnqueueTimeoutMs: 50}, w)
+	deliveries := fillQueue(t, p, w)
+
+	// No room within the enqueue timeout
+	start := time.Now()
+	_, err := p.Produce(context.Background(), companyEvent(uuid.New()))
+	assert.ErrorIs(t, err, eventservice.ErrQueueFull)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// The caller gives up first
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Produce(ctx, companyEvent(uuid.New()))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int64(2), p.Stats().Dropped)
+
+	// Room frees up while waiting
+	type result struct {
+		delivery *eventservice.Delivery
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		delivery, err := p.Produce(context.Background(), companyEvent(uuid.New()))
+		done <- result{delivery, err}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	w.release()
+	res := <-done
+	require.NoError(t, res.err)
+	for _, err := range waitAll(t, append(deliveries, res.delivery)) {
+		assert.NoError(t, err)
+	}
+	assert.Len(t, w.writtenMessages(), 3)
+}
+
+func TestKafkaProducer_RetryBackoffCap(t *testing.T) {
+	w := &scriptedWriter{fail: func(int, []kafka.Message) error { return kafka.LeaderNotAvailable }}
+	dir := t.TempDir()
+	p := newTestProducer(t, config.KafkaConfig{Workers: 1, MaxRetries: 5, RetryBackoffMs: 20, RetryBackoffMaxMs: 40, DeadLetterDir: dir}, w)
+
+	delivery, _ := produce(t, p, uuid.New())
+	err := waitAll(t, []*eventservice.Delivery{delivery})[0]
+	assert.ErrorIs(t, err, kafka.LeaderNotAvailable)
+
+	// One write and five retries, the delay doubles from 20ms up to 40ms and
+	// is jittered down to half of it at most
+	calls := w.callTimes()
+	require.Len(t, calls, 6)
+	for i := 1; i < len(calls); i++ {
+		gap := calls[i].Sub(calls[i-1])
+		assert.GreaterOrEqual(t, gap, min(20*time.Millisecond<<(i-1), 40*time.Millisecond)/2, "retry %d", i)
+		assert.Less(t, gap, 40*time.Millisecond+30*time.Millisecond, "retry %d waited past the cap", i)
+	}
+
+	// The event that failed every retry is spooled
+	spooled, err := eventservice.NewDeadLetterSpool(dir).Count()
+	require.NoError(t, err)
+	assert.Equal(t, 1, spooled)
+	assert.Equal(t, int64(1), p.Stats().Failed)
+}
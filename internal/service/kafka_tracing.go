@@ -0,0 +1,76 @@
+package eventservice
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/innoglobe/xmgo/internal/service"
+
+// KafkaHeaderCarrier lets the OpenTelemetry propagators read and write the
+// W3C traceparent and tracestate of a Kafka message
+type KafkaHeaderCarrier struct {
+	Headers []kafka.Header
+}
+
+var _ propagation.TextMapCarrier = &KafkaHeaderCarrier{}
+
+func (c *KafkaHeaderCarrier) Get(key string) string {
+	for _, h := range c.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c *KafkaHeaderCarrier) Set(key, value string) {
+	for i, h := range c.Headers {
+		if h.Key == key {
+			c.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.Headers = append(c.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c *KafkaHeaderCarrier) Keys() []string {
+	keys := make([]string, len(c.Headers))
+	for i, h := range c.Headers {
+		keys[i] = h.Key
+	}
+	return keys
+}
+
+// startPublishSpan starts the producer span of an event and returns the trace
+// context headers of its message
+func startPublishSpan(ctx context.Context, topic string, event *Event) (trace.Span, []kafka.Header) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingMessageID(event.ID),
+			semconv.MessagingKafkaMessageKey(event.PartitionKey()),
+		),
+	)
+	carrier := &KafkaHeaderCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return span, carrier.Headers
+}
+
+// endSpan records err, if any, on the span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,151 @@
+package eventservice
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SASL mechanisms
+const (
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram-sha-256"
+	SASLScramSHA512 = "scram-sha-512"
+)
+
+// errNoBrokers is returned when kafka.brokers is empty
+var errNoBrokers = errors.New("kafka: no brokers configured")
+
+const (
+	defaultDialTimeout  = 10 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+	// kafka-go waits a full second for a batch to fill up by default, which
+	// is far too long for a service answering HTTP requests
+	defaultLinger = 10 * time.Millisecond
+)
+
+// NewKafkaTransport builds the connection settings shared by everything
+// talking to the cluster: client ID, dial timeout, TLS and SASL.
+func NewKafkaTransport(cfg config.KafkaConfig) (*kafka.Transport, error) {
+	tlsConfig, err := kafkaTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := kafkaSASLMechanism(cfg.SASL)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Transport{
+		ClientID:    cfg.ClientID,
+		DialTimeout: millisOr(cfg.DialTimeoutMs, defaultDialTimeout),
+		TLS:         tlsConfig,
+		SASL:        mechanism,
+	}, nil
+}
+
+// NewKafkaDialer builds a dialer with the same connection settings as
+// NewKafkaTransport, for the readers which don't take a transport
+func NewKafkaDialer(cfg config.KafkaConfig) (*kafka.Dialer, error) {
+	tlsConfig, err := kafkaTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := kafkaSASLMechanism(cfg.SASL)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Dialer{
+		ClientID:      cfg.ClientID,
+		Timeout:       millisOr(cfg.DialTimeoutMs, defaultDialTimeout),
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+func kafkaTLSConfig(cfg config.KafkaTLSConf) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint:gosec // opt-in for test clusters
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka tls: failed to read ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kafka tls: no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka tls: failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func kafkaSASLMechanism(cfg config.KafkaSASLConf) (sasl.Mechanism, error) {
+	switch strings.ToLower(cfg.Mechanism) {
+	case "":
+		return nil, nil
+	case SASLPlain:
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+	default:
+		return nil, fmt.Errorf("kafka sasl: unsupported mechanism %q", cfg.Mechanism)
+	}
+}
+
+func kafkaRequiredAcks(acks string) (kafka.RequiredAcks, error) {
+	switch strings.ToLower(acks) {
+	case "", "all", "-1":
+		return kafka.RequireAll, nil
+	case "one", "1":
+		return kafka.RequireOne, nil
+	case "none", "0":
+		return kafka.RequireNone, nil
+	default:
+		return 0, fmt.Errorf("kafka: unsupported required_acks %q", acks)
+	}
+}
+
+func kafkaCompression(codec string) (kafka.Compression, error) {
+	switch strings.ToLower(codec) {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("kafka: unsupported compression %q", codec)
+	}
+}
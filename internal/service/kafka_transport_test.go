@@ -0,0 +1,50 @@
+package eventservice_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/config"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKafkaWriter(t *testing.T) {
+	writer, err := eventservice.NewKafkaWriter(config.KafkaConfig{
+		Brokers:      []string{"localhost:9092"},
+		ClientID:     "xmgo-test",
+		RequiredAcks: "one",
+		Compression:  "zstd",
+		LingerMs:     5,
+		SASL:         config.KafkaSASLConf{Mechanism: "SCRAM-SHA-512", Username: "u", Password: "p"},
+	}, "company_events")
+	require.NoError(t, err)
+
+	assert.Equal(t, kafka.RequireOne, writer.RequiredAcks)
+	assert.Equal(t, kafka.Zstd, writer.Compression)
+	assert.Equal(t, 5*time.Millisecond, writer.BatchTimeout)
+	transport := writer.Transport.(*kafka.Transport)
+	assert.Equal(t, "xmgo-test", transport.ClientID)
+	assert.Equal(t, "SCRAM-SHA-512", transport.SASL.Name())
+}
+
+func TestNewKafkaWriter_InvalidSettings(t *testing.T) {
+	base := config.KafkaConfig{Brokers: []string{"localhost:9092"}}
+
+	for name, mutate := range map[string]func(*config.KafkaConfig){
+		"no brokers":  func(c *config.KafkaConfig) { c.Brokers = nil },
+		"acks":        func(c *config.KafkaConfig) { c.RequiredAcks = "two" },
+		"compression": func(c *config.KafkaConfig) { c.Compression = "brotli" },
+		"sasl":        func(c *config.KafkaConfig) { c.SASL.Mechanism = "gssapi" },
+		"ca file":     func(c *config.KafkaConfig) { c.TLS = config.KafkaTLSConf{Enabled: true, CAFile: "missing.pem"} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := base
+			mutate(&cfg)
+			_, err := eventservice.NewKafkaWriter(cfg, "")
+			assert.Error(t, err)
+		})
+	}
+}
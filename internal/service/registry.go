@@ -0,0 +1,127 @@
+package eventservice
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/pkg/logger"
+)
+
+// DefaultDriver is used when events.driver is empty
+const DefaultDriver = "kafka"
+
+const schemaRegistrationTimeout = 30 * time.Second
+
+// BackendFactory builds a producer backend from the configuration
+type BackendFactory func(cfg *config.Config, envelope Envelope, log logger.LoggerInterface) (Producer, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]BackendFactory{}
+)
+
+// RegisterBackend makes a producer backend available under name
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = factory
+}
+
+// Backends returns the names of the registered backends
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func init() {
+	RegisterBackend("kafka", func(cfg *config.Config, envelope Envelope, log logger.LoggerInterface) (Producer, error) {
+		serializer, err := NewSerializer(cfg.Events)
+		if err != nil {
+			return nil, err
+		}
+		// Refuse to start with schemas the registry finds incompatible
+		if avroSerializer, ok := serializer.(*AvroSerializer); ok {
+			ctx, cancel := context.WithTimeout(context.Background(), schemaRegistrationTimeout)
+			defer cancel()
+			if err := avroSerializer.Register(ctx, cfg.Kafka.Topic); err != nil {
+				return nil, err
+			}
+		}
+		return NewKafkaProducer(cfg.Kafka, envelope, serializer, log)
+	})
+	RegisterBackend("file", func(cfg *config.Config, envelope Envelope, _ logger.LoggerInterface) (Producer, error) {
+		return NewFileProducer(cfg.Events.File, envelope)
+	})
+	RegisterBackend("stdout", func(_ *config.Config, envelope Envelope, _ logger.LoggerInterface) (Producer, error) {
+		return NewStdoutProducer(envelope), nil
+	})
+	RegisterBackend("http", func(cfg *config.Config, envelope Envelope, log logger.LoggerInterface) (Producer, error) {
+		return NewHTTPProducer(cfg.Events.HTTP, envelope, log)
+	})
+	RegisterBackend("channel", func(cfg *config.Config, envelope Envelope, _ logger.LoggerInterface) (Producer, error) {
+		DefaultBroker.SetBuffer(cfg.Events.ChannelBuffer)
+		return &brokerProducer{broker: DefaultBroker, envelope: envelope}, nil
+	})
+	RegisterBackend("noop", func(_ *config.Config, _ Envelope, log logger.LoggerInterface) (Producer, error) {
+		return &NoOpProducer{Log: log}, nil
+	})
+}
+
+// NewProducer builds the producer selected by events.driver. Several comma
+// separated drivers are combined into a producer fanning out to all of them.
+func NewProducer(cfg *config.Config, log logger.LoggerInterface) (Producer, error) {
+	envelope := Envelope{Source: cfg.Events.Source, SchemaBaseURL: cfg.Events.SchemaBaseURL}
+
+	var producers []Producer
+	for _, name := range Drivers(cfg.Events) {
+		backendsMu.RLock()
+		factory, ok := backends[name]
+		backendsMu.RUnlock()
+		if !ok {
+			closeAll(producers)
+			return nil, fmt.Errorf("unknown events driver %q, available: %s", name, strings.Join(Backends(), ", "))
+		}
+
+		p, err := factory(cfg, envelope, log)
+		if err != nil {
+			closeAll(producers)
+			return nil, fmt.Errorf("events driver %s: %w", name, err)
+		}
+		producers = append(producers, p)
+	}
+
+	if len(producers) == 1 {
+		return producers[0], nil
+	}
+	return NewFanOutProducer(producers...), nil
+}
+
+// Drivers returns the names of the backends selected by events.driver
+func Drivers(cfg config.EventsConf) []string {
+	driver := cfg.Driver
+	if strings.TrimSpace(driver) == "" {
+		driver = DefaultDriver
+	}
+	names := strings.Split(driver, ",")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+	return names
+}
+
+func closeAll(producers []Producer) {
+	for _, p := range producers {
+		_ = p.Close()
+	}
+}
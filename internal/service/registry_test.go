@@ -0,0 +1,56 @@
+package eventservice_test
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/entity"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProducer_FanOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	cfg := &config.Config{Events: config.EventsConf{
+		Driver: "channel, file",
+		File:   config.FileSinkConf{Path: path},
+		Source: "urn:test",
+	}}
+
+	events, unsubscribe := eventservice.DefaultBroker.Subscribe()
+	defer unsubscribe()
+
+	producer, err := eventservice.NewProducer(cfg, nil)
+	require.NoError(t, err)
+
+	company := entity.Company{ID: uuid.New(), Name: "Acme"}
+	delivery, err := producer.Produce(context.Background(), eventservice.NewCompanyCreatedEvent(company))
+	require.NoError(t, err)
+	require.NoError(t, delivery.Wait(context.Background()))
+	require.NoError(t, producer.Close())
+
+	received := <-events
+	assert.Equal(t, eventservice.CompanyCreatedType, received.Type)
+	assert.Equal(t, "urn:test", received.Source)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	lines := 0
+	for s := bufio.NewScanner(f); s.Scan(); {
+		assert.Contains(t, s.Text(), `"type":"com.xmgo.company.created"`)
+		lines++
+	}
+	assert.Equal(t, 1, lines)
+}
+
+func TestNewProducer_UnknownDriver(t *testing.T) {
+	_, err := eventservice.NewProducer(&config.Config{Events: config.EventsConf{Driver: "carrier-pigeon"}}, nil)
+	assert.ErrorContains(t, err, "unknown events driver")
+}
@@ -0,0 +1,51 @@
+package eventservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/pkg/schemaregistry"
+)
+
+// Event data formats, see EventsConf.Format
+const (
+	FormatJSON = "json"
+	FormatAvro = "avro"
+)
+
+// Serializer encodes the data of an event into a Kafka message value. It
+// sets the content type, and the schema if it knows better, on the event.
+type Serializer interface {
+	Serialize(ctx context.Context, topic string, event *Event) ([]byte, error)
+}
+
+// JSONSerializer encodes event data as plain JSON
+type JSONSerializer struct{}
+
+func (JSONSerializer) Serialize(_ context.Context, _ string, event *Event) ([]byte, error) {
+	event.DataContentType = ContentTypeJSON
+	return json.Marshal(event.Data)
+}
+
+// NewSerializer builds the serializer selected by events.format
+func NewSerializer(cfg config.EventsConf) (Serializer, error) {
+	switch cfg.Format {
+	case "", FormatJSON:
+		return JSONSerializer{}, nil
+	case FormatAvro:
+		if cfg.SchemaRegistry.URL == "" {
+			return nil, fmt.Errorf("events.schema_registry.url is required for the %s format", FormatAvro)
+		}
+		return NewAvroSerializer(schemaregistry.New(schemaregistry.Config{
+			URL:      cfg.SchemaRegistry.URL,
+			Username: cfg.SchemaRegistry.Username,
+			Password: cfg.SchemaRegistry.Password,
+			Timeout:  time.Duration(cfg.SchemaRegistry.TimeoutMs) * time.Millisecond,
+		})), nil
+	default:
+		return nil, fmt.Errorf("unknown events format %q", cfg.Format)
+	}
+}
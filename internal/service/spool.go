@@ -0,0 +1,242 @@
+package eventservice
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// deadLetterFile is the file failed messages are appended to
+	deadLetterFile = "dead-letter.ndjson"
+	// replayingSuffix marks files taken over by a replay
+	replayingSuffix = ".replaying"
+	replayBatchSize = 100
+)
+
+// SpooledMessage is a Kafka message that could not be delivered, as stored in the dead-letter spool
+type SpooledMessage struct {
+	Topic    string          `json:"topic"`
+	Key      []byte          `json:"key,omitempty"`
+	Value    []byte          `json:"value"`
+	Headers  []SpooledHeader `json:"headers,omitempty"`
+	Error    string          `json:"error"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+type SpooledHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// MessageWriter writes messages to Kafka, it is satisfied by *kafka.Writer
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// DeadLetterSpool keeps messages that failed all delivery attempts on disk,
+// one JSON document per line, until they are replayed
+type DeadLetterSpool struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewDeadLetterSpool(dir string) *DeadLetterSpool {
+	return &DeadLetterSpool{dir: dir}
+}
+
+// Append stores messages in the spool
+func (s *DeadLetterSpool) Append(topic string, msgs []kafka.Message, cause error) error {
+	records := make([]SpooledMessage, len(msgs))
+	now := time.Now().UTC()
+	for i, m := range msgs {
+		records[i] = SpooledMessage{
+			Topic:    topic,
+			Key:      m.Key,
+			Value:    m.Value,
+			Error:    cause.Error(),
+			FailedAt: now,
+		}
+		if m.Topic != "" {
+			records[i].Topic = m.Topic
+		}
+		for _, h := range m.Headers {
+			records[i].Headers = append(records[i].Headers, SpooledHeader{Key: h.Key, Value: h.Value})
+		}
+	}
+	return s.appendRecords(records)
+}
+
+func (s *DeadLetterSpool) appendRecords(records []SpooledMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return err
+	}
+	// The file is opened per append so a replay can rename it away at any time
+	f, err := os.OpenFile(filepath.Join(s.dir, deadLetterFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Replay writes every spooled message to Kafka and removes it from the spool.
+// Messages that still fail are put back. It returns how many were replayed.
+func (s *DeadLetterSpool) Replay(ctx context.Context, w MessageWriter) (int, error) {
+	files, err := s.takeOver()
+	if err != nil {
+		return 0, err
+	}
+
+	var replayed int
+	for i, file := range files {
+		n, err := s.replayFile(ctx, w, file)
+		replayed += n
+		if err != nil {
+			// Hand the untouched files back as well
+			for _, rest := range files[i+1:] {
+				if err := s.requeueFile(rest, 0); err != nil {
+					return replayed, err
+				}
+			}
+			return replayed, err
+		}
+	}
+	return replayed, nil
+}
+
+// Count returns the number of messages waiting in the spool
+func (s *DeadLetterSpool) Count() (int, error) {
+	matches, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, file := range matches {
+		records, err := readSpoolFile(file)
+		if err != nil {
+			return 0, err
+		}
+		n += len(records)
+	}
+	return n, nil
+}
+
+// takeOver renames the active spool file so new failures go to a fresh one,
+// and returns every file to replay, oldest first
+func (s *DeadLetterSpool) takeOver() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := filepath.Join(s.dir, deadLetterFile)
+	if _, err := os.Stat(active); err == nil {
+		name := filepath.Join(s.dir, "dead-letter-"+strconv.FormatInt(time.Now().UnixNano(), 10)+replayingSuffix)
+		if err := os.Rename(active, name); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// Leftovers of an interrupted replay are picked up too
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+replayingSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (s *DeadLetterSpool) files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+replayingSuffix))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(s.dir, deadLetterFile)); err == nil {
+		files = append(files, filepath.Join(s.dir, deadLetterFile))
+	}
+	return files, nil
+}
+
+func (s *DeadLetterSpool) replayFile(ctx context.Context, w MessageWriter, file string) (int, error) {
+	records, err := readSpoolFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	for start := 0; start < len(records); start += replayBatchSize {
+		end := min(start+replayBatchSize, len(records))
+		msgs := make([]kafka.Message, 0, end-start)
+		for _, r := range records[start:end] {
+			msg := kafka.Message{Topic: r.Topic, Key: r.Key, Value: r.Value}
+			for _, h := range r.Headers {
+				msg.Headers = append(msg.Headers, kafka.Header{Key: h.Key, Value: h.Value})
+			}
+			msgs = append(msgs, msg)
+		}
+
+		if err := w.WriteMessages(ctx, msgs...); err != nil {
+			if rqErr := s.requeueFile(file, start); rqErr != nil {
+				return start, errors.Join(err, rqErr)
+			}
+			return start, fmt.Errorf("replay %s: %w", filepath.Base(file), err)
+		}
+	}
+
+	return len(records), os.Remove(file)
+}
+
+// requeueFile moves the records of file from index from on back into the active spool file
+func (s *DeadLetterSpool) requeueFile(file string, from int) error {
+	records, err := readSpoolFile(file)
+	if err != nil {
+		return err
+	}
+	if err := s.appendRecords(records[from:]); err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+func readSpoolFile(file string) ([]SpooledMessage, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []SpooledMessage
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var r SpooledMessage
+		if err := dec.Decode(&r); err != nil {
+			return nil, fmt.Errorf("read %s: %w", filepath.Base(file), err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
@@ -0,0 +1,70 @@
+package eventservice_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeWriter struct {
+	written []kafka.Message
+	fail    bool
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	if w.fail {
+		return errors.New("broker down")
+	}
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+func TestDeadLetterSpool_Replay(t *testing.T) {
+	spool := eventservice.NewDeadLetterSpool(t.TempDir())
+	cause := errors.New("broker down")
+
+	msgs := []kafka.Message{
+		{Key: []byte("a"), Value: []byte(`{"n":1}`), Headers: []kafka.Header{{Key: "ce_id", Value: []byte("1")}}},
+		{Key: []byte("a"), Value: []byte(`{"n":2}`)},
+	}
+	assert.NoError(t, spool.Append("company_events", msgs, cause))
+
+	n, err := spool.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	w := &fakeWriter{}
+	n, err = spool.Replay(context.Background(), w)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Len(t, w.written, 2)
+	assert.Equal(t, "company_events", w.written[0].Topic)
+	assert.Equal(t, []byte("1"), w.written[0].Headers[0].Value)
+
+	n, err = spool.Count()
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestDeadLetterSpool_ReplayFailureKeepsMessages(t *testing.T) {
+	spool := eventservice.NewDeadLetterSpool(t.TempDir())
+	assert.NoError(t, spool.Append("company_events", []kafka.Message{{Value: []byte("1")}}, errors.New("x")))
+
+	n, err := spool.Replay(context.Background(), &fakeWriter{fail: true})
+	assert.Error(t, err)
+	assert.Zero(t, n)
+
+	n, err = spool.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	w := &fakeWriter{}
+	n, err = spool.Replay(context.Background(), w)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []byte("1"), w.written[0].Value)
+}
@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/interface/repository"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const companyIDKey = attribute.Key("company.id")
+
+func start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// end records err, if any, on the span and ends it
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+type companyUsecase struct {
+	next usecase.CompanyUsecaseInterface
+}
+
+// InstrumentCompanyUsecase wraps u so every call gets its own span
+func InstrumentCompanyUsecase(u usecase.CompanyUsecaseInterface) usecase.CompanyUsecaseInterface {
+	return &companyUsecase{next: u}
+}
+
+func (u *companyUsecase) CreateCompany(ctx context.Context, company *entity.Company) (res *entity.Company, err error) {
+	ctx, span := start(ctx, "companyUsecase.CreateCompany")
+	defer func() { end(span, err) }()
+	res, err = u.next.CreateCompany(ctx, company)
+	if res != nil {
+		span.SetAttributes(companyIDKey.String(res.ID.String()))
+	}
+	return res, err
+}
+
+func (u *companyUsecase) UpdateCompany(ctx context.Context, id uuid.UUID, company *entity.Company) (res *entity.Company, err error) {
+	ctx, span := start(ctx, "companyUsecase.UpdateCompany", companyIDKey.String(id.String()))
+	defer func() { end(span, err) }()
+	return u.next.UpdateCompany(ctx, id, company)
+}
+
+func (u *companyUsecase) DeleteCompany(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := start(ctx, "companyUsecase.DeleteCompany", companyIDKey.String(id.String()))
+	defer func() { end(span, err) }()
+	return u.next.DeleteCompany(ctx, id)
+}
+
+func (u *companyUsecase) GetCompany(ctx context.Context, id uuid.UUID) (res *entity.Company, err error) {
+	ctx, span := start(ctx, "companyUsecase.GetCompany", companyIDKey.String(id.String()))
+	defer func() { end(span, err) }()
+	return u.next.GetCompany(ctx, id)
+}
+
+func (u *companyUsecase) ListCompanies(ctx context.Context, limit, offset int) (res []entity.Company, err error) {
+	ctx, span := start(ctx, "companyUsecase.ListCompanies", attribute.Int("limit", limit), attribute.Int("offset", offset))
+	defer func() { end(span, err) }()
+	return u.next.ListCompanies(ctx, limit, offset)
+}
+
+func (u *companyUsecase) GrantAccess(ctx context.Context, companyID uuid.UUID, grant *entity.CompanyGrant) (res *entity.CompanyGrant, err error) {
+	ctx, span := start(ctx, "companyUsecase.GrantAccess", companyIDKey.String(companyID.String()))
+	defer func() { end(span, err) }()
+	return u.next.GrantAccess(ctx, companyID, grant)
+}
+
+func (u *companyUsecase) ListGrants(ctx context.Context, companyID uuid.UUID) (res []entity.CompanyGrant, err error) {
+	ctx, span := start(ctx, "companyUsecase.ListGrants", companyIDKey.String(companyID.String()))
+	defer func() { end(span, err) }()
+	return u.next.ListGrants(ctx, companyID)
+}
+
+func (u *companyUsecase) RevokeGrant(ctx context.Context, companyID uuid.UUID, grantID uuid.UUID) (err error) {
+	ctx, span := start(ctx, "companyUsecase.RevokeGrant", companyIDKey.String(companyID.String()))
+	defer func() { end(span, err) }()
+	return u.next.RevokeGrant(ctx, companyID, grantID)
+}
+
+type companyRepository struct {
+	next repository.CompanyRepositoryInterface
+}
+
+// InstrumentCompanyRepository wraps r so every call gets its own span, the
+// parent of the spans of its statements
+func InstrumentCompanyRepository(r repository.CompanyRepositoryInterface) repository.CompanyRepositoryInterface {
+	return &companyRepository{next: r}
+}
+
+func (r *companyRepository) Create(ctx context.Context, company *entity.Company) (res *entity.Company, err error) {
+	ctx, span := start(ctx, "PostgresRepository.Create")
+	defer func() { end(span, err) }()
+	return r.next.Create(ctx, company)
+}
+
+func (r *companyRepository) Update(ctx context.Context, id uuid.UUID, company *entity.Company) (before, after *entity.Company, err error) {
+	ctx, span := start(ctx, "PostgresRepository.Update", companyIDKey.String(id.String()))
+	defer func() { end(span, err) }()
+	return r.next.Update(ctx, id, company)
+}
+
+func (r *companyRepository) Delete(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := start(ctx, "PostgresRepository.Delete", companyIDKey.String(id.String()))
+	defer func() { end(span, err) }()
+	return r.next.Delete(ctx, id)
+}
+
+func (r *companyRepository) Get(ctx context.Context, id uuid.UUID) (res *entity.Company, err error) {
+	ctx, span := start(ctx, "PostgresRepository.Get", companyIDKey.String(id.String()))
+	defer func() { end(span, err) }()
+	return r.next.Get(ctx, id)
+}
+
+func (r *companyRepository) List(ctx context.Context, filter repository.CompanyListFilter) (res []entity.Company, err error) {
+	ctx, span := start(ctx, "PostgresRepository.List")
+	defer func() { end(span, err) }()
+	return r.next.List(ctx, filter)
+}
+
+func (r *companyRepository) Snapshot(ctx context.Context, filter repository.CompanySnapshotFilter) (res []entity.Company, err error) {
+	ctx, span := start(ctx, "PostgresRepository.Snapshot")
+	defer func() { end(span, err) }()
+	return r.next.Snapshot(ctx, filter)
+}
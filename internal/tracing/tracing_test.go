@@ -0,0 +1,84 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/entity"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/innoglobe/xmgo/internal/tracing"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSanitizeSQL(t *testing.T) {
+	assert.Equal(t,
+		`SELECT * FROM "companies" WHERE tenant_id = $1 AND name = ? AND amount > ? LIMIT ?`,
+		tracing.SanitizeSQL(`SELECT * FROM "companies" WHERE tenant_id = $1 AND name = 'O''Brien' AND amount > 10.5 LIMIT 1`),
+	)
+	assert.Equal(t, `SELECT set_config(?, ?, true)`, tracing.SanitizeSQL(`SELECT set_config('app.tenant', 'acme', true)`))
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), config.TracingConf{Exporter: "none"})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = tracing.Setup(context.Background(), config.TracingConf{Exporter: "zipkin"})
+	assert.Error(t, err)
+	_, err = tracing.Setup(context.Background(), config.TracingConf{Exporter: "stdout", SampleRatio: 2})
+	assert.Error(t, err)
+}
+
+type fakeCompanyUsecase struct {
+	usecase.CompanyUsecaseInterface
+	ctx context.Context
+}
+
+func (u *fakeCompanyUsecase) GetCompany(ctx context.Context, id uuid.UUID) (*entity.Company, error) {
+	u.ctx = ctx
+	return &entity.Company{ID: id}, nil
+}
+
+func TestInstrumentCompanyUsecase_NestsSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "GET /api/companies/:id")
+	fake := &fakeCompanyUsecase{}
+	_, err := tracing.InstrumentCompanyUsecase(fake).GetCompany(ctx, uuid.New())
+	require.NoError(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "companyUsecase.GetCompany", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	// The wrapped usecase runs within the span, so its statements nest below it
+	assert.Equal(t, spans[0].SpanContext().SpanID(), trace.SpanContextFromContext(fake.ctx).SpanID())
+}
+
+func TestKafkaHeaderCarrier_RoundTrip(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "publish")
+	defer span.End()
+
+	propagator := propagation.TraceContext{}
+	carrier := &eventservice.KafkaHeaderCarrier{}
+	propagator.Inject(ctx, carrier)
+	require.Len(t, carrier.Headers, 1)
+	assert.Equal(t, "traceparent", carrier.Headers[0].Key)
+
+	extracted := trace.SpanContextFromContext(propagator.Extract(context.Background(), carrier))
+	assert.Equal(t, span.SpanContext().TraceID(), extracted.TraceID())
+}
@@ -0,0 +1,218 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/interface/repository"
+	"github.com/innoglobe/xmgo/pkg/logger"
+)
+
+const (
+	// APIKeyPrefix marks strings that look like one of our api keys
+	APIKeyPrefix = "xmgo_"
+
+	apiKeyPrefixBytes = 4
+	apiKeySecretBytes = 32
+	// lastUsedResolution limits how often last_used_at is written for a busy key
+	lastUsedResolution = time.Minute
+)
+
+var errInvalidAPIKey = &customerrors.UnauthorizedError{Msg: "Invalid API key"}
+
+type APIKeyUsecaseInterface interface {
+	// CreateAPIKey stores a new key and returns it together with the plaintext
+	// secret, which is never retrievable again
+	CreateAPIKey(ctx context.Context, key *entity.APIKey) (*entity.APIKey, string, error)
+	ListAPIKeys(ctx context.Context) ([]entity.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uuid.UUID) error
+	Authenticate(ctx context.Context, rawKey string, clientIP string) (*entity.APIKey, error)
+}
+
+type apiKeyUsecase struct {
+	repo repository.APIKeyRepositoryInterface
+	log  logger.LoggerInterface
+	now  func() time.Time
+}
+
+func NewAPIKeyUsecase(repo repository.APIKeyRepositoryInterface, log logger.LoggerInterface) APIKeyUsecaseInterface {
+	return &apiKeyUsecase{repo: repo, log: log, now: time.Now}
+}
+
+func (u *apiKeyUsecase) CreateAPIKey(ctx context.Context, key *entity.APIKey) (*entity.APIKey, string, error) {
+	if key == nil {
+		return nil, "", errors.New("api key can't be nil")
+	}
+
+	if len(key.Scopes) == 0 {
+		return nil, "", &customerrors.InvalidInputError{Msg: "at least one scope is required"}
+	}
+	for _, s := range key.Scopes {
+		if !slices.Contains(auth.KnownScopes, s) {
+			return nil, "", &customerrors.InvalidInputError{Msg: fmt.Sprintf("unknown scope: %s", s)}
+		}
+	}
+	for _, ip := range key.AllowedIPs {
+		if _, err := parseIPOrCIDR(ip); err != nil {
+			return nil, "", &customerrors.InvalidInputError{Msg: fmt.Sprintf("invalid allowed ip: %s", ip)}
+		}
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(u.now()) {
+		return nil, "", &customerrors.InvalidInputError{Msg: "expires_at must be in the future"}
+	}
+
+	prefix, err := randomHex(apiKeyPrefixBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(apiKeySecretBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	raw := APIKeyPrefix + prefix + "_" + secret
+
+	key.ID = uuid.Nil
+	key.Prefix = prefix
+	key.Hash = hashAPIKey(raw)
+	key.LastUsedAt = nil
+	key.RevokedAt = nil
+	if id, ok := auth.FromContext(ctx); ok {
+		key.CreatedBy = id.Subject
+	}
+	// Keys act within the tenant of the admin who created them
+	key.TenantID = auth.TenantFromContext(ctx)
+
+	res, err := u.repo.Create(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return res, raw, nil
+}
+
+func (u *apiKeyUsecase) ListAPIKeys(ctx context.Context) ([]entity.APIKey, error) {
+	return u.repo.List(ctx)
+}
+
+func (u *apiKeyUsecase) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	if id == uuid.Nil {
+		return errors.New("invalid id")
+	}
+	return u.repo.Revoke(ctx, id, u.now())
+}
+
+func (u *apiKeyUsecase) Authenticate(ctx context.Context, rawKey string, clientIP string) (*entity.APIKey, error) {
+	prefix, ok := parseAPIKeyPrefix(rawKey)
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+
+	key, err := u.repo.GetByPrefix(ctx, prefix)
+	if err != nil {
+		var nf *customerrors.RecordNotFoundError
+		if errors.As(err, &nf) {
+			return nil, errInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashAPIKey(rawKey))) != 1 {
+		return nil, errInvalidAPIKey
+	}
+	now := u.now()
+	if key.IsRevoked() {
+		return nil, &customerrors.UnauthorizedError{Msg: "API key has been revoked"}
+	}
+	if key.IsExpired(now) {
+		return nil, &customerrors.UnauthorizedError{Msg: "API key has expired"}
+	}
+	if !ipAllowed(key.AllowedIPs, clientIP) {
+		return nil, &customerrors.ForbiddenError{Msg: "API key is not allowed from this address"}
+	}
+
+	// last_used_at is informational, failing to record it doesn't fail the request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		// The key is authenticated, its tenant scopes the write
+		ctx := auth.NewContext(ctx, &auth.Identity{Subject: "apikey:" + key.Prefix, Method: auth.MethodAPIKey, TenantID: key.TenantID})
+		if err := u.repo.TouchLastUsed(ctx, key.ID, now); err != nil {
+			logger.FromContext(ctx, u.log).Warn("Failed to record the last use of an API key", "prefix", key.Prefix, "error", err)
+		} else {
+			key.LastUsedAt = &now
+		}
+	}
+
+	return key, nil
+}
+
+// parseAPIKeyPrefix extracts the public prefix from xmgo_<prefix>_<secret>
+func parseAPIKeyPrefix(raw string) (string, bool) {
+	rest, ok := strings.CutPrefix(raw, APIKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != apiKeyPrefixBytes*2 || len(secret) != apiKeySecretBytes*2 {
+		return "", false
+	}
+	return prefix, true
+}
+
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func parseIPOrCIDR(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip: %s", s)
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// ipAllowed reports whether clientIP matches the allowlist. An empty list allows any address.
+func ipAllowed(allowed []string, clientIP string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, a := range allowed {
+		n, err := parseIPOrCIDR(a)
+		if err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
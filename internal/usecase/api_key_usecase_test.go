@@ -0,0 +1,211 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apiKeyRepo keeps the keys in memory
+type apiKeyRepo struct {
+	keys     map[string]*entity.APIKey
+	touchErr error
+	touched  int
+}
+
+func newAPIKeyRepo() *apiKeyRepo {
+	return &apiKeyRepo{keys: map[string]*entity.APIKey{}}
+}
+
+func (r *apiKeyRepo) Create(_ context.Context, key *entity.APIKey) (*entity.APIKey, error) {
+	key.ID = uuid.New()
+	stored := *key
+	r.keys[key.Prefix] = &stored
+	return key, nil
+}
+
+func (r *apiKeyRepo) List(context.Context) ([]entity.APIKey, error) {
+	var res []entity.APIKey
+	for _, k := range r.keys {
+		res = append(res, *k)
+	}
+	return res, nil
+}
+
+func (r *apiKeyRepo) GetByPrefix(_ context.Context, prefix string) (*entity.APIKey, error) {
+	k, ok := r.keys[prefix]
+	if !ok {
+		return nil, &customerrors.RecordNotFoundError{}
+	}
+	res := *k
+	return &res, nil
+}
+
+func (r *apiKeyRepo) Revoke(_ context.Context, id uuid.UUID, at time.Time) error {
+	for _, k := range r.keys {
+		if k.ID == id {
+			k.RevokedAt = &at
+			return nil
+		}
+	}
+	return &customerrors.RecordNotFoundError{ID: id}
+}
+
+func (r *apiKeyRepo) TouchLastUsed(_ context.Context, id uuid.UUID, at time.Time) error {
+	r.touched++
+	if r.touchErr != nil {
+		return r.touchErr
+	}
+	for _, k := range r.keys {
+		if k.ID == id {
+			k.LastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+func createAPIKey(t *testing.T, keys usecase.APIKeyUsecaseInterface, key *entity.APIKey) (*entity.APIKey, string) {
+	t.Helper()
+	if key.Scopes == nil {
+		key.Scopes = []string{auth.ScopeCompaniesRead}
+	}
+	ctx := auth.NewContext(context.Background(), &auth.Identity{Subject: "admin", Roles: []string{auth.RoleAdmin}, TenantID: "acme"})
+	created, raw, err := keys.CreateAPIKey(ctx, key)
+	require.NoError(t, err)
+	return created, raw
+}
+
+func assertUnauthorized(t *testing.T, err error) {
+	t.Helper()
+	var unauthorized *customerrors.UnauthorizedError
+	assert.True(t, errors.As(err, &unauthorized), "expected an unauthorized error, got %v", err)
+}
+
+func TestAPIKeyUsecase_CreateAndAuthenticate(t *testing.T) {
+	repo := newAPIKeyRepo()
+	keys := usecase.NewAPIKeyUsecase(repo, logger.Discard())
+
+	created, raw := createAPIKey(t, keys, &entity.APIKey{Name: "billing", Scopes: []string{auth.ScopeCompaniesWrite}})
+	assert.True(t, strings.HasPrefix(raw, usecase.APIKeyPrefix+created.Prefix+"_"))
+	assert.NotContains(t, created.Hash, raw)
+	assert.Equal(t, "admin", created.CreatedBy)
+	assert.Equal(t, "acme", created.TenantID)
+
+	key, err := keys.Authenticate(context.Background(), raw, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, key.ID)
+	assert.Equal(t, []string{auth.ScopeCompaniesWrite}, key.Scopes)
+	assert.NotNil(t, key.LastUsedAt)
+	assert.Equal(t, 1, repo.touched)
+
+	// last_used_at is only written once per minute
+	_, err = keys.Authenticate(context.Background(), raw, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, repo.touched)
+}
+
+func TestAPIKeyUsecase_CreateValidation(t *testing.T) {
+	keys := usecase.NewAPIKeyUsecase(newAPIKeyRepo(), logger.Discard())
+	past := time.Now().Add(-time.Hour)
+
+	for name, key := range map[string]*entity.APIKey{
+		"no scope":      {Name: "k", Scopes: []string{}},
+		"unknown scope": {Name: "k", Scopes: []string{"companies:delete"}},
+		"invalid ip":    {Name: "k", Scopes: []string{auth.ScopeAdmin}, AllowedIPs: []string{"10.0.0.300"}},
+		"expired":       {Name: "k", Scopes: []string{auth.ScopeAdmin}, ExpiresAt: &past},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := keys.CreateAPIKey(context.Background(), key)
+			var invalid *customerrors.InvalidInputError
+			assert.True(t, errors.As(err, &invalid), "expected an invalid input error, got %v", err)
+		})
+	}
+}
+
+func TestAPIKeyUsecase_AuthenticateParsing(t *testing.T) {
+	keys := usecase.NewAPIKeyUsecase(newAPIKeyRepo(), logger.Discard())
+	_, raw := createAPIKey(t, keys, &entity.APIKey{Name: "k"})
+	prefix := strings.Split(raw, "_")[1]
+
+	for name, candidate := range map[string]string{
+		"empty":          "",
+		"no marker":      strings.TrimPrefix(raw, usecase.APIKeyPrefix),
+		"no secret":      usecase.APIKeyPrefix + prefix,
+		"short secret":   raw[:len(raw)-1],
+		"wrong secret":   usecase.APIKeyPrefix + prefix + "_" + strings.Repeat("0", 64),
+		"unknown prefix": usecase.APIKeyPrefix + "00000000_" + strings.Repeat("0", 64),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := keys.Authenticate(context.Background(), candidate, "10.0.0.1")
+			assertUnauthorized(t, err)
+		})
+	}
+}
+
+func TestAPIKeyUsecase_AuthenticateExpiredAndRevoked(t *testing.T) {
+	repo := newAPIKeyRepo()
+	keys := usecase.NewAPIKeyUsecase(repo, logger.Discard())
+
+	expiring, raw := createAPIKey(t, keys, &entity.APIKey{Name: "expiring"})
+	past := time.Now().Add(-time.Second)
+	repo.keys[expiring.Prefix].ExpiresAt = &past
+	_, err := keys.Authenticate(context.Background(), raw, "10.0.0.1")
+	assertUnauthorized(t, err)
+	assert.Contains(t, err.Error(), "expired")
+
+	revoked, raw := createAPIKey(t, keys, &entity.APIKey{Name: "revoked"})
+	require.NoError(t, keys.RevokeAPIKey(context.Background(), revoked.ID))
+	_, err = keys.Authenticate(context.Background(), raw, "10.0.0.1")
+	assertUnauthorized(t, err)
+	assert.Contains(t, err.Error(), "revoked")
+}
+
+func TestAPIKeyUsecase_AuthenticateAllowedIPs(t *testing.T) {
+	keys := usecase.NewAPIKeyUsecase(newAPIKeyRepo(), logger.Discard())
+	_, raw := createAPIKey(t, keys, &entity.APIKey{Name: "k", AllowedIPs: []string{"10.1.0.0/16", "192.168.1.7", "2001:db8::/32"}})
+
+	for ip, allowed := range map[string]bool{
+		"10.1.2.3":        true,
+		"192.168.1.7":     true,
+		"2001:db8::1":     true,
+		"10.2.0.1":        false,
+		"192.168.1.8":     false,
+		"2001:db9::1":     false,
+		"not-an-ip":       false,
+		"":                false,
+		"::ffff:10.1.0.1": true,
+	} {
+		t.Run(ip, func(t *testing.T) {
+			_, err := keys.Authenticate(context.Background(), raw, ip)
+			if allowed {
+				assert.NoError(t, err)
+				return
+			}
+			var forbidden *customerrors.ForbiddenError
+			assert.True(t, errors.As(err, &forbidden), "expected a forbidden error, got %v", err)
+		})
+	}
+}
+
+func TestAPIKeyUsecase_TouchLastUsedFailureIsNotFatal(t *testing.T) {
+	repo := newAPIKeyRepo()
+	repo.touchErr = errors.New("connection reset")
+	keys := usecase.NewAPIKeyUsecase(repo, logger.Discard())
+	_, raw := createAPIKey(t, keys, &entity.APIKey{Name: "k"})
+
+	key, err := keys.Authenticate(context.Background(), raw, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Nil(t, key.LastUsedAt)
+	assert.Equal(t, 1, repo.touched)
+}
@@ -4,25 +4,39 @@ import (
 	"context"
 	"errors"
 	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/customerrors"
 	"github.com/innoglobe/xmgo/internal/entity"
 	"github.com/innoglobe/xmgo/internal/interface/repository"
 	eventservice "github.com/innoglobe/xmgo/internal/service"
 )
 
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
 type CompanyUsecaseInterface interface {
 	CreateCompany(ctx context.Context, company *entity.Company) (*entity.Company, error)
 	UpdateCompany(ctx context.Context, id uuid.UUID, company *entity.Company) (*entity.Company, error)
 	DeleteCompany(ctx context.Context, id uuid.UUID) error
 	GetCompany(ctx context.Context, id uuid.UUID) (*entity.Company, error)
+	ListCompanies(ctx context.Context, limit, offset int) ([]entity.Company, error)
+	GrantAccess(ctx context.Context, companyID uuid.UUID, grant *entity.CompanyGrant) (*entity.CompanyGrant, error)
+	ListGrants(ctx context.Context, companyID uuid.UUID) ([]entity.CompanyGrant, error)
+	RevokeGrant(ctx context.Context, companyID uuid.UUID, grantID uuid.UUID) error
 }
 
 type companyUsecase struct {
 	repo          repository.CompanyRepositoryInterface
+	grants        repository.CompanyGrantRepositoryInterface
 	eventProducer eventservice.Producer
+	eventsConf    config.EventsConf
 }
 
-func NewCompanyUsecase(repo repository.CompanyRepositoryInterface, eventProducer eventservice.Producer) CompanyUsecaseInterface {
-	return &companyUsecase{repo: repo, eventProducer: eventProducer}
+func NewCompanyUsecase(repo repository.CompanyRepositoryInterface, grants repository.CompanyGrantRepositoryInterface, eventProducer eventservice.Producer, eventsConf config.EventsConf) CompanyUsecaseInterface {
+	return &companyUsecase{repo: repo, grants: grants, eventProducer: eventProducer, eventsConf: eventsConf}
 }
 
 func (u *companyUsecase) CreateCompany(ctx context.Context, company *entity.Company) (*entity.Company, error) {
@@ -30,20 +44,24 @@ func (u *companyUsecase) CreateCompany(ctx context.Context, company *entity.Comp
 		return nil, errors.New("company can't be nil")
 	}
 
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := company.Type.IsValid(); err != nil {
 		return nil, err
 	}
 
+	company.Owner = caller.Subject
 	res, err := u.repo.Create(ctx, company)
 	if err != nil {
 		return nil, err
 	}
 
-	u.eventProducer.Produce(&eventservice.Event{
-		Operation: "create",
-		Entity:    "company",
-		Data:      *res,
-	})
+	if err := u.publish(ctx, eventservice.NewCompanyCreatedEvent(*res)); err != nil {
+		return nil, err
+	}
 	return res, nil
 }
 
@@ -56,16 +74,23 @@ func (u *companyUsecase) UpdateCompany(ctx context.Context, id uuid.UUID, compan
 		return nil, err
 	}
 
-	res, err := u.repo.Update(ctx, id, company)
+	if _, err := u.authorize(ctx, id, entity.PermissionWrite); err != nil {
+		return nil, err
+	}
+
+	// Ownership is changed through grants, never by patching the record.
+	// The event diffs against the state read by the update itself, a
+	// concurrent update may have changed the company since authorize.
+	company.Owner = ""
+	before, res, err := u.repo.Update(ctx, id, company)
 	if err != nil {
 		return nil, err
 	}
 
-	u.eventProducer.Produce(&eventservice.Event{
-		Operation: "update",
-		Entity:    "company",
-		Data:      *res,
-	})
+	event := eventservice.NewCompanyUpdatedEvent(*before, *res, u.eventsConf.UpdatePayload)
+	if err := u.publish(ctx, event); err != nil {
+		return nil, err
+	}
 
 	return res, nil
 }
@@ -75,16 +100,19 @@ func (u *companyUsecase) DeleteCompany(ctx context.Context, id uuid.UUID) error
 		return errors.New("invalid id")
 	}
 
-	err := u.repo.Delete(ctx, id)
+	company, err := u.authorize(ctx, id, entity.PermissionWrite)
+	if err != nil {
+		return err
+	}
+
+	err = u.repo.Delete(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	u.eventProducer.Produce(&eventservice.Event{
-		Operation: "delete",
-		Entity:    "company",
-		Data:      id,
-	})
+	if err := u.publish(ctx, eventservice.NewCompanyDeletedEvent(*company)); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -93,5 +121,139 @@ func (u *companyUsecase) GetCompany(ctx context.Context, id uuid.UUID) (*entity.
 	if id == uuid.Nil {
 		return nil, errors.New("invalid id")
 	}
-	return u.repo.Get(ctx, id)
+	return u.authorize(ctx, id, entity.PermissionRead)
+}
+
+func (u *companyUsecase) ListCompanies(ctx context.Context, limit, offset int) ([]entity.Company, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	filter := repository.CompanyListFilter{
+		Limit:  min(limit, maxListLimit),
+		Offset: max(offset, 0),
+	}
+	if !caller.IsAdmin() {
+		filter.Viewer = viewerOf(caller)
+	}
+	return u.repo.List(ctx, filter)
+}
+
+func (u *companyUsecase) GrantAccess(ctx context.Context, companyID uuid.UUID, grant *entity.CompanyGrant) (*entity.CompanyGrant, error) {
+	if grant == nil {
+		return nil, errors.New("grant can't be nil")
+	}
+	if err := grant.PrincipalType.IsValid(); err != nil {
+		return nil, &customerrors.InvalidInputError{Msg: err.Error()}
+	}
+	if err := grant.Permission.IsValid(); err != nil {
+		return nil, &customerrors.InvalidInputError{Msg: err.Error()}
+	}
+
+	caller, err := u.authorizeOwner(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	grant.ID = uuid.Nil
+	grant.CompanyID = companyID
+	grant.GrantedBy = caller.Subject
+	return u.grants.Save(ctx, grant)
+}
+
+func (u *companyUsecase) ListGrants(ctx context.Context, companyID uuid.UUID) ([]entity.CompanyGrant, error) {
+	if _, err := u.authorizeOwner(ctx, companyID); err != nil {
+		return nil, err
+	}
+	return u.grants.List(ctx, companyID)
+}
+
+func (u *companyUsecase) RevokeGrant(ctx context.Context, companyID uuid.UUID, grantID uuid.UUID) error {
+	if _, err := u.authorizeOwner(ctx, companyID); err != nil {
+		return err
+	}
+	return u.grants.Delete(ctx, companyID, grantID)
+}
+
+// authorize loads a company and checks the caller holds the wanted permission on it.
+// Callers who can't even read the company get a not found error so its existence isn't leaked.
+func (u *companyUsecase) authorize(ctx context.Context, id uuid.UUID, wanted entity.Permission) (*entity.Company, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	company, err := u.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if caller.IsAdmin() || company.Owner == caller.Subject {
+		return company, nil
+	}
+
+	grants, err := u.grants.FindForViewer(ctx, id, *viewerOf(caller))
+	if err != nil {
+		return nil, err
+	}
+	var canRead bool
+	for _, g := range grants {
+		if g.Permission.Allows(wanted) {
+			return company, nil
+		}
+		canRead = canRead || g.Permission.Allows(entity.PermissionRead)
+	}
+	if !canRead {
+		return nil, &customerrors.RecordNotFoundError{ID: id}
+	}
+	return nil, &customerrors.ForbiddenError{Msg: "You don't have write access to this company"}
+}
+
+// authorizeOwner checks the caller may manage the grants of a company
+func (u *companyUsecase) authorizeOwner(ctx context.Context, id uuid.UUID) (*auth.Identity, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	company, err := u.authorize(ctx, id, entity.PermissionRead)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.IsAdmin() && company.Owner != caller.Subject {
+		return nil, &customerrors.ForbiddenError{Msg: "Only the owner can manage access to this company"}
+	}
+	return caller, nil
+}
+
+// publish hands an event to the producer. The change is already stored at this
+// point, so failures only surface to the caller when delivery is synchronous,
+// otherwise the producer reports them.
+func (u *companyUsecase) publish(ctx context.Context, event *eventservice.Event) error {
+	delivery, err := u.eventProducer.Produce(ctx, eventservice.WithRequestID(ctx, event))
+	if !u.eventsConf.SyncDelivery {
+		return nil
+	}
+	if err == nil {
+		err = delivery.Wait(ctx)
+	}
+	if err != nil {
+		return &customerrors.EventDeliveryError{Msg: err.Error()}
+	}
+	return nil
+}
+
+func callerFromContext(ctx context.Context) (*auth.Identity, error) {
+	caller, ok := auth.FromContext(ctx)
+	if !ok || caller.Subject == "" {
+		return nil, &customerrors.UnauthorizedError{Msg: "Caller identity is required"}
+	}
+	return caller, nil
+}
+
+func viewerOf(caller *auth.Identity) *repository.CompanyViewer {
+	return &repository.CompanyViewer{Subject: caller.Subject, Groups: caller.Groups}
 }
@@ -0,0 +1,287 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/auth"
+	"github.com/innoglobe/xmgo/internal/config"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/interface/repository"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// companyRepo keeps the companies in memory
+type companyRepo struct {
+	repository.CompanyRepositoryInterface
+	companies map[uuid.UUID]entity.Company
+	// beforeUpdate runs between the authorization and the update, like a
+	// concurrent request would
+	beforeUpdate func()
+	listed       repository.CompanyListFilter
+}
+
+func (r *companyRepo) Create(_ context.Context, company *entity.Company) (*entity.Company, error) {
+	company.ID = uuid.New()
+	r.companies[company.ID] = *company
+	return company, nil
+}
+
+func (r *companyRepo) Get(_ context.Context, id uuid.UUID) (*entity.Company, error) {
+	c, ok := r.companies[id]
+	if !ok {
+		return nil, &customerrors.RecordNotFoundError{ID: id}
+	}
+	return &c, nil
+}
+
+func (r *companyRepo) Update(_ context.Context, id uuid.UUID, company *entity.Company) (*entity.Company, *entity.Company, error) {
+	if r.beforeUpdate != nil {
+		r.beforeUpdate()
+	}
+	before, ok := r.companies[id]
+	if !ok {
+		return nil, nil, &customerrors.RecordNotFoundError{ID: id}
+	}
+	after := before
+	if company.Name != "" {
+		after.Name = company.Name
+	}
+	if company.AmountOfEmployees != 0 {
+		after.AmountOfEmployees = company.AmountOfEmployees
+	}
+	r.companies[id] = after
+	return &before, &after, nil
+}
+
+func (r *companyRepo) Delete(_ context.Context, id uuid.UUID) error {
+	delete(r.companies, id)
+	return nil
+}
+
+func (r *companyRepo) List(_ context.Context, filter repository.CompanyListFilter) ([]entity.Company, error) {
+	r.listed = filter
+	return nil, nil
+}
+
+// grantRepo keeps the grants in memory
+type grantRepo struct {
+	grants []entity.CompanyGrant
+}
+
+func (r *grantRepo) Save(_ context.Context, grant *entity.CompanyGrant) (*entity.CompanyGrant, error) {
+	grant.ID = uuid.New()
+	r.grants = append(r.grants, *grant)
+	return grant, nil
+}
+
+func (r *grantRepo) List(_ context.Context, companyID uuid.UUID) ([]entity.CompanyGrant, error) {
+	var res []entity.CompanyGrant
+	for _, g := range r.grants {
+		if g.CompanyID == companyID {
+			res = append(res, g)
+		}
+	}
+	return res, nil
+}
+
+func (r *grantRepo) Delete(_ context.Context, companyID uuid.UUID, grantID uuid.UUID) error {
+	r.grants = slices.DeleteFunc(r.grants, func(g entity.CompanyGrant) bool { return g.CompanyID == companyID && g.ID == grantID })
+	return nil
+}
+
+func (r *grantRepo) FindForViewer(_ context.Context, companyID uuid.UUID, viewer repository.CompanyViewer) ([]entity.CompanyGrant, error) {
+	var res []entity.CompanyGrant
+	for _, g := range r.grants {
+		if g.CompanyID != companyID {
+			continue
+		}
+		if (g.PrincipalType == entity.PrincipalUser && g.Principal == viewer.Subject) ||
+			(g.PrincipalType == entity.PrincipalGroup && slices.Contains(viewer.Groups, g.Principal)) {
+			res = append(res, g)
+		}
+	}
+	return res, nil
+}
+
+// recordingProducer keeps the published events
+type recordingProducer struct {
+	events []*eventservice.Event
+}
+
+func (p *recordingProducer) Produce(ctx context.Context, event *eventservice.Event) (*eventservice.Delivery, error) {
+	p.events = append(p.events, event)
+	return (&eventservice.NoOpProducer{}).Produce(ctx, event)
+}
+
+func (p *recordingProducer) Close() error { return nil }
+
+type companyFixture struct {
+	companies usecase.CompanyUsecaseInterface
+	repo      *companyRepo
+	grants    *grantRepo
+	producer  *recordingProducer
+	company   entity.Company
+}
+
+// newCompanyFixture stores a company owned by alice, granting bob read
+// access and the auditors group write access
+func newCompanyFixture() *companyFixture {
+	f := &companyFixture{
+		repo:     &companyRepo{companies: map[uuid.UUID]entity.Company{}},
+		grants:   &grantRepo{},
+		producer: &recordingProducer{},
+	}
+	f.companies = usecase.NewCompanyUsecase(f.repo, f.grants, f.producer, config.EventsConf{})
+	f.company = entity.Company{ID: uuid.New(), Name: "Acme", AmountOfEmployees: 10, Type: entity.Corporation, Owner: "alice"}
+	f.repo.companies[f.company.ID] = f.company
+	f.grants.grants = []entity.CompanyGrant{
+		{ID: uuid.New(), CompanyID: f.company.ID, PrincipalType: entity.PrincipalUser, Principal: "bob", Permission: entity.PermissionRead},
+		{ID: uuid.New(), CompanyID: f.company.ID, PrincipalType: entity.PrincipalGroup, Principal: "auditors", Permission: entity.PermissionWrite},
+	}
+	return f
+}
+
+func as(subject string, groups []string, roles ...string) context.Context {
+	return auth.NewContext(context.Background(), &auth.Identity{Subject: subject, Groups: groups, Roles: roles})
+}
+
+func isNotFound(err error) bool {
+	var nf *customerrors.RecordNotFoundError
+	return errors.As(err, &nf)
+}
+
+func isForbidden(err error) bool {
+	var forbidden *customerrors.ForbiddenError
+	return errors.As(err, &forbidden)
+}
+
+func TestCompanyUsecase_Access(t *testing.T) {
+	for name, tc := range map[string]struct {
+		ctx           context.Context
+		read, write   bool
+		manageGrants  bool
+		hiddenOnWrite bool
+	}{
+		"owner":       {ctx: as("alice", nil), read: true, write: true, manageGrants: true},
+		"admin":       {ctx: as("root", nil, auth.RoleAdmin), read: true, write: true, manageGrants: true},
+		"read grant":  {ctx: as("bob", nil), read: true},
+		"group grant": {ctx: as("carol", []string{"staff", "auditors"}), read: true, write: true},
+		"denied":      {ctx: as("mallory", []string{"staff"}), hiddenOnWrite: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newCompanyFixture()
+			id := f.company.ID
+
+			_, err := f.companies.GetCompany(tc.ctx, id)
+			if tc.read {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, isNotFound(err), "reading: %v", err)
+			}
+
+			_, err = f.companies.UpdateCompany(tc.ctx, id, &entity.Company{Name: "Acme 2", Type: entity.Corporation})
+			switch {
+			case tc.write:
+				assert.NoError(t, err)
+			case tc.hiddenOnWrite:
+				assert.True(t, isNotFound(err), "writing: %v", err)
+			default:
+				assert.True(t, isForbidden(err), "writing: %v", err)
+			}
+
+			_, err = f.companies.ListGrants(tc.ctx, id)
+			switch {
+			case tc.manageGrants:
+				assert.NoError(t, err)
+			case tc.read:
+				assert.True(t, isForbidden(err), "listing grants: %v", err)
+			default:
+				assert.True(t, isNotFound(err), "listing grants: %v", err)
+			}
+		})
+	}
+}
+
+func TestCompanyUsecase_RequiresIdentity(t *testing.T) {
+	f := newCompanyFixture()
+
+	_, err := f.companies.GetCompany(context.Background(), f.company.ID)
+	var unauthorized *customerrors.UnauthorizedError
+	assert.True(t, errors.As(err, &unauthorized))
+}
+
+func TestCompanyUsecase_OwnerManagesGrants(t *testing.T) {
+	f := newCompanyFixture()
+	ctx := as("alice", nil)
+
+	grant, err := f.companies.GrantAccess(ctx, f.company.ID, &entity.CompanyGrant{PrincipalType: entity.PrincipalUser, Principal: "dave", Permission: entity.PermissionWrite})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", grant.GrantedBy)
+	assert.Equal(t, f.company.ID, grant.CompanyID)
+
+	_, err = f.companies.UpdateCompany(as("dave", nil), f.company.ID, &entity.Company{Name: "Dave's", Type: entity.Corporation})
+	require.NoError(t, err)
+
+	require.NoError(t, f.companies.RevokeGrant(ctx, f.company.ID, grant.ID))
+	_, err = f.companies.GetCompany(as("dave", nil), f.company.ID)
+	assert.True(t, isNotFound(err))
+
+	// Write access isn't enough to manage access
+	_, err = f.companies.GrantAccess(as("carol", []string{"auditors"}), f.company.ID, &entity.CompanyGrant{PrincipalType: entity.PrincipalUser, Principal: "eve", Permission: entity.PermissionRead})
+	assert.True(t, isForbidden(err))
+}
+
+func TestCompanyUsecase_CreateSetsOwner(t *testing.T) {
+	f := newCompanyFixture()
+
+	res, err := f.companies.CreateCompany(as("bob", nil), &entity.Company{Name: "Bob Inc", Type: entity.Corporation, Owner: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, "bob", res.Owner)
+}
+
+func TestCompanyUsecase_ListCompaniesViewer(t *testing.T) {
+	f := newCompanyFixture()
+
+	_, err := f.companies.ListCompanies(as("carol", []string{"auditors"}), 0, -5)
+	require.NoError(t, err)
+	require.NotNil(t, f.repo.listed.Viewer)
+	assert.Equal(t, repository.CompanyViewer{Subject: "carol", Groups: []string{"auditors"}}, *f.repo.listed.Viewer)
+	assert.Equal(t, 50, f.repo.listed.Limit)
+	assert.Zero(t, f.repo.listed.Offset)
+
+	_, err = f.companies.ListCompanies(as("root", nil, auth.RoleAdmin), 10000, 20)
+	require.NoError(t, err)
+	assert.Nil(t, f.repo.listed.Viewer)
+	assert.Equal(t, 500, f.repo.listed.Limit)
+	assert.Equal(t, 20, f.repo.listed.Offset)
+
+	_, err = f.companies.ListCompanies(context.Background(), 10, 0)
+	assert.Error(t, err)
+}
+
+func TestCompanyUsecase_UpdateEventDiffsTheOverwrittenState(t *testing.T) {
+	f := newCompanyFixture()
+	// Another update lands after the authorization read
+	f.repo.beforeUpdate = func() {
+		c := f.repo.companies[f.company.ID]
+		c.AmountOfEmployees = 20
+		f.repo.companies[f.company.ID] = c
+	}
+
+	_, err := f.companies.UpdateCompany(as("alice", nil), f.company.ID, &entity.Company{AmountOfEmployees: 30, Type: entity.Corporation})
+	require.NoError(t, err)
+
+	require.Len(t, f.producer.events, 1)
+	data := f.producer.events[0].Data.(eventservice.CompanyUpdated)
+	assert.Equal(t, 20, data.Before.AmountOfEmployees)
+	assert.Equal(t, 30, data.After.AmountOfEmployees)
+	assert.Equal(t, []string{"amount_of_employees"}, data.ChangedFields)
+}
@@ -0,0 +1,163 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/customerrors"
+	"github.com/innoglobe/xmgo/internal/interface/repository"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+)
+
+const defaultSnapshotBatchSize = 500
+
+// RepublishCheckpointDir is where the republish checkpoints are kept by default
+const RepublishCheckpointDir = "var/checkpoints"
+
+// DefaultRepublishRate is the events published per second when no rate is given
+const DefaultRepublishRate = 100
+
+// Checkpoint remembers the ID of the last company republished, so an
+// interrupted republish can resume after it
+type Checkpoint interface {
+	Load() (string, error)
+	Save(value string) error
+}
+
+// RepublishCheckpointPath is the checkpoint file in dir of a republish of the
+// companies of tenant selected by filter. A filtered republish gets a file of
+// its own, named after a hash of the filters, so it never resumes where a
+// differently filtered one stopped. AfterID and Limit aren't part of the name.
+func RepublishCheckpointPath(dir, tenant string, filter repository.CompanySnapshotFilter) string {
+	name := "republish-" + tenant
+	if filter.Type != "" || filter.Registered != nil || !filter.UpdatedSince.IsZero() {
+		var registered, updatedSince string
+		if filter.Registered != nil {
+			registered = strconv.FormatBool(*filter.Registered)
+		}
+		if !filter.UpdatedSince.IsZero() {
+			updatedSince = filter.UpdatedSince.UTC().Format(time.RFC3339Nano)
+		}
+		sum := sha256.Sum256([]byte(string(filter.Type) + "|" + registered + "|" + updatedSince))
+		name += "-" + hex.EncodeToString(sum[:4])
+	}
+	return filepath.Join(dir, name)
+}
+
+// RepublishOptions controls a republish. Filter.AfterID skips the companies
+// up to and including that ID, when it is empty the checkpoint is resumed.
+type RepublishOptions struct {
+	Filter repository.CompanySnapshotFilter
+	// RatePerSecond limits the events published per second, 0 is unlimited
+	RatePerSecond int
+	// DryRun only counts the companies that would be republished
+	DryRun     bool
+	Checkpoint Checkpoint
+	// Progress, when set, is called after every page
+	Progress func(RepublishResult)
+}
+
+// RepublishResult reports how far a republish got
+type RepublishResult struct {
+	Matched   int       `json:"matched"`
+	Published int       `json:"published"`
+	LastID    uuid.UUID `json:"last_id"`
+	DryRun    bool      `json:"dry_run"`
+}
+
+type SnapshotUsecaseInterface interface {
+	Republish(ctx context.Context, opts RepublishOptions) (RepublishResult, error)
+}
+
+type snapshotUsecase struct {
+	repo          repository.CompanyRepositoryInterface
+	eventProducer eventservice.Producer
+}
+
+func NewSnapshotUsecase(repo repository.CompanyRepositoryInterface, eventProducer eventservice.Producer) SnapshotUsecaseInterface {
+	return &snapshotUsecase{repo: repo, eventProducer: eventProducer}
+}
+
+// Republish walks through the companies of the caller's tenant in ID order
+// and publishes a snapshot event for each. The checkpoint only moves once
+// every event of a page is delivered, so resuming never skips a company.
+func (u *snapshotUsecase) Republish(ctx context.Context, opts RepublishOptions) (RepublishResult, error) {
+	res := RepublishResult{DryRun: opts.DryRun}
+
+	filter := opts.Filter
+	if filter.AfterID == uuid.Nil && opts.Checkpoint != nil {
+		saved, err := opts.Checkpoint.Load()
+		if err != nil {
+			return res, err
+		}
+		if saved != "" {
+			if filter.AfterID, err = uuid.Parse(saved); err != nil {
+				return res, &customerrors.InvalidInputError{Msg: "Invalid checkpoint: " + saved}
+			}
+		}
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultSnapshotBatchSize
+	}
+
+	var tick <-chan time.Time
+	if opts.RatePerSecond > 0 && !opts.DryRun {
+		ticker := time.NewTicker(time.Second / time.Duration(opts.RatePerSecond))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		companies, err := u.repo.Snapshot(ctx, filter)
+		if err != nil {
+			return res, err
+		}
+		if len(companies) == 0 {
+			return res, nil
+		}
+		res.Matched += len(companies)
+
+		if !opts.DryRun {
+			deliveries := make([]*eventservice.Delivery, 0, len(companies))
+			for _, company := range companies {
+				if tick != nil {
+					select {
+					case <-tick:
+					case <-ctx.Done():
+						return res, ctx.Err()
+					}
+				}
+				delivery, err := u.eventProducer.Produce(ctx, eventservice.WithRequestID(ctx, eventservice.NewCompanySnapshotEvent(company)))
+				if err != nil {
+					return res, &customerrors.EventDeliveryError{Msg: err.Error()}
+				}
+				deliveries = append(deliveries, delivery)
+			}
+			for _, delivery := range deliveries {
+				if err := delivery.Wait(ctx); err != nil {
+					return res, &customerrors.EventDeliveryError{Msg: err.Error()}
+				}
+			}
+			res.Published += len(companies)
+		}
+
+		filter.AfterID = companies[len(companies)-1].ID
+		res.LastID = filter.AfterID
+		if opts.Checkpoint != nil && !opts.DryRun {
+			if err := opts.Checkpoint.Save(res.LastID.String()); err != nil {
+				return res, err
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(res)
+		}
+		if len(companies) < filter.Limit {
+			return res, nil
+		}
+	}
+}
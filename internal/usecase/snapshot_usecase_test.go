@@ -0,0 +1,124 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/innoglobe/xmgo/internal/entity"
+	"github.com/innoglobe/xmgo/internal/interface/repository"
+	eventservice "github.com/innoglobe/xmgo/internal/service"
+	"github.com/innoglobe/xmgo/internal/usecase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// snapshotRepo serves Snapshot pages from memory, the other methods aren't used
+type snapshotRepo struct {
+	repository.CompanyRepositoryInterface
+	companies []entity.Company
+}
+
+func (r *snapshotRepo) Snapshot(_ context.Context, filter repository.CompanySnapshotFilter) ([]entity.Company, error) {
+	var page []entity.Company
+	for _, c := range r.companies {
+		if c.ID.String() > filter.AfterID.String() && len(page) < filter.Limit {
+			page = append(page, c)
+		}
+	}
+	return page, nil
+}
+
+// failingProducer fails every delivery after the first ok ones
+type failingProducer struct {
+	ok        int
+	published []string
+}
+
+func (p *failingProducer) Produce(_ context.Context, event *eventservice.Event) (*eventservice.Delivery, error) {
+	if len(p.published) >= p.ok {
+		return nil, errors.New("broker down")
+	}
+	p.published = append(p.published, event.Subject)
+	return (&eventservice.NoOpProducer{}).Produce(context.Background(), event)
+}
+
+func (p *failingProducer) Close() error { return nil }
+
+type memCheckpoint struct{ value string }
+
+func (c *memCheckpoint) Load() (string, error)   { return c.value, nil }
+func (c *memCheckpoint) Save(value string) error { c.value = value; return nil }
+
+func TestSnapshotUsecase_RepublishResumes(t *testing.T) {
+	repo := &snapshotRepo{}
+	for range 5 {
+		repo.companies = append(repo.companies, entity.Company{ID: uuid.New()})
+	}
+	slices.SortFunc(repo.companies, func(a, b entity.Company) int { return compareIDs(a.ID, b.ID) })
+	cp := &memCheckpoint{}
+	filter := repository.CompanySnapshotFilter{Limit: 2}
+
+	// The third event fails: only the first page is checkpointed
+	producer := &failingProducer{ok: 2}
+	res, err := usecase.NewSnapshotUsecase(repo, producer).Republish(context.Background(), usecase.RepublishOptions{Filter: filter, Checkpoint: cp})
+	require.Error(t, err)
+	assert.Equal(t, 2, res.Published)
+	assert.Equal(t, repo.companies[1].ID.String(), cp.value)
+
+	producer = &failingProducer{ok: 10}
+	res, err = usecase.NewSnapshotUsecase(repo, producer).Republish(context.Background(), usecase.RepublishOptions{Filter: filter, Checkpoint: cp})
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Published)
+	assert.Equal(t, []string{repo.companies[2].ID.String(), repo.companies[3].ID.String(), repo.companies[4].ID.String()}, producer.published)
+}
+
+func TestSnapshotUsecase_DryRun(t *testing.T) {
+	repo := &snapshotRepo{companies: []entity.Company{{ID: uuid.New()}, {ID: uuid.New()}, {ID: uuid.New()}}}
+	slices.SortFunc(repo.companies, func(a, b entity.Company) int { return compareIDs(a.ID, b.ID) })
+	producer := &failingProducer{}
+
+	res, err := usecase.NewSnapshotUsecase(repo, producer).Republish(context.Background(), usecase.RepublishOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Matched)
+	assert.Zero(t, res.Published)
+	assert.Empty(t, producer.published)
+}
+
+func TestRepublishCheckpointPath(t *testing.T) {
+	registered, unregistered := true, false
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	path := func(filter repository.CompanySnapshotFilter) string {
+		return usecase.RepublishCheckpointPath("var/checkpoints", "acme", filter)
+	}
+
+	assert.Equal(t, filepath.Join("var", "checkpoints", "republish-acme"), path(repository.CompanySnapshotFilter{}))
+	assert.Equal(t, path(repository.CompanySnapshotFilter{}), path(repository.CompanySnapshotFilter{AfterID: uuid.New(), Limit: 10}), "the position isn't a filter")
+	assert.Equal(t,
+		path(repository.CompanySnapshotFilter{Registered: &registered, UpdatedSince: since}),
+		path(repository.CompanySnapshotFilter{Registered: &registered, UpdatedSince: since.In(time.FixedZone("CET", 3600))}),
+	)
+
+	// Every filter set has a checkpoint of its own
+	paths := map[string]bool{}
+	for _, filter := range []repository.CompanySnapshotFilter{
+		{},
+		{Type: entity.NonProfit},
+		{Registered: &registered},
+		{Registered: &unregistered},
+		{UpdatedSince: since},
+		{Type: entity.NonProfit, Registered: &registered, UpdatedSince: since},
+	} {
+		paths[path(filter)] = true
+	}
+	assert.Len(t, paths, 6)
+}
+
+func compareIDs(a, b uuid.UUID) int {
+	return strings.Compare(a.String(), b.String())
+}
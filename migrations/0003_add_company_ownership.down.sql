@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS company_grants;
+
+ALTER TABLE companies DROP COLUMN IF EXISTS owner;
\ No newline at end of file
@@ -0,0 +1,17 @@
+-- Companies created before ownership was tracked have no owner and are only visible to admins
+ALTER TABLE companies ADD COLUMN owner VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX companies_owner_idx ON companies (owner);
+
+CREATE TABLE company_grants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    company_id UUID NOT NULL REFERENCES companies (id) ON DELETE CASCADE,
+    principal_type VARCHAR(10) NOT NULL,
+    principal VARCHAR(255) NOT NULL,
+    permission VARCHAR(10) NOT NULL,
+    granted_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (company_id, principal_type, principal)
+);
+
+CREATE INDEX company_grants_principal_idx ON company_grants (principal_type, principal);
\ No newline at end of file
@@ -0,0 +1,17 @@
+DROP POLICY IF EXISTS company_grants_tenant_isolation ON company_grants;
+ALTER TABLE company_grants NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE company_grants DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS companies_tenant_isolation ON companies;
+ALTER TABLE companies NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE companies DISABLE ROW LEVEL SECURITY;
+
+DROP INDEX IF EXISTS api_keys_tenant_id_idx;
+DROP INDEX IF EXISTS company_grants_tenant_id_idx;
+
+ALTER TABLE companies DROP CONSTRAINT companies_tenant_id_name_key;
+ALTER TABLE companies ADD CONSTRAINT companies_name_key UNIQUE (name);
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE company_grants DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE companies DROP COLUMN IF EXISTS tenant_id;
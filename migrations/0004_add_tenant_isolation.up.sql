@@ -0,0 +1,25 @@
+-- Existing rows belong to the default tenant
+ALTER TABLE companies ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE company_grants ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+-- Company names only have to be unique within a tenant
+ALTER TABLE companies DROP CONSTRAINT companies_name_key;
+ALTER TABLE companies ADD CONSTRAINT companies_tenant_id_name_key UNIQUE (tenant_id, name);
+
+CREATE INDEX company_grants_tenant_id_idx ON company_grants (tenant_id);
+CREATE INDEX api_keys_tenant_id_idx ON api_keys (tenant_id);
+
+-- The application sets app.tenant_id per transaction. FORCE makes the policies
+-- apply to the table owner too, only superusers and BYPASSRLS roles skip them.
+ALTER TABLE companies ENABLE ROW LEVEL SECURITY;
+ALTER TABLE companies FORCE ROW LEVEL SECURITY;
+CREATE POLICY companies_tenant_isolation ON companies
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE company_grants ENABLE ROW LEVEL SECURITY;
+ALTER TABLE company_grants FORCE ROW LEVEL SECURITY;
+CREATE POLICY company_grants_tenant_isolation ON company_grants
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,4 @@
+DROP POLICY IF EXISTS api_keys_prefix_lookup ON api_keys;
+DROP POLICY IF EXISTS api_keys_tenant_isolation ON api_keys;
+ALTER TABLE api_keys NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE api_keys DISABLE ROW LEVEL SECURITY;
@@ -0,0 +1,11 @@
+-- api_keys follow the tenant isolation of companies and company_grants
+ALTER TABLE api_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE api_keys FORCE ROW LEVEL SECURITY;
+CREATE POLICY api_keys_tenant_isolation ON api_keys
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+-- The tenant of a key is only known once the key is authenticated: the
+-- lookup sets app.api_key_prefix, which exposes that single key
+CREATE POLICY api_keys_prefix_lookup ON api_keys FOR SELECT
+    USING (prefix = current_setting('app.api_key_prefix', true));
@@ -0,0 +1,52 @@
+// Package checkpoint remembers how far a long running job got, so it can
+// resume where it stopped
+package checkpoint
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File stores a checkpoint as a single line of text in a file
+type File struct {
+	Path string
+}
+
+func NewFile(path string) *File {
+	return &File{Path: path}
+}
+
+// Load returns the saved checkpoint, or an empty string when there is none
+func (f *File) Load() (string, error) {
+	b, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Save replaces the checkpoint. The file is written next to the old one and
+// renamed over it, so a crash never leaves a half written checkpoint.
+func (f *File) Save(value string) error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o750); err != nil {
+		return err
+	}
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(value+"\n"), 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+// Clear removes the checkpoint, e.g. once the job is complete
+func (f *File) Clear() error {
+	if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
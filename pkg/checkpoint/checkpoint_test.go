@@ -0,0 +1,60 @@
+package checkpoint_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/innoglobe/xmgo/pkg/checkpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile_SaveLoadClear(t *testing.T) {
+	cp := checkpoint.NewFile(filepath.Join(t.TempDir(), "republish", "last_id"))
+
+	// No checkpoint yet
+	value, err := cp.Load()
+	require.NoError(t, err)
+	assert.Empty(t, value)
+
+	// Saving creates the directory and replaces the previous value
+	require.NoError(t, cp.Save("first"))
+	require.NoError(t, cp.Save("second"))
+	value, err = cp.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "second", value)
+
+	// No temporary file is left behind
+	entries, err := os.ReadDir(filepath.Dir(cp.Path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	require.NoError(t, cp.Clear())
+	value, err = cp.Load()
+	require.NoError(t, err)
+	assert.Empty(t, value)
+	assert.NoError(t, cp.Clear(), "clearing twice is fine")
+}
+
+func TestFile_LoadTrimsTheLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last_id")
+	require.NoError(t, os.WriteFile(path, []byte("  edited by hand \n\n"), 0o640))
+
+	value, err := checkpoint.NewFile(path).Load()
+	require.NoError(t, err)
+	assert.Equal(t, "edited by hand", value)
+}
+
+func TestFile_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	// The checkpoint path is a directory
+	_, err := checkpoint.NewFile(dir).Load()
+	assert.Error(t, err)
+
+	// Its directory can't be created below a file
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o640))
+	assert.Error(t, checkpoint.NewFile(filepath.Join(file, "last_id")).Save("x"))
+}
@@ -0,0 +1,31 @@
+// Package httperr shapes the error responses of the API, shared by the
+// handlers and the middlewares so every error looks the same
+package httperr
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/pkg/requestid"
+)
+
+// Body is the body of the error responses, it carries the request ID so
+// support can match the error with the logs and events of the call
+func Body(c *gin.Context, msg string) gin.H {
+	body := gin.H{"error": msg}
+	if id := requestid.FromContext(c.Request.Context()); id != "" {
+		body["request_id"] = id
+	}
+	return body
+}
+
+// StatusCode maps an error to the HTTP status it should be reported with.
+// Errors that don't carry one are internal errors.
+func StatusCode(err error) int {
+	var coded interface{ StatusCode() int }
+	if errors.As(err, &coded) {
+		return coded.StatusCode()
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,36 @@
+package httperr_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innoglobe/xmgo/pkg/httperr"
+	"github.com/innoglobe/xmgo/pkg/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBody(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, gin.H{"error": "Not found"}, httperr.Body(c, "Not found"))
+
+	c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), "req-1"))
+	assert.Equal(t, gin.H{"error": "Not found", "request_id": "req-1"}, httperr.Body(c, "Not found"))
+}
+
+// notFoundError reports its status like the customerrors types
+type notFoundError struct{}
+
+func (notFoundError) Error() string   { return "no such company" }
+func (notFoundError) StatusCode() int { return http.StatusNotFound }
+
+func TestStatusCode(t *testing.T) {
+	notFound := &notFoundError{}
+	assert.Equal(t, http.StatusNotFound, httperr.StatusCode(notFound))
+	assert.Equal(t, http.StatusNotFound, httperr.StatusCode(fmt.Errorf("get company: %w", notFound)))
+	assert.Equal(t, http.StatusInternalServerError, httperr.StatusCode(errors.New("boom")))
+}
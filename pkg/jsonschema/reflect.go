@@ -0,0 +1,94 @@
+// Package jsonschema derives JSON Schemas (draft 2020-12) from Go types,
+// following their encoding/json tags
+package jsonschema
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema dialect of the generated schemas
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema, marshaling it gives a stable key order
+type Schema map[string]any
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Formats maps types encoded as strings to their JSON Schema format, e.g.
+// uuid.UUID to "uuid". time.Time is always a date-time.
+type Formats map[reflect.Type]string
+
+// Reflect returns the schema of v's type. Fields without omitempty are
+// required, interfaces accept any value.
+func Reflect(v any, formats Formats) Schema {
+	return reflectType(reflect.TypeOf(v), formats)
+}
+
+func reflectType(t reflect.Type, formats Formats) Schema {
+	if t == timeType {
+		return Schema{"type": "string", "format": "date-time"}
+	}
+	if format, ok := formats[t]; ok {
+		return Schema{"type": "string", "format": format}
+	}
+	if t.Kind() != reflect.Pointer && t.Implements(textMarshalerType) {
+		return Schema{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return reflectType(t.Elem(), formats)
+	case reflect.Interface:
+		return Schema{}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": reflectType(t.Elem(), formats)}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": reflectType(t.Elem(), formats)}
+	case reflect.Struct:
+		return reflectStruct(t, formats)
+	}
+	return Schema{}
+}
+
+func reflectStruct(t reflect.Type, formats Formats) Schema {
+	properties := Schema{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = reflectType(f.Type, formats)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	s := Schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
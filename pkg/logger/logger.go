@@ -1,31 +1,128 @@
+// Package logger is a thin leveled, structured logger on top of log/slog.
+// Messages take key-value pairs, e.g. log.Error("Failed to send", "error", err).
 package logger
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+)
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
 )
 
 type LoggerInterface interface {
-	Info(msg string)
-	Error(msg string)
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+	// With returns a child logger adding args to every record
+	With(args ...any) LoggerInterface
+}
+
+// Options configures a Logger. The zero value logs text at info level to stdout.
+type Options struct {
+	// Level is "debug", "info", "warn" or "error"
+	Level string
+	// Format is "text" or "json"
+	Format string
+	Output io.Writer
+}
+
+// Logger is the slog backed LoggerInterface. Its children share its level, so
+// SetLevel applies to the whole tree.
+type Logger struct {
+	slog  *slog.Logger
+	level *slog.LevelVar
 }
 
-type logger struct {
-	info  *log.Logger
-	error *log.Logger
+var _ LoggerInterface = &Logger{}
+
+// New returns a Logger configured by opts
+func New(opts Options) (*Logger, error) {
+	level := new(slog.LevelVar)
+	if opts.Level != "" {
+		if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q", opts.Level)
+		}
+	}
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(out, handlerOpts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", opts.Format)
+	}
+	return &Logger{slog: slog.New(handler), level: level}, nil
 }
 
+// NewLogger returns a Logger with the default options
 func NewLogger() LoggerInterface {
-	return &logger{
-		info:  log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
-		error: log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile),
+	l, _ := New(Options{})
+	return l
+}
+
+// Discard returns a Logger dropping every record
+func Discard() LoggerInterface {
+	l, _ := New(Options{Output: io.Discard})
+	return l
+}
+
+func (l *Logger) Debug(msg string, args ...any) { l.slog.Debug(msg, args...) }
+func (l *Logger) Info(msg string, args ...any)  { l.slog.Info(msg, args...) }
+func (l *Logger) Warn(msg string, args ...any)  { l.slog.Warn(msg, args...) }
+func (l *Logger) Error(msg string, args ...any) { l.slog.Error(msg, args...) }
+
+func (l *Logger) With(args ...any) LoggerInterface {
+	return &Logger{slog: l.slog.With(args...), level: l.level}
+}
+
+// Level returns the current minimum level, e.g. "INFO"
+func (l *Logger) Level() string {
+	return l.level.Level().String()
+}
+
+// SetLevel changes the minimum level at runtime
+func (l *Logger) SetLevel(level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
 	}
+	l.level.Set(lvl)
+	return nil
+}
+
+// Slog returns the underlying slog.Logger, for libraries taking one
+func (l *Logger) Slog() *slog.Logger {
+	return l.slog
 }
 
-func (l *logger) Info(msg string) {
-	l.info.Println(msg)
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying log, usually a child logger with
+// request scoped fields such as the request ID and the user
+func NewContext(ctx context.Context, log LoggerInterface) context.Context {
+	return context.WithValue(ctx, ctxKey{}, log)
 }
 
-func (l *logger) Error(msg string) {
-	l.error.Println(msg)
+// FromContext returns the logger stored in ctx, or fallback when there is none
+func FromContext(ctx context.Context, fallback LoggerInterface) LoggerInterface {
+	if log, ok := ctx.Value(ctxKey{}).(LoggerInterface); ok {
+		return log
+	}
+	return fallback
 }
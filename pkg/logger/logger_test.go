@@ -0,0 +1,61 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger_JSONWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := logger.New(logger.Options{Level: "info", Format: "json", Output: &buf})
+	require.NoError(t, err)
+
+	log.Debug("hidden")
+	log.With("request_id", "abc").Warn("Something happened", "count", 3)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "Something happened", record["msg"])
+	assert.Equal(t, "abc", record["request_id"])
+	assert.Equal(t, float64(3), record["count"])
+}
+
+func TestLogger_SetLevelAppliesToChildren(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := logger.New(logger.Options{Output: &buf})
+	require.NoError(t, err)
+	child := log.With("component", "test")
+
+	child.Debug("hidden")
+	assert.Empty(t, buf.String())
+
+	require.NoError(t, log.SetLevel("debug"))
+	child.Debug("shown")
+	assert.Contains(t, buf.String(), "msg=shown component=test")
+	assert.Equal(t, "DEBUG", log.Level())
+
+	assert.Error(t, log.SetLevel("loud"))
+}
+
+func TestLogger_InvalidOptions(t *testing.T) {
+	_, err := logger.New(logger.Options{Format: "xml"})
+	assert.Error(t, err)
+	_, err = logger.New(logger.Options{Level: "loud"})
+	assert.Error(t, err)
+}
+
+func TestContext(t *testing.T) {
+	fallback := logger.Discard()
+	assert.Equal(t, fallback, logger.FromContext(context.Background(), fallback))
+
+	child := fallback.With("request_id", "abc")
+	ctx := logger.NewContext(context.Background(), child)
+	assert.Equal(t, child, logger.FromContext(ctx, fallback))
+}
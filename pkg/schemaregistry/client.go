@@ -0,0 +1,190 @@
+// Package schemaregistry is a client for the Confluent schema registry REST
+// API, enough to check and register the schemas of the events we publish
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// Registry error codes, see https://docs.confluent.io/platform/current/schema-registry/develop/api.html
+const (
+	ErrCodeSubjectNotFound = 40401
+	ErrCodeVersionNotFound = 40402
+)
+
+// MagicByte starts every message in the Confluent wire format
+const MagicByte byte = 0
+
+// ErrIncompatible is returned by Register when the registry rejects a schema
+// as incompatible with the versions already registered
+var ErrIncompatible = errors.New("schema is incompatible with the registered versions")
+
+// Error is an error answered by the registry
+type Error struct {
+	Status  int    `json:"-"`
+	Code    int    `json:"error_code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("schema registry: %s (%d)", e.Message, e.Code)
+}
+
+type Config struct {
+	URL      string
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+type Client struct {
+	baseURL  string
+	username string
+	password string
+	http     *http.Client
+
+	mu  sync.Mutex
+	ids map[string]int // by subject and schema
+}
+
+func New(cfg Config) *Client {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &Client{
+		baseURL:  strings.TrimSuffix(cfg.URL, "/"),
+		username: cfg.Username,
+		password: cfg.Password,
+		http:     &http.Client{Timeout: timeout},
+		ids:      make(map[string]int),
+	}
+}
+
+// SchemaURL is where the registry serves the schema with this ID
+func (c *Client) SchemaURL(id int) string {
+	return fmt.Sprintf("%s/schemas/ids/%d", c.baseURL, id)
+}
+
+type schemaRequest struct {
+	Schema string `json:"schema"`
+}
+
+// CheckCompatibility tells whether schema is compatible with the latest
+// version of subject, under the compatibility level set in the registry.
+// A subject without versions accepts any schema.
+func (c *Client) CheckCompatibility(ctx context.Context, subject, schema string) (bool, []string, error) {
+	var res struct {
+		IsCompatible bool     `json:"is_compatible"`
+		Messages     []string `json:"messages"`
+	}
+	path := "/compatibility/subjects/" + url.PathEscape(subject) + "/versions/latest?verbose=true"
+	err := c.do(ctx, http.MethodPost, path, schemaRequest{Schema: schema}, &res)
+	var regErr *Error
+	if errors.As(err, &regErr) && (regErr.Code == ErrCodeSubjectNotFound || regErr.Code == ErrCodeVersionNotFound) {
+		return true, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	return res.IsCompatible, res.Messages, nil
+}
+
+// Register checks schema against the latest version of subject and
+// registers it, returning its ID. Registering a known schema is a no-op
+// returning the existing ID, IDs are cached so this is cheap to repeat.
+func (c *Client) Register(ctx context.Context, subject, schema string) (int, error) {
+	key := subject + "\x00" + schema
+	c.mu.Lock()
+	id, ok := c.ids[key]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	compatible, messages, err := c.CheckCompatibility(ctx, subject, schema)
+	if err != nil {
+		return 0, err
+	}
+	if !compatible {
+		return 0, fmt.Errorf("%s: %w: %s", subject, ErrIncompatible, strings.Join(messages, "; "))
+	}
+
+	var res struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", schemaRequest{Schema: schema}, &res); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.ids[key] = res.ID
+	c.mu.Unlock()
+	return res.ID, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("schema registry: %w", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("schema registry: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		regErr := &Error{Status: res.StatusCode}
+		if json.Unmarshal(data, regErr) != nil || regErr.Message == "" {
+			regErr.Message = res.Status
+		}
+		return regErr
+	}
+	return json.Unmarshal(data, out)
+}
+
+// WireFormat prefixes a serialized payload with the magic byte and the
+// schema ID, as Confluent serializers and deserializers expect
+func WireFormat(id int, payload []byte) []byte {
+	out := make([]byte, 5, 5+len(payload))
+	out[0] = MagicByte
+	binary.BigEndian.PutUint32(out[1:], uint32(id))
+	return append(out, payload...)
+}
+
+// ParseWireFormat splits a message in the Confluent wire format into its
+// schema ID and payload
+func ParseWireFormat(msg []byte) (int, []byte, error) {
+	if len(msg) < 5 || msg[0] != MagicByte {
+		return 0, nil, errors.New("schema registry: not in the wire format")
+	}
+	return int(binary.BigEndian.Uint32(msg[1:5])), msg[5:], nil
+}
@@ -0,0 +1,192 @@
+package tlsreload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/innoglobe/xmgo/pkg/logger"
+)
+
+// Reloader keeps a server certificate and an optional client CA bundle in
+// memory and reloads them when the files change on disk
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	log      logger.LoggerInterface
+
+	// reloadMu serializes the reloads, the file names are only changed with
+	// it held
+	reloadMu sync.Mutex
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	stamps   map[string]fileStamp
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New loads the certificate, key and CA bundle. caFile may be empty when
+// client certificates aren't verified.
+func New(certFile, keyFile, caFile string, log logger.LoggerInterface) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		log:      log,
+		stamps:   make(map[string]fileStamp),
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Watch polls the files every interval and reloads them when one changed,
+// until ctx is done. A broken file is logged and the previous material kept.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				r.log.Error("Failed to reload TLS material, keeping the previous one", "error", err)
+				continue
+			}
+			r.log.Info("TLS certificates reloaded")
+		}
+	}
+}
+
+// SetFiles switches to other certificate, key and CA files. The new files are
+// loaded right away, when they are broken the previous files are kept.
+func (r *Reloader) SetFiles(certFile, keyFile, caFile string) error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	prevCert, prevKey, prevCA := r.certFile, r.keyFile, r.caFile
+	r.setFiles(certFile, keyFile, caFile)
+	if err := r.load(); err != nil {
+		r.setFiles(prevCert, prevKey, prevCA)
+		return err
+	}
+	return nil
+}
+
+func (r *Reloader) setFiles(certFile, keyFile, caFile string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certFile, r.keyFile, r.caFile = certFile, keyFile, caFile
+}
+
+// nextProtos are offered through ALPN, like net/http does for its own TLS
+// configs. The config returned by GetConfigForClient replaces the server's,
+// without them clients would fall back to HTTP/1.1.
+var nextProtos = []string{"h2", "http/1.1"}
+
+// TLSConfig returns a server config that always serves the latest certificate
+// and verifies client certificates against the latest CA bundle
+func (r *Reloader) TLSConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   nextProtos,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   clientAuth,
+				ClientCAs:    r.pool,
+			}, nil
+		},
+	}
+}
+
+func (r *Reloader) reload() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+	return r.load()
+}
+
+// load reads the files, it must be called with reloadMu held
+func (r *Reloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("read CA bundle: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("CA bundle contains no certificates")
+		}
+	}
+
+	stamps := make(map[string]fileStamp)
+	for _, f := range r.files() {
+		if st, err := stat(f); err == nil {
+			stamps[f] = st
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.pool = pool
+	r.stamps = stamps
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Reloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.files() {
+		st, err := stat(f)
+		if err != nil {
+			// Files are often replaced by rename, try again on the next tick
+			continue
+		}
+		if st != r.stamps[f] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	return files
+}
+
+func stat(name string) (fileStamp, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: fi.ModTime(), size: fi.Size()}, nil
+}
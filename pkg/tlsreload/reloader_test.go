@@ -0,0 +1,179 @@
+package tlsreload_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/innoglobe/xmgo/pkg/logger"
+	"github.com/innoglobe/xmgo/pkg/tlsreload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingLogger keeps the messages logged
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) record(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, msg)
+}
+
+func (l *recordingLogger) Debug(msg string, _ ...any)         { l.record(msg) }
+func (l *recordingLogger) Info(msg string, _ ...any)          { l.record(msg) }
+func (l *recordingLogger) Warn(msg string, _ ...any)          { l.record(msg) }
+func (l *recordingLogger) Error(msg string, _ ...any)         { l.record(msg) }
+func (l *recordingLogger) With(...any) logger.LoggerInterface { return l }
+
+func (l *recordingLogger) logged(prefix string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range l.messages {
+		if strings.HasPrefix(m, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCert writes a self-signed certificate for commonName and its key to dir
+func writeCert(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+// writeFile writes data to name with a new modification time, so the change
+// is seen even within the resolution of the file system clock
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	var mtime time.Time
+	if fi, err := os.Stat(name); err == nil {
+		mtime = fi.ModTime().Add(time.Second)
+	} else {
+		mtime = time.Now()
+	}
+	require.NoError(t, os.WriteFile(name, data, 0o600))
+	require.NoError(t, os.Chtimes(name, mtime, mtime))
+}
+
+// served returns the common name of the certificate the config serves
+func served(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+	conf, err := cfg.GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(conf.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestReloader_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+	log := &recordingLogger{}
+	r, err := tlsreload.New(certFile, keyFile, "", log)
+	require.NoError(t, err)
+	cfg := r.TLSConfig(tls.NoClientCert)
+	assert.Equal(t, "first", served(t, cfg))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	writeCert(t, dir, "second")
+	assert.Eventually(t, func() bool { return served(t, cfg) == "second" }, 2*time.Second, 10*time.Millisecond)
+	assert.True(t, log.logged("TLS certificates reloaded"))
+}
+
+func TestReloader_BrokenFileKeepsTheCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "good")
+	log := &recordingLogger{}
+	r, err := tlsreload.New(certFile, keyFile, "", log)
+	require.NoError(t, err)
+	cfg := r.TLSConfig(tls.NoClientCert)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	writeFile(t, certFile, []byte("not a certificate"))
+	assert.Eventually(t, func() bool { return log.logged("Failed to reload TLS material") }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "good", served(t, cfg))
+
+	// Switching to broken files is refused as well
+	assert.Error(t, r.SetFiles(filepath.Join(dir, "missing.pem"), keyFile, ""))
+	assert.Equal(t, "good", served(t, cfg))
+}
+
+func TestReloader_ClientCAs(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server")
+	caDir := t.TempDir()
+	caFile, _ := writeCert(t, caDir, "client-ca")
+
+	_, err := tlsreload.New(certFile, keyFile, keyFile, logger.Discard())
+	assert.ErrorContains(t, err, "CA bundle contains no certificates")
+
+	r, err := tlsreload.New(certFile, keyFile, caFile, logger.Discard())
+	require.NoError(t, err)
+	conf, err := r.TLSConfig(tls.RequireAndVerifyClientCert).GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, conf.ClientAuth)
+	assert.NotNil(t, conf.ClientCAs)
+}
+
+func TestReloader_NegotiatesHTTP2(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), "server")
+	r, err := tlsreload.New(certFile, keyFile, "", logger.Discard())
+	require.NoError(t, err)
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	go func() {
+		_ = tls.Server(serverConn, r.TLSConfig(tls.NoClientCert)).Handshake()
+	}()
+
+	client := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2", "http/1.1"}})
+	require.NoError(t, client.Handshake())
+	assert.Equal(t, "h2", client.ConnectionState().NegotiatedProtocol)
+}